@@ -98,6 +98,12 @@ extern __declspec(dllexport) uintptr_t Host_JoinWorld(uintptr_t h, char* url_ptr
 extern __declspec(dllexport) int Host_WriteANDStatisticsLogFile(uintptr_t h);
 extern __declspec(dllexport) int World_GetSessionID(uintptr_t h, char* world_ID_out);
 extern __declspec(dllexport) int World_GetURL(uintptr_t h, char* buf_ptr, int buf_len);
+extern __declspec(dllexport) int World_GetMemberHashes(uintptr_t h, char* buf_ptr, int buf_len);
+extern __declspec(dllexport) uintptr_t World_GetMember(uintptr_t h, char* peer_hash_ptr, int peer_hash_len);
+extern __declspec(dllexport) int World_GetObjects(uintptr_t h, char* buf_ptr, int buf_len);
+extern __declspec(dllexport) int World_GetObjectOwner(uintptr_t h, char* object_ID, char* buf_ptr, int buf_len);
+extern __declspec(dllexport) int World_RequestOwnership(uintptr_t h, char* owner_hash_ptr, int owner_hash_len, char* object_ID);
+extern __declspec(dllexport) int World_TransferOwnership(uintptr_t h, char* object_ID, char* new_owner_hash_ptr, int new_owner_hash_len);
 extern __declspec(dllexport) uintptr_t World_WaitEvent(uintptr_t h, int* event_type_out);
 extern __declspec(dllexport) int WorldPeerRequest_GetHash(uintptr_t h, char* buf, int buf_len);
 extern __declspec(dllexport) int WorldPeerRequest_Accept(uintptr_t h);
@@ -105,11 +111,27 @@ extern __declspec(dllexport) int WorldPeerRequest_Decline(uintptr_t h, int code,
 extern __declspec(dllexport) int WorldPeer_GetHash(uintptr_t h, char* buf, int buf_len);
 extern __declspec(dllexport) int WorldPeer_AppendObjects(uintptr_t h, char* json_ptr, int json_len);
 extern __declspec(dllexport) int WorldPeer_DeleteObjects(uintptr_t h, char* json_ptr, int json_len);
+extern __declspec(dllexport) int WorldPeer_UpdateTransforms(uintptr_t h, char* json_ptr, int json_len);
+extern __declspec(dllexport) int WorldPeer_UpdateObjects(uintptr_t h, char* json_ptr, int json_len);
+extern __declspec(dllexport) int WorldPeer_SendMessage(uintptr_t h, char* topic_ptr, int topic_len, char* payload_ptr, int payload_len);
+extern __declspec(dllexport) int World_Broadcast(uintptr_t h, char* topic_ptr, int topic_len, char* payload_ptr, int payload_len);
 extern __declspec(dllexport) int WorldPeerObjectAppend_GetHead(uintptr_t h, char* peer_hash_out, int* body_len);
 extern __declspec(dllexport) int WorldPeerObjectAppend_GetBody(uintptr_t h, char* buf, int buf_len);
 extern __declspec(dllexport) int WorldPeerObjectDelete_GetHead(uintptr_t h, char* peer_hash_out, int* body_len);
 extern __declspec(dllexport) int WorldPeerObjectDelete_GetBody(uintptr_t h, char* buf, int buf_len);
+extern __declspec(dllexport) int WorldPeerObjectTransform_GetHead(uintptr_t h, char* peer_hash_out, int* body_len);
+extern __declspec(dllexport) int WorldPeerObjectTransform_GetBody(uintptr_t h, char* buf, int buf_len);
+extern __declspec(dllexport) int WorldPeerObjectUpdate_GetHead(uintptr_t h, char* peer_hash_out, int* body_len);
+extern __declspec(dllexport) int WorldPeerObjectUpdate_GetBody(uintptr_t h, char* buf, int buf_len);
+extern __declspec(dllexport) int WorldObjectOwnershipRequest_GetHead(uintptr_t h, char* peer_hash_out, char* object_ID_out);
+extern __declspec(dllexport) int WorldObjectOwnershipRequest_Grant(uintptr_t h);
+extern __declspec(dllexport) int WorldObjectOwnershipChange_GetHead(uintptr_t h, char* peer_hash_out, int* body_len);
+extern __declspec(dllexport) int WorldObjectOwnershipChange_GetBody(uintptr_t h, char* buf, int buf_len);
+extern __declspec(dllexport) int WorldPeerMessage_GetHead(uintptr_t h, char* peer_hash_out, int* topic_len, int* body_len);
+extern __declspec(dllexport) int WorldPeerMessage_GetTopic(uintptr_t h, char* buf, int buf_len);
+extern __declspec(dllexport) int WorldPeerMessage_GetBody(uintptr_t h, char* buf, int buf_len);
 extern __declspec(dllexport) int WorldPeerLeave_GetHash(uintptr_t h, char* buf, int buf_len);
+extern __declspec(dllexport) int WorldPeerLeave_GetReason(uintptr_t h, int* code_out, char* buf, int buf_len);
 extern __declspec(dllexport) int WorldLeave(uintptr_t h);
 extern __declspec(dllexport) uintptr_t Host_GetAbystClientConnection(uintptr_t h, char* peer_hash_ptr, int peer_hash_len, int timeout_ms, uintptr_t* err_out);
 extern __declspec(dllexport) uintptr_t AbystClient_Request(uintptr_t h, int method, char* path_ptr, int path_len, uintptr_t* err_out);
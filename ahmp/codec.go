@@ -0,0 +1,205 @@
+package ahmp
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/google/uuid"
+)
+
+var ErrUnknownType = errors.New("unknown AHMP message type")
+
+// application message types must be at or above APP_T_BASE.
+const APP_T_BASE = 0x100
+
+// Codec is the registry entry of an AHMP message type.
+// It converts the parsed message *M from and to its wire forms; *R is a CBOR map, and *C is the compact form.
+type Codec struct {
+	Type int
+	Name string
+
+	message_type reflect.Type
+	encode       func(message any, compact bool) any
+	parse        func(payload []byte, compact bool) (any, error)
+	sender_field int //index of SenderSessionID in M, -1 if absent. see SessionIDs.
+	recver_field int //index of RecverSessionID in M, -1 if absent.
+}
+
+type parser[T any, M any] interface {
+	*T
+	TryParse() (*M, error)
+}
+
+// NewCodec makes the codec of the message type M.
+// The raw and compact forms may be the same type, if the message has no compact form.
+func NewCodec[M any, R any, C any, PR parser[R, M], PC parser[C, M]](ahmp_type int, name string, new_raw func(*M) *R, new_compact func(*M) *C) *Codec {
+	return &Codec{
+		Type:         ahmp_type,
+		Name:         name,
+		message_type: reflect.TypeFor[*M](),
+		sender_field: sessionFieldIndex(reflect.TypeFor[M](), "SenderSessionID"),
+		recver_field: sessionFieldIndex(reflect.TypeFor[M](), "RecverSessionID"),
+		encode: func(message any, compact bool) any {
+			if compact {
+				return new_compact(message.(*M))
+			}
+			return new_raw(message.(*M))
+		},
+		parse: func(payload []byte, compact bool) (any, error) {
+			var parsed_msg *M
+			var err error
+			if compact {
+				parsed_msg, err = unmarshalAndParse[C, M, PC](payload)
+			} else {
+				parsed_msg, err = unmarshalAndParse[R, M, PR](payload)
+			}
+			if err != nil {
+				return nil, err
+			}
+			return parsed_msg, nil
+		},
+	}
+}
+
+// sessionFieldIndex returns the index of the session ID field of the message struct, or -1.
+func sessionFieldIndex(message_type reflect.Type, name string) int {
+	if message_type.Kind() != reflect.Struct {
+		return -1
+	}
+	field, ok := message_type.FieldByName(name)
+	if !ok || len(field.Index) != 1 || field.Type != reflect.TypeFor[uuid.UUID]() {
+		return -1
+	}
+	return field.Index[0]
+}
+
+func unmarshalAndParse[T any, M any, PT parser[T, M]](payload []byte) (*M, error) {
+	var raw_msg T
+	if err := cbor.Unmarshal(payload, &raw_msg); err != nil {
+		return nil, err
+	}
+	return PT(&raw_msg).TryParse()
+}
+
+type codecRegistry struct {
+	by_type    map[int]*Codec
+	by_message map[reflect.Type]*Codec
+	mtx        sync.RWMutex
+}
+
+var registry = &codecRegistry{
+	by_type:    make(map[int]*Codec),
+	by_message: make(map[reflect.Type]*Codec),
+}
+
+// Register adds the codec of a message type. Both the type id and the message type must be new.
+// Applications register their types, at or above APP_T_BASE, before any peer sends them.
+func Register(codec *Codec) error {
+	registry.mtx.Lock()
+	defer registry.mtx.Unlock()
+
+	if _, ok := registry.by_type[codec.Type]; ok {
+		return errors.New("AHMP type " + strconv.Itoa(codec.Type) + " is already registered")
+	}
+	if _, ok := registry.by_message[codec.message_type]; ok {
+		return errors.New("AHMP message " + codec.message_type.String() + " is already registered")
+	}
+	registry.by_type[codec.Type] = codec
+	registry.by_message[codec.message_type] = codec
+	return nil
+}
+
+func mustRegister(codec *Codec) {
+	if err := Register(codec); err != nil {
+		panic(err)
+	}
+}
+
+func Lookup(ahmp_type int) (*Codec, bool) {
+	registry.mtx.RLock()
+	defer registry.mtx.RUnlock()
+
+	codec, ok := registry.by_type[ahmp_type]
+	return codec, ok
+}
+
+func LookupMessage(message any) (*Codec, bool) {
+	registry.mtx.RLock()
+	defer registry.mtx.RUnlock()
+
+	codec, ok := registry.by_message[reflect.TypeOf(message)]
+	return codec, ok
+}
+
+// Name returns the registered name of the type, for debugging.
+func Name(ahmp_type int) string {
+	if codec, ok := Lookup(ahmp_type); ok {
+		return codec.Name
+	}
+	return "#" + strconv.Itoa(ahmp_type)
+}
+
+// SessionIDs returns the SenderSessionID and RecverSessionID of a registered message.
+// ok is false for a message without a sender session. A missing RecverSessionID is nil.
+func SessionIDs(message any) (sender uuid.UUID, recver uuid.UUID, ok bool) {
+	codec, found := LookupMessage(message)
+	if !found || codec.sender_field < 0 {
+		return uuid.Nil, uuid.Nil, false
+	}
+	value := reflect.ValueOf(message).Elem()
+	sender = value.Field(codec.sender_field).Interface().(uuid.UUID)
+	if codec.recver_field >= 0 {
+		recver = value.Field(codec.recver_field).Interface().(uuid.UUID)
+	}
+	return sender, recver, sender != uuid.Nil
+}
+
+// EncodeFrame encodes the parsed message in a frame, in the compact form if compact is set.
+// returns the AHMP type of the message.
+func EncodeFrame(message any, compact bool) (int, []byte, error) {
+	codec, ok := LookupMessage(message)
+	if !ok {
+		return 0, nil, ErrUnknownType
+	}
+	frame, err := NewRawFrame(codec.Type, codec.encode(message, compact))
+	if err != nil {
+		return 0, nil, err
+	}
+	result, err := cbor.Marshal(frame)
+	return codec.Type, result, err
+}
+
+// ParseFrame decodes the payload of the frame, and parses it.
+// returns ErrUnknownType if the type is not registered.
+func ParseFrame(frame *RawFrame, compact bool) (any, error) {
+	codec, ok := Lookup(frame.Type)
+	if !ok {
+		return nil, ErrUnknownType
+	}
+	return codec.parse(frame.Payload, compact)
+}
+
+func init() {
+	mustRegister(NewCodec(JN_T, "JN", NewRawJN, NewCompactJN))
+	mustRegister(NewCodec(JOK_T, "JOK", NewRawJOK, NewCompactJOK))
+	mustRegister(NewCodec(JDN_T, "JDN", NewRawJDN, NewCompactJDN))
+	mustRegister(NewCodec(JNI_T, "JNI", NewRawJNI, NewCompactJNI))
+	mustRegister(NewCodec(MEM_T, "MEM", NewRawMEM, NewCompactMEM))
+	mustRegister(NewCodec(SJN_T, "SJN", NewRawSJN, NewCompactSJN))
+	mustRegister(NewCodec(CRR_T, "CRR", NewRawCRR, NewCompactCRR))
+	mustRegister(NewCodec(RST_T, "RST", NewRawRST, NewCompactRST))
+	mustRegister(NewCodec(SOA_T, "SOA", NewRawSOA, NewCompactSOA))
+	mustRegister(NewCodec(SOD_T, "SOD", NewRawSOD, NewCompactSOD))
+	mustRegister(NewCodec(RAR_T, "RAR", NewRawRAR, NewCompactRAR))
+	mustRegister(NewCodec(HPR_T, "HPR", NewRawHPR, NewCompactHPR))
+	mustRegister(NewCodec(HPS_T, "HPS", NewRawHPS, NewCompactHPS))
+	mustRegister(NewCodec(SOT_T, "SOT", NewRawSOT, NewCompactSOT))
+	mustRegister(NewCodec(MSG_T, "MSG", NewRawMSG, NewCompactMSG))
+	mustRegister(NewCodec(SOU_T, "SOU", NewRawSOU, NewCompactSOU))
+	mustRegister(NewCodec(OWR_T, "OWR", NewRawOWR, NewCompactOWR))
+	mustRegister(NewCodec(OHO_T, "OHO", NewRawOHO, NewCompactOHO))
+	mustRegister(NewCodec(RSR_T, "RSR", NewRawRSR, NewCompactRSR))
+}
@@ -0,0 +1,495 @@
+package ahmp
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/MinwooWebeng/abyss_core/aurl"
+	abyss "github.com/MinwooWebeng/abyss_core/interfaces"
+	"github.com/MinwooWebeng/abyss_core/tools/functional"
+
+	"github.com/google/uuid"
+)
+
+// Compact messages are used between peers that negotiated abyss.CAP_COMPRESSION.
+// They are CBOR arrays instead of maps with field names, and carry UUIDs as 16 byte strings.
+// The certificates of a neighbor are omitted when they were already sent on the connection;
+// the receiver knows the peer by its hash in the AURL.
+
+type CompactSessionInfoForDiscovery struct {
+	_                          struct{} `cbor:",toarray"`
+	AURL                       string
+	SessionID                  uuid.UUID
+	TimeStamp                  int64
+	RootCertificateDer         []byte //nil if already sent
+	HandshakeKeyCertificateDer []byte //nil if already sent
+}
+
+func newCompactSessionInfoForDiscovery(i abyss.ANDFullPeerSessionIdentity) CompactSessionInfoForDiscovery {
+	return CompactSessionInfoForDiscovery{
+		AURL:                       i.AURL.ToString(),
+		SessionID:                  i.SessionID,
+		TimeStamp:                  i.TimeStamp.UnixMilli(),
+		RootCertificateDer:         i.RootCertificateDer,
+		HandshakeKeyCertificateDer: i.HandshakeKeyCertificateDer,
+	}
+}
+
+func (i *CompactSessionInfoForDiscovery) tryParse() (abyss.ANDFullPeerSessionIdentity, error) {
+	abyss_url, err := aurl.TryParse(i.AURL)
+	if err != nil {
+		return abyss.ANDFullPeerSessionIdentity{}, err
+	}
+	return abyss.ANDFullPeerSessionIdentity{
+		AURL:                       abyss_url,
+		SessionID:                  i.SessionID,
+		TimeStamp:                  time.UnixMilli(i.TimeStamp),
+		RootCertificateDer:         i.RootCertificateDer,
+		HandshakeKeyCertificateDer: i.HandshakeKeyCertificateDer,
+	}, nil
+}
+
+type CompactSessionInfoForSJN struct {
+	_         struct{} `cbor:",toarray"`
+	PeerHash  string
+	SessionID uuid.UUID
+}
+
+func newCompactSessionInfosForSJN(infos []abyss.ANDPeerSessionIdentity) []CompactSessionInfoForSJN {
+	return functional.Filter(infos, func(i abyss.ANDPeerSessionIdentity) CompactSessionInfoForSJN {
+		return CompactSessionInfoForSJN{PeerHash: i.PeerHash, SessionID: i.SessionID}
+	})
+}
+
+func parseCompactSessionInfosForSJN(infos []CompactSessionInfoForSJN) []abyss.ANDPeerSessionIdentity {
+	return functional.Filter(infos, func(i CompactSessionInfoForSJN) abyss.ANDPeerSessionIdentity {
+		return abyss.ANDPeerSessionIdentity{PeerHash: i.PeerHash, SessionID: i.SessionID}
+	})
+}
+
+type CompactJN struct {
+	_               struct{} `cbor:",toarray"`
+	SenderSessionID uuid.UUID
+	Text            string
+	TimeStamp       int64
+}
+
+func NewCompactJN(m *JN) *CompactJN {
+	return &CompactJN{SenderSessionID: m.SenderSessionID, Text: m.Text, TimeStamp: m.TimeStamp.UnixMilli()}
+}
+
+func (r *CompactJN) TryParse() (*JN, error) {
+	return &JN{r.SenderSessionID, r.Text, time.UnixMilli(r.TimeStamp)}, nil
+}
+
+type CompactJOK struct {
+	_               struct{} `cbor:",toarray"`
+	SenderSessionID uuid.UUID
+	RecverSessionID uuid.UUID
+	TimeStamp       int64
+	Text            string
+	Neighbors       []CompactSessionInfoForDiscovery
+}
+
+func NewCompactJOK(m *JOK) *CompactJOK {
+	return &CompactJOK{
+		SenderSessionID: m.SenderSessionID,
+		RecverSessionID: m.RecverSessionID,
+		TimeStamp:       m.TimeStamp.UnixMilli(),
+		Text:            m.Text,
+		Neighbors:       functional.Filter(m.Neighbors, newCompactSessionInfoForDiscovery),
+	}
+}
+
+func (r *CompactJOK) TryParse() (*JOK, error) {
+	neig, _, err := functional.Filter_until_err(r.Neighbors, func(i CompactSessionInfoForDiscovery) (abyss.ANDFullPeerSessionIdentity, error) {
+		return i.tryParse()
+	})
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to parse session information"), err)
+	}
+	return &JOK{r.SenderSessionID, r.RecverSessionID, time.UnixMilli(r.TimeStamp), neig, r.Text}, nil
+}
+
+type CompactJDN struct {
+	_               struct{} `cbor:",toarray"`
+	RecverSessionID uuid.UUID
+	Code            int
+	Text            string
+}
+
+func NewCompactJDN(m *JDN) *CompactJDN {
+	return &CompactJDN{RecverSessionID: m.RecverSessionID, Code: m.Code, Text: m.Text}
+}
+
+func (r *CompactJDN) TryParse() (*JDN, error) {
+	return &JDN{r.RecverSessionID, r.Text, r.Code}, nil
+}
+
+type CompactJNI struct {
+	_               struct{} `cbor:",toarray"`
+	SenderSessionID uuid.UUID
+	RecverSessionID uuid.UUID
+	Neighbor        CompactSessionInfoForDiscovery
+}
+
+func NewCompactJNI(m *JNI) *CompactJNI {
+	return &CompactJNI{
+		SenderSessionID: m.SenderSessionID,
+		RecverSessionID: m.RecverSessionID,
+		Neighbor:        newCompactSessionInfoForDiscovery(m.Neighbor),
+	}
+}
+
+func (r *CompactJNI) TryParse() (*JNI, error) {
+	neighbor, err := r.Neighbor.tryParse()
+	if err != nil {
+		return nil, err
+	}
+	return &JNI{r.SenderSessionID, r.RecverSessionID, neighbor}, nil
+}
+
+type CompactMEM struct {
+	_               struct{} `cbor:",toarray"`
+	SenderSessionID uuid.UUID
+	RecverSessionID uuid.UUID
+	TimeStamp       int64
+}
+
+func NewCompactMEM(m *MEM) *CompactMEM {
+	return &CompactMEM{SenderSessionID: m.SenderSessionID, RecverSessionID: m.RecverSessionID, TimeStamp: m.TimeStamp.UnixMilli()}
+}
+
+func (r *CompactMEM) TryParse() (*MEM, error) {
+	return &MEM{r.SenderSessionID, r.RecverSessionID, time.UnixMilli(r.TimeStamp)}, nil
+}
+
+type CompactSJN struct {
+	_               struct{} `cbor:",toarray"`
+	SenderSessionID uuid.UUID
+	RecverSessionID uuid.UUID
+	MemberInfos     []CompactSessionInfoForSJN
+}
+
+func NewCompactSJN(m *SJN) *CompactSJN {
+	return &CompactSJN{SenderSessionID: m.SenderSessionID, RecverSessionID: m.RecverSessionID, MemberInfos: newCompactSessionInfosForSJN(m.MemberInfos)}
+}
+
+func (r *CompactSJN) TryParse() (*SJN, error) {
+	return &SJN{r.SenderSessionID, r.RecverSessionID, parseCompactSessionInfosForSJN(r.MemberInfos)}, nil
+}
+
+type CompactCRR struct {
+	_               struct{} `cbor:",toarray"`
+	SenderSessionID uuid.UUID
+	RecverSessionID uuid.UUID
+	MemberInfos     []CompactSessionInfoForSJN
+}
+
+func NewCompactCRR(m *CRR) *CompactCRR {
+	return &CompactCRR{SenderSessionID: m.SenderSessionID, RecverSessionID: m.RecverSessionID, MemberInfos: newCompactSessionInfosForSJN(m.MemberInfos)}
+}
+
+func (r *CompactCRR) TryParse() (*CRR, error) {
+	return &CRR{r.SenderSessionID, r.RecverSessionID, parseCompactSessionInfosForSJN(r.MemberInfos)}, nil
+}
+
+type CompactRST struct {
+	_               struct{} `cbor:",toarray"`
+	SenderSessionID uuid.UUID
+	RecverSessionID uuid.UUID
+	Message         string
+}
+
+func NewCompactRST(m *RST) *CompactRST {
+	return &CompactRST{SenderSessionID: m.SenderSessionID, RecverSessionID: m.RecverSessionID, Message: m.Message}
+}
+
+func (r *CompactRST) TryParse() (*RST, error) {
+	return &RST{r.SenderSessionID, r.RecverSessionID, r.Message}, nil
+}
+
+type CompactObjectProperty struct {
+	_       struct{} `cbor:",toarray"`
+	Version uint64
+	Value   []byte
+}
+
+func newCompactObjectProperties(properties map[string]abyss.ObjectProperty) map[string]CompactObjectProperty {
+	if properties == nil {
+		return nil
+	}
+	result := make(map[string]CompactObjectProperty, len(properties))
+	for key, property := range properties {
+		result[key] = CompactObjectProperty{Version: property.Version, Value: property.Value}
+	}
+	return result
+}
+
+func parseCompactObjectProperties(properties map[string]CompactObjectProperty) map[string]abyss.ObjectProperty {
+	if properties == nil {
+		return nil
+	}
+	result := make(map[string]abyss.ObjectProperty, len(properties))
+	for key, property := range properties {
+		result[key] = abyss.ObjectProperty{Version: property.Version, Value: property.Value}
+	}
+	return result
+}
+
+type CompactObjectInfo struct {
+	_          struct{} `cbor:",toarray"`
+	ID         uuid.UUID
+	Address    string
+	Transform  [7]float32
+	Properties map[string]CompactObjectProperty
+}
+type CompactSOA struct {
+	_               struct{} `cbor:",toarray"`
+	SenderSessionID uuid.UUID
+	RecverSessionID uuid.UUID
+	Objects         []CompactObjectInfo
+}
+
+func NewCompactSOA(m *SOA) *CompactSOA {
+	return &CompactSOA{
+		SenderSessionID: m.SenderSessionID,
+		RecverSessionID: m.RecverSessionID,
+		Objects: functional.Filter(m.Objects, func(o abyss.ObjectInfo) CompactObjectInfo {
+			return CompactObjectInfo{ID: o.ID, Address: o.Addr, Transform: o.Transform, Properties: newCompactObjectProperties(o.Properties)}
+		}),
+	}
+}
+
+func (r *CompactSOA) TryParse() (*SOA, error) {
+	objects := functional.Filter(r.Objects, func(o CompactObjectInfo) abyss.ObjectInfo {
+		return abyss.ObjectInfo{ID: o.ID, Addr: o.Address, Transform: o.Transform, Properties: parseCompactObjectProperties(o.Properties)}
+	})
+	return &SOA{r.SenderSessionID, r.RecverSessionID, objects}, nil
+}
+
+type CompactSOD struct {
+	_               struct{} `cbor:",toarray"`
+	SenderSessionID uuid.UUID
+	RecverSessionID uuid.UUID
+	ObjectIDs       []uuid.UUID
+}
+
+func NewCompactSOD(m *SOD) *CompactSOD {
+	return &CompactSOD{SenderSessionID: m.SenderSessionID, RecverSessionID: m.RecverSessionID, ObjectIDs: m.ObjectIDs}
+}
+
+func (r *CompactSOD) TryParse() (*SOD, error) {
+	return &SOD{r.SenderSessionID, r.RecverSessionID, r.ObjectIDs}, nil
+}
+
+type CompactObjectUpdate struct {
+	_          struct{} `cbor:",toarray"`
+	ID         uuid.UUID
+	Address    *string
+	Transform  *[7]float32
+	Properties map[string]CompactObjectProperty
+}
+type CompactSOU struct {
+	_               struct{} `cbor:",toarray"`
+	SenderSessionID uuid.UUID
+	RecverSessionID uuid.UUID
+	Updates         []CompactObjectUpdate
+}
+
+func NewCompactSOU(m *SOU) *CompactSOU {
+	return &CompactSOU{
+		SenderSessionID: m.SenderSessionID,
+		RecverSessionID: m.RecverSessionID,
+		Updates: functional.Filter(m.Updates, func(u abyss.ObjectUpdate) CompactObjectUpdate {
+			return CompactObjectUpdate{ID: u.ID, Address: u.Addr, Transform: u.Transform, Properties: newCompactObjectProperties(u.Properties)}
+		}),
+	}
+}
+
+func (r *CompactSOU) TryParse() (*SOU, error) {
+	updates := functional.Filter(r.Updates, func(u CompactObjectUpdate) abyss.ObjectUpdate {
+		return abyss.ObjectUpdate{ID: u.ID, Addr: u.Address, Transform: u.Transform, Properties: parseCompactObjectProperties(u.Properties)}
+	})
+	return &SOU{r.SenderSessionID, r.RecverSessionID, updates}, nil
+}
+
+type CompactObjectTransform struct {
+	_         struct{} `cbor:",toarray"`
+	ID        uuid.UUID
+	Transform [7]float32
+}
+type CompactSOT struct {
+	_               struct{} `cbor:",toarray"`
+	SenderSessionID uuid.UUID
+	RecverSessionID uuid.UUID
+	Sequence        uint64
+	Transforms      []CompactObjectTransform
+}
+
+func NewCompactSOT(m *SOT) *CompactSOT {
+	return &CompactSOT{
+		SenderSessionID: m.SenderSessionID,
+		RecverSessionID: m.RecverSessionID,
+		Sequence:        m.Sequence,
+		Transforms: functional.Filter(m.Transforms, func(t abyss.ObjectTransform) CompactObjectTransform {
+			return CompactObjectTransform{ID: t.ID, Transform: t.Transform}
+		}),
+	}
+}
+
+func (r *CompactSOT) TryParse() (*SOT, error) {
+	transforms := functional.Filter(r.Transforms, func(t CompactObjectTransform) abyss.ObjectTransform {
+		return abyss.ObjectTransform{ID: t.ID, Transform: t.Transform}
+	})
+	return &SOT{r.SenderSessionID, r.RecverSessionID, r.Sequence, transforms}, nil
+}
+
+type CompactMSG struct {
+	_               struct{} `cbor:",toarray"`
+	SenderSessionID uuid.UUID
+	RecverSessionID uuid.UUID
+	Topic           string
+	Payload         []byte
+}
+
+func NewCompactMSG(m *MSG) *CompactMSG {
+	return &CompactMSG{SenderSessionID: m.SenderSessionID, RecverSessionID: m.RecverSessionID, Topic: m.Topic, Payload: m.Payload}
+}
+
+func (r *CompactMSG) TryParse() (*MSG, error) {
+	return &MSG{r.SenderSessionID, r.RecverSessionID, r.Topic, r.Payload}, nil
+}
+
+type CompactOWR struct {
+	_               struct{} `cbor:",toarray"`
+	SenderSessionID uuid.UUID
+	RecverSessionID uuid.UUID
+	ObjectID        uuid.UUID
+	TimeStamp       int64
+}
+
+func NewCompactOWR(m *OWR) *CompactOWR {
+	return &CompactOWR{SenderSessionID: m.SenderSessionID, RecverSessionID: m.RecverSessionID, ObjectID: m.ObjectID, TimeStamp: m.TimeStamp.UnixMilli()}
+}
+
+func (r *CompactOWR) TryParse() (*OWR, error) {
+	return &OWR{r.SenderSessionID, r.RecverSessionID, r.ObjectID, time.UnixMilli(r.TimeStamp)}, nil
+}
+
+type CompactOHO struct {
+	_               struct{} `cbor:",toarray"`
+	SenderSessionID uuid.UUID
+	RecverSessionID uuid.UUID
+	Object          CompactObjectInfo
+	NewOwnerHash    string
+	Epoch           uint64
+	TimeStamp       int64
+}
+
+func NewCompactOHO(m *OHO) *CompactOHO {
+	o := m.Handover.Object
+	return &CompactOHO{
+		SenderSessionID: m.SenderSessionID,
+		RecverSessionID: m.RecverSessionID,
+		Object:          CompactObjectInfo{ID: o.ID, Address: o.Addr, Transform: o.Transform, Properties: newCompactObjectProperties(o.Properties)},
+		NewOwnerHash:    m.Handover.NewOwnerHash,
+		Epoch:           m.Handover.Epoch,
+		TimeStamp:       m.Handover.TimeStamp.UnixMilli(),
+	}
+}
+
+func (r *CompactOHO) TryParse() (*OHO, error) {
+	return &OHO{r.SenderSessionID, r.RecverSessionID, abyss.ObjectHandover{
+		Object:       abyss.ObjectInfo{ID: r.Object.ID, Addr: r.Object.Address, Transform: r.Object.Transform, Properties: parseCompactObjectProperties(r.Object.Properties)},
+		NewOwnerHash: r.NewOwnerHash,
+		Epoch:        r.Epoch,
+		TimeStamp:    time.UnixMilli(r.TimeStamp),
+	}}, nil
+}
+
+type CompactRSR struct {
+	_               struct{} `cbor:",toarray"`
+	SenderSessionID uuid.UUID
+	RecverSessionID uuid.UUID
+	Code            int
+	Message         string
+}
+
+func NewCompactRSR(m *RSR) *CompactRSR {
+	return &CompactRSR{SenderSessionID: m.SenderSessionID, RecverSessionID: m.RecverSessionID, Code: m.Code, Message: m.Message}
+}
+
+func (r *CompactRSR) TryParse() (*RSR, error) {
+	return &RSR{r.SenderSessionID, r.RecverSessionID, r.Code, r.Message}, nil
+}
+
+type CompactRAR struct {
+	_       struct{} `cbor:",toarray"`
+	Address []byte   //netip.AddrPort binary
+}
+
+func NewCompactRAR(m *RAR) *CompactRAR {
+	address, _ := m.Address.AddrPort().MarshalBinary()
+	return &CompactRAR{Address: address}
+}
+
+func (r *CompactRAR) TryParse() (*RAR, error) {
+	var addr_port netip.AddrPort
+	if err := addr_port.UnmarshalBinary(r.Address); err != nil {
+		return nil, err
+	}
+	return &RAR{net.UDPAddrFromAddrPort(addr_port)}, nil
+}
+
+type CompactHPR struct {
+	_        struct{} `cbor:",toarray"`
+	PeerHash string
+}
+
+func NewCompactHPR(m *HPR) *CompactHPR {
+	return &CompactHPR{PeerHash: m.PeerHash}
+}
+
+func (r *CompactHPR) TryParse() (*HPR, error) {
+	if r.PeerHash == "" {
+		return nil, errors.New("empty peer hash")
+	}
+	return &HPR{r.PeerHash}, nil
+}
+
+type CompactHPS struct {
+	_         struct{} `cbor:",toarray"`
+	PeerHash  string
+	Addresses [][]byte //netip.AddrPort binary
+	StartTime int64
+}
+
+func NewCompactHPS(m *HPS) *CompactHPS {
+	return &CompactHPS{
+		PeerHash: m.PeerHash,
+		Addresses: functional.Filter(m.Addresses, func(address *net.UDPAddr) []byte {
+			result, _ := address.AddrPort().MarshalBinary()
+			return result
+		}),
+		StartTime: m.StartTime.UnixMilli(),
+	}
+}
+
+func (r *CompactHPS) TryParse() (*HPS, error) {
+	if r.PeerHash == "" {
+		return nil, errors.New("empty peer hash")
+	}
+	addresses, _, err := functional.Filter_until_err(r.Addresses,
+		func(address_raw []byte) (*net.UDPAddr, error) {
+			var addr_port netip.AddrPort
+			err := addr_port.UnmarshalBinary(address_raw)
+			return net.UDPAddrFromAddrPort(addr_port), err
+		})
+	if err != nil {
+		return nil, err
+	}
+	return &HPS{r.PeerHash, addresses, time.UnixMilli(r.StartTime)}, nil
+}
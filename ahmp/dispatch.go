@@ -0,0 +1,57 @@
+package ahmp
+
+import (
+	abyss "github.com/MinwooWebeng/abyss_core/interfaces"
+)
+
+// ANDMessage is a message of a world session, which is handed to AND as is.
+// JN is not one; its path must be resolved to a local session first.
+type ANDMessage interface {
+	Dispatch(and abyss.INeighborDiscovery, peer abyss.IANDPeer) abyss.ANDERROR
+}
+
+func (m *JOK) Dispatch(and abyss.INeighborDiscovery, peer abyss.IANDPeer) abyss.ANDERROR {
+	return and.JOK(m.RecverSessionID, abyss.ANDPeerSession{Peer: peer, PeerSessionID: m.SenderSessionID}, m.TimeStamp, m.Text, m.Neighbors)
+}
+func (m *JDN) Dispatch(and abyss.INeighborDiscovery, peer abyss.IANDPeer) abyss.ANDERROR {
+	return and.JDN(m.RecverSessionID, peer, m.Code, m.Text)
+}
+func (m *JNI) Dispatch(and abyss.INeighborDiscovery, peer abyss.IANDPeer) abyss.ANDERROR {
+	return and.JNI(m.RecverSessionID, abyss.ANDPeerSession{Peer: peer, PeerSessionID: m.SenderSessionID}, m.Neighbor)
+}
+func (m *MEM) Dispatch(and abyss.INeighborDiscovery, peer abyss.IANDPeer) abyss.ANDERROR {
+	return and.MEM(m.RecverSessionID, abyss.ANDPeerSession{Peer: peer, PeerSessionID: m.SenderSessionID}, m.TimeStamp)
+}
+func (m *SJN) Dispatch(and abyss.INeighborDiscovery, peer abyss.IANDPeer) abyss.ANDERROR {
+	return and.SJN(m.RecverSessionID, abyss.ANDPeerSession{Peer: peer, PeerSessionID: m.SenderSessionID}, m.MemberInfos)
+}
+func (m *CRR) Dispatch(and abyss.INeighborDiscovery, peer abyss.IANDPeer) abyss.ANDERROR {
+	return and.CRR(m.RecverSessionID, abyss.ANDPeerSession{Peer: peer, PeerSessionID: m.SenderSessionID}, m.MemberInfos)
+}
+func (m *RST) Dispatch(and abyss.INeighborDiscovery, peer abyss.IANDPeer) abyss.ANDERROR {
+	return and.RST(m.RecverSessionID, abyss.ANDPeerSession{Peer: peer, PeerSessionID: m.SenderSessionID}, m.Message)
+}
+func (m *RSR) Dispatch(and abyss.INeighborDiscovery, peer abyss.IANDPeer) abyss.ANDERROR {
+	return and.RSR(m.RecverSessionID, abyss.ANDPeerSession{Peer: peer, PeerSessionID: m.SenderSessionID}, m.Code, m.Message)
+}
+func (m *SOA) Dispatch(and abyss.INeighborDiscovery, peer abyss.IANDPeer) abyss.ANDERROR {
+	return and.SOA(m.RecverSessionID, abyss.ANDPeerSession{Peer: peer, PeerSessionID: m.SenderSessionID}, m.Objects)
+}
+func (m *SOD) Dispatch(and abyss.INeighborDiscovery, peer abyss.IANDPeer) abyss.ANDERROR {
+	return and.SOD(m.RecverSessionID, abyss.ANDPeerSession{Peer: peer, PeerSessionID: m.SenderSessionID}, m.ObjectIDs)
+}
+func (m *SOU) Dispatch(and abyss.INeighborDiscovery, peer abyss.IANDPeer) abyss.ANDERROR {
+	return and.SOU(m.RecverSessionID, abyss.ANDPeerSession{Peer: peer, PeerSessionID: m.SenderSessionID}, m.Updates)
+}
+func (m *SOT) Dispatch(and abyss.INeighborDiscovery, peer abyss.IANDPeer) abyss.ANDERROR {
+	return and.SOT(m.RecverSessionID, abyss.ANDPeerSession{Peer: peer, PeerSessionID: m.SenderSessionID}, m.Transforms)
+}
+func (m *MSG) Dispatch(and abyss.INeighborDiscovery, peer abyss.IANDPeer) abyss.ANDERROR {
+	return and.MSG(m.RecverSessionID, abyss.ANDPeerSession{Peer: peer, PeerSessionID: m.SenderSessionID}, m.Topic, m.Payload)
+}
+func (m *OWR) Dispatch(and abyss.INeighborDiscovery, peer abyss.IANDPeer) abyss.ANDERROR {
+	return and.OWR(m.RecverSessionID, abyss.ANDPeerSession{Peer: peer, PeerSessionID: m.SenderSessionID}, m.ObjectID, m.TimeStamp)
+}
+func (m *OHO) Dispatch(and abyss.INeighborDiscovery, peer abyss.IANDPeer) abyss.ANDERROR {
+	return and.OHO(m.RecverSessionID, abyss.ANDPeerSession{Peer: peer, PeerSessionID: m.SenderSessionID}, m.Handover)
+}
@@ -1,6 +1,7 @@
 package ahmp
 
 import (
+	"net"
 	"time"
 
 	"github.com/google/uuid"
@@ -8,6 +9,12 @@ import (
 	abyss "github.com/MinwooWebeng/abyss_core/interfaces"
 )
 
+type Hello struct {
+	Version      int
+	MinVersion   int
+	Capabilities abyss.PeerCapability
+}
+
 type JN struct {
 	SenderSessionID uuid.UUID
 	Text            string
@@ -62,6 +69,73 @@ type SOD struct {
 	ObjectIDs       []uuid.UUID
 }
 
+// SOU (shared object update) carries partial updates of shared objects.
+type SOU struct {
+	SenderSessionID uuid.UUID
+	RecverSessionID uuid.UUID
+	Updates         []abyss.ObjectUpdate
+}
+
+// SOT (shared object transform) carries transform updates in a QUIC datagram, which may be lost or reordered.
+// Sequence increases with each update of the sender session; a transform older than the last one received is stale.
+type SOT struct {
+	SenderSessionID uuid.UUID
+	RecverSessionID uuid.UUID
+	Sequence        uint64
+	Transforms      []abyss.ObjectTransform
+}
+
+// MSG carries an application-defined message between world members.
+// the topic and payload are opaque to AND.
+type MSG struct {
+	SenderSessionID uuid.UUID
+	RecverSessionID uuid.UUID
+	Topic           string
+	Payload         []byte
+}
+
+// OWR (ownership request) asks the owner of an object to hand it over.
+type OWR struct {
+	SenderSessionID uuid.UUID
+	RecverSessionID uuid.UUID
+	ObjectID        uuid.UUID
+	TimeStamp       time.Time
+}
+
+// OHO (ownership handover) moves an object to a new owner. The owner sends it to every member.
+type OHO struct {
+	SenderSessionID uuid.UUID
+	RecverSessionID uuid.UUID
+	Handover        abyss.ObjectHandover
+}
+
+// RSR (reasoned reset) is a RST that carries the application's reason to decline the session.
+type RSR struct {
+	SenderSessionID uuid.UUID
+	RecverSessionID uuid.UUID
+	Code            int
+	Message         string
+}
+
+// RAR (reflexive address report) carries the address that the sender observes for the receiver.
+// it is consumed by the network service, and never reaches AND.
+type RAR struct {
+	Address *net.UDPAddr
+}
+
+// HPR (hole punch request) asks a mutual peer to coordinate hole punching with the peer.
+type HPR struct {
+	PeerHash string
+}
+
+// HPS (hole punch start) tells the peer's addresses as observed by the sender,
+// and when to dial them. the same start time is sent to the other side.
+type HPS struct {
+	PeerHash  string
+	Addresses []*net.UDPAddr
+	StartTime time.Time
+}
+
 type INVAL struct {
 	Err error
 }
@@ -2,12 +2,15 @@ package ahmp
 
 import (
 	"errors"
+	"net"
+	"net/netip"
 	"time"
 
 	"github.com/MinwooWebeng/abyss_core/aurl"
 	abyss "github.com/MinwooWebeng/abyss_core/interfaces"
 	"github.com/MinwooWebeng/abyss_core/tools/functional"
 
+	"github.com/fxamacker/cbor/v2"
 	"github.com/google/uuid"
 )
 
@@ -19,11 +22,27 @@ type RawSessionInfoForDiscovery struct {
 	HandshakeKeyCertificateDer []byte
 }
 
+func newRawSessionInfoForDiscovery(i abyss.ANDFullPeerSessionIdentity) RawSessionInfoForDiscovery {
+	return RawSessionInfoForDiscovery{
+		AURL:                       i.AURL.ToString(),
+		SessionID:                  i.SessionID.String(),
+		TimeStamp:                  i.TimeStamp.UnixMilli(),
+		RootCertificateDer:         i.RootCertificateDer,
+		HandshakeKeyCertificateDer: i.HandshakeKeyCertificateDer,
+	}
+}
+
 type RawSessionInfoForSJN struct {
 	PeerHash  string
 	SessionID string
 }
 
+func newRawSessionInfosForSJN(infos []abyss.ANDPeerSessionIdentity) []RawSessionInfoForSJN {
+	return functional.Filter(infos, func(i abyss.ANDPeerSessionIdentity) RawSessionInfoForSJN {
+		return RawSessionInfoForSJN{PeerHash: i.PeerHash, SessionID: i.SessionID.String()}
+	})
+}
+
 const (
 	JN_T int = iota
 	JOK_T
@@ -36,10 +55,58 @@ const (
 
 	SOA_T
 	SOD_T
+
+	RAR_T
+	HPR_T
+	HPS_T
+
+	SOT_T //QUIC datagram
+
+	MSG_T
+	SOU_T
+
+	OWR_T
+	OHO_T
+
+	RSR_T
 )
 
-// for debug
-var Msg_type_names = [...]string{"JN", "JOK", "JDN", "JNI", "MEM", "SJN", "CRR", "RST", "SOA", "SOD"}
+// RawFrame is the envelope of every AHMP message, on the stream and in datagrams.
+// The payload is the encoded Raw message of the type, so that a message is always written and read as a whole.
+type RawFrame struct {
+	Type    int
+	Payload []byte
+}
+
+func NewRawFrame(ahmp_type int, raw_message any) (*RawFrame, error) {
+	payload, err := cbor.Marshal(raw_message)
+	if err != nil {
+		return nil, err
+	}
+	return &RawFrame{ahmp_type, payload}, nil
+}
+
+// AHMP protocol version of this build, and the oldest version it can talk to.
+const AHMP_VERSION = 1
+const AHMP_MIN_VERSION = 1
+
+// RawHello is exchanged right after the handshake certificates, before any frame.
+type RawHello struct {
+	Version      int
+	MinVersion   int
+	Capabilities uint64
+}
+
+func (r *RawHello) TryParse() (*Hello, error) {
+	if r.Version < r.MinVersion {
+		return nil, errors.New("invalid version range")
+	}
+	return &Hello{
+		Version:      r.Version,
+		MinVersion:   r.MinVersion,
+		Capabilities: abyss.PeerCapability(r.Capabilities),
+	}, nil
+}
 
 type RawJN struct {
 	SenderSessionID string
@@ -55,6 +122,10 @@ func (r *RawJN) TryParse() (*JN, error) {
 	return &JN{ssid, r.Text, time.UnixMilli(r.TimeStamp)}, nil
 }
 
+func NewRawJN(m *JN) *RawJN {
+	return &RawJN{SenderSessionID: m.SenderSessionID.String(), Text: m.Text, TimeStamp: m.TimeStamp.UnixMilli()}
+}
+
 type RawJOK struct {
 	SenderSessionID string
 	RecverSessionID string
@@ -95,6 +166,16 @@ func (r *RawJOK) TryParse() (*JOK, error) {
 	return &JOK{ssid, rsid, time.UnixMilli(r.TimeStamp), neig, r.Text}, nil
 }
 
+func NewRawJOK(m *JOK) *RawJOK {
+	return &RawJOK{
+		SenderSessionID: m.SenderSessionID.String(),
+		RecverSessionID: m.RecverSessionID.String(),
+		TimeStamp:       m.TimeStamp.UnixMilli(),
+		Text:            m.Text,
+		Neighbors:       functional.Filter(m.Neighbors, newRawSessionInfoForDiscovery),
+	}
+}
+
 type RawJDN struct {
 	RecverSessionID string
 	Code            int
@@ -109,6 +190,10 @@ func (r *RawJDN) TryParse() (*JDN, error) {
 	return &JDN{rsid, r.Text, r.Code}, nil
 }
 
+func NewRawJDN(m *JDN) *RawJDN {
+	return &RawJDN{RecverSessionID: m.RecverSessionID.String(), Code: m.Code, Text: m.Text}
+}
+
 type RawJNI struct {
 	SenderSessionID string
 	RecverSessionID string
@@ -142,6 +227,14 @@ func (r *RawJNI) TryParse() (*JNI, error) {
 	}}, nil
 }
 
+func NewRawJNI(m *JNI) *RawJNI {
+	return &RawJNI{
+		SenderSessionID: m.SenderSessionID.String(),
+		RecverSessionID: m.RecverSessionID.String(),
+		Neighbor:        newRawSessionInfoForDiscovery(m.Neighbor),
+	}
+}
+
 type RawMEM struct {
 	SenderSessionID string
 	RecverSessionID string
@@ -160,6 +253,10 @@ func (r *RawMEM) TryParse() (*MEM, error) {
 	return &MEM{ssid, rsid, time.UnixMilli(r.TimeStamp)}, nil
 }
 
+func NewRawMEM(m *MEM) *RawMEM {
+	return &RawMEM{SenderSessionID: m.SenderSessionID.String(), RecverSessionID: m.RecverSessionID.String(), TimeStamp: m.TimeStamp.UnixMilli()}
+}
+
 type RawSJN struct {
 	SenderSessionID string
 	RecverSessionID string
@@ -189,6 +286,10 @@ func (r *RawSJN) TryParse() (*SJN, error) {
 	return &SJN{ssid, rsid, infos}, nil
 }
 
+func NewRawSJN(m *SJN) *RawSJN {
+	return &RawSJN{SenderSessionID: m.SenderSessionID.String(), RecverSessionID: m.RecverSessionID.String(), MemberInfos: newRawSessionInfosForSJN(m.MemberInfos)}
+}
+
 type RawCRR struct {
 	SenderSessionID string
 	RecverSessionID string
@@ -218,6 +319,10 @@ func (r *RawCRR) TryParse() (*CRR, error) {
 	return &CRR{ssid, rsid, infos}, nil
 }
 
+func NewRawCRR(m *CRR) *RawCRR {
+	return &RawCRR{SenderSessionID: m.SenderSessionID.String(), RecverSessionID: m.RecverSessionID.String(), MemberInfos: newRawSessionInfosForSJN(m.MemberInfos)}
+}
+
 type RawRST struct {
 	SenderSessionID string
 	RecverSessionID string
@@ -236,10 +341,15 @@ func (r *RawRST) TryParse() (*RST, error) {
 	return &RST{ssid, rsid, r.Message}, nil
 }
 
+func NewRawRST(m *RST) *RawRST {
+	return &RawRST{SenderSessionID: m.SenderSessionID.String(), RecverSessionID: m.RecverSessionID.String(), Message: m.Message}
+}
+
 type RawObjectInfo struct {
-	ID        string
-	Address   string
-	Transform [7]float32
+	ID         string
+	Address    string
+	Transform  [7]float32
+	Properties map[string]abyss.ObjectProperty `cbor:",omitempty"`
 }
 type RawSOA struct {
 	SenderSessionID string
@@ -260,9 +370,10 @@ func (r *RawSOA) TryParse() (*SOA, error) {
 		func(object_raw RawObjectInfo) (abyss.ObjectInfo, error) {
 			oid, err := uuid.Parse(object_raw.ID)
 			return abyss.ObjectInfo{
-				ID:        oid,
-				Addr:      object_raw.Address,
-				Transform: object_raw.Transform,
+				ID:         oid,
+				Addr:       object_raw.Address,
+				Transform:  object_raw.Transform,
+				Properties: object_raw.Properties,
 			}, err
 		})
 	if err != nil {
@@ -271,6 +382,16 @@ func (r *RawSOA) TryParse() (*SOA, error) {
 	return &SOA{ssid, rsid, objects}, nil
 }
 
+func NewRawSOA(m *SOA) *RawSOA {
+	return &RawSOA{
+		SenderSessionID: m.SenderSessionID.String(),
+		RecverSessionID: m.RecverSessionID.String(),
+		Objects: functional.Filter(m.Objects, func(o abyss.ObjectInfo) RawObjectInfo {
+			return RawObjectInfo{ID: o.ID.String(), Address: o.Addr, Transform: o.Transform, Properties: o.Properties}
+		}),
+	}
+}
+
 type RawSOD struct {
 	SenderSessionID string
 	RecverSessionID string
@@ -296,3 +417,293 @@ func (r *RawSOD) TryParse() (*SOD, error) {
 	}
 	return &SOD{ssid, rsid, oids}, nil
 }
+
+func NewRawSOD(m *SOD) *RawSOD {
+	return &RawSOD{
+		SenderSessionID: m.SenderSessionID.String(),
+		RecverSessionID: m.RecverSessionID.String(),
+		ObjectIDs:       functional.Filter(m.ObjectIDs, func(u uuid.UUID) string { return u.String() }),
+	}
+}
+
+type RawObjectUpdate struct {
+	ID         string
+	Address    *string                         `cbor:",omitempty"`
+	Transform  *[7]float32                     `cbor:",omitempty"`
+	Properties map[string]abyss.ObjectProperty `cbor:",omitempty"`
+}
+type RawSOU struct {
+	SenderSessionID string
+	RecverSessionID string
+	Updates         []RawObjectUpdate
+}
+
+func (r *RawSOU) TryParse() (*SOU, error) {
+	ssid, err := uuid.Parse(r.SenderSessionID)
+	if err != nil {
+		return nil, err
+	}
+	rsid, err := uuid.Parse(r.RecverSessionID)
+	if err != nil {
+		return nil, err
+	}
+	updates, _, err := functional.Filter_until_err(r.Updates,
+		func(update_raw RawObjectUpdate) (abyss.ObjectUpdate, error) {
+			oid, err := uuid.Parse(update_raw.ID)
+			return abyss.ObjectUpdate{
+				ID:         oid,
+				Addr:       update_raw.Address,
+				Transform:  update_raw.Transform,
+				Properties: update_raw.Properties,
+			}, err
+		})
+	if err != nil {
+		return nil, err
+	}
+	return &SOU{ssid, rsid, updates}, nil
+}
+
+func NewRawSOU(m *SOU) *RawSOU {
+	return &RawSOU{
+		SenderSessionID: m.SenderSessionID.String(),
+		RecverSessionID: m.RecverSessionID.String(),
+		Updates: functional.Filter(m.Updates, func(u abyss.ObjectUpdate) RawObjectUpdate {
+			return RawObjectUpdate{ID: u.ID.String(), Address: u.Addr, Transform: u.Transform, Properties: u.Properties}
+		}),
+	}
+}
+
+type RawObjectTransform struct {
+	ID        string
+	Transform [7]float32
+}
+type RawSOT struct {
+	SenderSessionID string
+	RecverSessionID string
+	Sequence        uint64
+	Transforms      []RawObjectTransform
+}
+
+func (r *RawSOT) TryParse() (*SOT, error) {
+	ssid, err := uuid.Parse(r.SenderSessionID)
+	if err != nil {
+		return nil, err
+	}
+	rsid, err := uuid.Parse(r.RecverSessionID)
+	if err != nil {
+		return nil, err
+	}
+	transforms, _, err := functional.Filter_until_err(r.Transforms,
+		func(transform_raw RawObjectTransform) (abyss.ObjectTransform, error) {
+			oid, err := uuid.Parse(transform_raw.ID)
+			return abyss.ObjectTransform{
+				ID:        oid,
+				Transform: transform_raw.Transform,
+			}, err
+		})
+	if err != nil {
+		return nil, err
+	}
+	return &SOT{ssid, rsid, r.Sequence, transforms}, nil
+}
+
+func NewRawSOT(m *SOT) *RawSOT {
+	return &RawSOT{
+		SenderSessionID: m.SenderSessionID.String(),
+		RecverSessionID: m.RecverSessionID.String(),
+		Sequence:        m.Sequence,
+		Transforms: functional.Filter(m.Transforms, func(t abyss.ObjectTransform) RawObjectTransform {
+			return RawObjectTransform{ID: t.ID.String(), Transform: t.Transform}
+		}),
+	}
+}
+
+type RawMSG struct {
+	SenderSessionID string
+	RecverSessionID string
+	Topic           string
+	Payload         []byte
+}
+
+func (r *RawMSG) TryParse() (*MSG, error) {
+	ssid, err := uuid.Parse(r.SenderSessionID)
+	if err != nil {
+		return nil, err
+	}
+	rsid, err := uuid.Parse(r.RecverSessionID)
+	if err != nil {
+		return nil, err
+	}
+	return &MSG{ssid, rsid, r.Topic, r.Payload}, nil
+}
+
+func NewRawMSG(m *MSG) *RawMSG {
+	return &RawMSG{
+		SenderSessionID: m.SenderSessionID.String(),
+		RecverSessionID: m.RecverSessionID.String(),
+		Topic:           m.Topic,
+		Payload:         m.Payload,
+	}
+}
+
+type RawOWR struct {
+	SenderSessionID string
+	RecverSessionID string
+	ObjectID        string
+	TimeStamp       int64
+}
+
+func (r *RawOWR) TryParse() (*OWR, error) {
+	ssid, err := uuid.Parse(r.SenderSessionID)
+	if err != nil {
+		return nil, err
+	}
+	rsid, err := uuid.Parse(r.RecverSessionID)
+	if err != nil {
+		return nil, err
+	}
+	oid, err := uuid.Parse(r.ObjectID)
+	if err != nil {
+		return nil, err
+	}
+	return &OWR{ssid, rsid, oid, time.UnixMilli(r.TimeStamp)}, nil
+}
+
+func NewRawOWR(m *OWR) *RawOWR {
+	return &RawOWR{
+		SenderSessionID: m.SenderSessionID.String(),
+		RecverSessionID: m.RecverSessionID.String(),
+		ObjectID:        m.ObjectID.String(),
+		TimeStamp:       m.TimeStamp.UnixMilli(),
+	}
+}
+
+type RawOHO struct {
+	SenderSessionID string
+	RecverSessionID string
+	Object          RawObjectInfo
+	NewOwnerHash    string
+	Epoch           uint64
+	TimeStamp       int64
+}
+
+func (r *RawOHO) TryParse() (*OHO, error) {
+	ssid, err := uuid.Parse(r.SenderSessionID)
+	if err != nil {
+		return nil, err
+	}
+	rsid, err := uuid.Parse(r.RecverSessionID)
+	if err != nil {
+		return nil, err
+	}
+	oid, err := uuid.Parse(r.Object.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &OHO{ssid, rsid, abyss.ObjectHandover{
+		Object: abyss.ObjectInfo{
+			ID:         oid,
+			Addr:       r.Object.Address,
+			Transform:  r.Object.Transform,
+			Properties: r.Object.Properties,
+		},
+		NewOwnerHash: r.NewOwnerHash,
+		Epoch:        r.Epoch,
+		TimeStamp:    time.UnixMilli(r.TimeStamp),
+	}}, nil
+}
+
+func NewRawOHO(m *OHO) *RawOHO {
+	o := m.Handover.Object
+	return &RawOHO{
+		SenderSessionID: m.SenderSessionID.String(),
+		RecverSessionID: m.RecverSessionID.String(),
+		Object:          RawObjectInfo{ID: o.ID.String(), Address: o.Addr, Transform: o.Transform, Properties: o.Properties},
+		NewOwnerHash:    m.Handover.NewOwnerHash,
+		Epoch:           m.Handover.Epoch,
+		TimeStamp:       m.Handover.TimeStamp.UnixMilli(),
+	}
+}
+
+type RawRSR struct {
+	SenderSessionID string
+	RecverSessionID string
+	Code            int
+	Message         string
+}
+
+func (r *RawRSR) TryParse() (*RSR, error) {
+	ssid, err := uuid.Parse(r.SenderSessionID)
+	if err != nil {
+		return nil, err
+	}
+	rsid, err := uuid.Parse(r.RecverSessionID)
+	if err != nil {
+		return nil, err
+	}
+	return &RSR{ssid, rsid, r.Code, r.Message}, nil
+}
+
+func NewRawRSR(m *RSR) *RawRSR {
+	return &RawRSR{SenderSessionID: m.SenderSessionID.String(), RecverSessionID: m.RecverSessionID.String(), Code: m.Code, Message: m.Message}
+}
+
+type RawRAR struct {
+	Address string
+}
+
+func (r *RawRAR) TryParse() (*RAR, error) {
+	addr_port, err := netip.ParseAddrPort(r.Address)
+	if err != nil {
+		return nil, err
+	}
+	return &RAR{net.UDPAddrFromAddrPort(addr_port)}, nil
+}
+
+func NewRawRAR(m *RAR) *RawRAR {
+	return &RawRAR{Address: m.Address.String()}
+}
+
+type RawHPR struct {
+	PeerHash string
+}
+
+func (r *RawHPR) TryParse() (*HPR, error) {
+	if r.PeerHash == "" {
+		return nil, errors.New("empty peer hash")
+	}
+	return &HPR{r.PeerHash}, nil
+}
+
+func NewRawHPR(m *HPR) *RawHPR {
+	return &RawHPR{PeerHash: m.PeerHash}
+}
+
+type RawHPS struct {
+	PeerHash  string
+	Addresses []string
+	StartTime int64
+}
+
+func (r *RawHPS) TryParse() (*HPS, error) {
+	if r.PeerHash == "" {
+		return nil, errors.New("empty peer hash")
+	}
+	addresses, _, err := functional.Filter_until_err(r.Addresses,
+		func(address_raw string) (*net.UDPAddr, error) {
+			addr_port, err := netip.ParseAddrPort(address_raw)
+			return net.UDPAddrFromAddrPort(addr_port), err
+		})
+	if err != nil {
+		return nil, err
+	}
+	return &HPS{r.PeerHash, addresses, time.UnixMilli(r.StartTime)}, nil
+}
+
+func NewRawHPS(m *HPS) *RawHPS {
+	return &RawHPS{
+		PeerHash:  m.PeerHash,
+		Addresses: functional.Filter(m.Addresses, func(address *net.UDPAddr) string { return address.String() }),
+		StartTime: m.StartTime.UnixMilli(),
+	}
+}
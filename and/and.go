@@ -1,6 +1,7 @@
 package and
 
 import (
+	"strconv"
 	"sync"
 	"time"
 
@@ -295,6 +296,22 @@ func (a *AND) RST(local_session_id uuid.UUID, peer_session abyss.ANDPeerSession,
 	}
 	return 0
 }
+func (a *AND) RSR(local_session_id uuid.UUID, peer_session abyss.ANDPeerSession, code int, message string) abyss.ANDERROR {
+	a.api_mtx.Lock()
+	defer a.api_mtx.Unlock()
+
+	watchdog.Info("RSR: " + strconv.Itoa(code) + " " + message)
+
+	world, ok := a.worlds[local_session_id]
+	if !ok {
+		a.stat.B(46)
+		return 0
+	}
+	a.stat.B(47)
+
+	world.RSR(peer_session, code, message)
+	return 0
+}
 
 func (a *AND) SOA(local_session_id uuid.UUID, peer_session abyss.ANDPeerSession, objects []abyss.ObjectInfo) abyss.ANDERROR {
 	a.api_mtx.Lock()
@@ -325,6 +342,94 @@ func (a *AND) SOD(local_session_id uuid.UUID, peer_session abyss.ANDPeerSession,
 	return 0
 }
 
+func (a *AND) SOT(local_session_id uuid.UUID, peer_session abyss.ANDPeerSession, transforms []abyss.ObjectTransform) abyss.ANDERROR {
+	a.api_mtx.Lock()
+	defer a.api_mtx.Unlock()
+
+	world, ok := a.worlds[local_session_id]
+	if !ok {
+		a.stat.B(36)
+		return 0
+	}
+	a.stat.B(37)
+
+	world.SOT(peer_session, transforms)
+	return 0
+}
+
+func (a *AND) SOU(local_session_id uuid.UUID, peer_session abyss.ANDPeerSession, updates []abyss.ObjectUpdate) abyss.ANDERROR {
+	a.api_mtx.Lock()
+	defer a.api_mtx.Unlock()
+
+	world, ok := a.worlds[local_session_id]
+	if !ok {
+		a.stat.B(40)
+		return 0
+	}
+	a.stat.B(41)
+
+	world.SOU(peer_session, updates)
+	return 0
+}
+
+func (a *AND) MSG(local_session_id uuid.UUID, peer_session abyss.ANDPeerSession, topic string, payload []byte) abyss.ANDERROR {
+	a.api_mtx.Lock()
+	defer a.api_mtx.Unlock()
+
+	world, ok := a.worlds[local_session_id]
+	if !ok {
+		a.stat.B(38)
+		return 0
+	}
+	a.stat.B(39)
+
+	world.MSG(peer_session, topic, payload)
+	return 0
+}
+
+func (a *AND) OWR(local_session_id uuid.UUID, peer_session abyss.ANDPeerSession, object_id uuid.UUID, timestamp time.Time) abyss.ANDERROR {
+	a.api_mtx.Lock()
+	defer a.api_mtx.Unlock()
+
+	world, ok := a.worlds[local_session_id]
+	if !ok {
+		a.stat.B(42)
+		return 0
+	}
+	a.stat.B(43)
+
+	world.OWR(peer_session, object_id, timestamp)
+	return 0
+}
+func (a *AND) OHO(local_session_id uuid.UUID, peer_session abyss.ANDPeerSession, handover abyss.ObjectHandover) abyss.ANDERROR {
+	a.api_mtx.Lock()
+	defer a.api_mtx.Unlock()
+
+	world, ok := a.worlds[local_session_id]
+	if !ok {
+		a.stat.B(44)
+		return 0
+	}
+	a.stat.B(45)
+
+	world.OHO(peer_session, handover)
+	return 0
+}
+
+// AcceptHolePunch reports whether the peers have sessions in a common world.
+// it implements abyss.IHolePunchAccepter.
+func (a *AND) AcceptHolePunch(requester_hash string, target_hash string) bool {
+	a.api_mtx.Lock()
+	defer a.api_mtx.Unlock()
+
+	for _, world := range a.worlds {
+		if world.HasSession(requester_hash) && world.HasSession(target_hash) {
+			return true
+		}
+	}
+	return false
+}
+
 func (a *AND) Statistics() string {
 	return a.stat.String()
 }
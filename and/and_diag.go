@@ -14,6 +14,7 @@ type ANDStatistics struct {
 	SJN_TX int
 	CRR_TX int
 	RST_TX int
+	RSR_TX int
 	SOA_TX int
 	SOD_TX int
 
@@ -25,11 +26,12 @@ type ANDStatistics struct {
 	SJN_RX int
 	CRR_RX int
 	RST_RX int
+	RSR_RX int
 	SOA_RX int
 	SOD_RX int
 
-	_b [36]int
-	_w [85]int
+	_b [48]int
+	_w [116]int
 }
 
 func (s *ANDStatistics) B(i int) {
@@ -67,7 +69,7 @@ func __tdn(i int) string {
 
 func (s *ANDStatistics) String() string {
 	var sb strings.Builder
-	sb.WriteString(" JN JOK JDN JNI MEM SJN CRR RST SOA SOD\n")
+	sb.WriteString(" JN JOK JDN JNI MEM SJN CRR RST RSR SOA SOD\n")
 	sb.WriteString(__tdn(s.JN_TX))
 	sb.WriteString(__tdn(s.JOK_TX))
 	sb.WriteString(__tdn(s.JDN_TX))
@@ -76,6 +78,7 @@ func (s *ANDStatistics) String() string {
 	sb.WriteString(__tdn(s.SJN_TX))
 	sb.WriteString(__tdn(s.CRR_TX))
 	sb.WriteString(__tdn(s.RST_TX))
+	sb.WriteString(__tdn(s.RSR_TX))
 	sb.WriteString(__tdn(s.SOA_TX))
 	sb.WriteString(__tdn(s.SOD_TX))
 	sb.WriteString("\n")
@@ -87,6 +90,7 @@ func (s *ANDStatistics) String() string {
 	sb.WriteString(__tdn(s.SJN_RX))
 	sb.WriteString(__tdn(s.CRR_RX))
 	sb.WriteString(__tdn(s.RST_RX))
+	sb.WriteString(__tdn(s.RSR_RX))
 	sb.WriteString(__tdn(s.SOA_RX))
 	sb.WriteString(__tdn(s.SOD_RX))
 	sb.WriteString("\n")
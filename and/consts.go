@@ -1,5 +1,7 @@
 package and
 
+import "time"
+
 const (
 	JNC_REDUNDANT = 110
 
@@ -31,3 +33,7 @@ const (
 	JNM_RESET          = "Reset Requested"
 	JNM_REJECTED       = "Join Rejected"
 )
+
+// a disconnected member that does not reconnect in time is removed from the world.
+// a disconnected join target is bounded by the join context instead.
+const RECONNECT_DEADLINE = 30 * time.Second
@@ -30,6 +30,8 @@ type ANDPeerSessionState struct {
 	state int
 	sjnp  bool //is sjn suppressed
 	sjnc  int  //sjn receive count
+
+	dc_since time.Time //WS_DC_JNI: removed after RECONNECT_DEADLINE
 }
 
 func NewANDPeerSessionState(peer abyss.IANDPeer, session_id uuid.UUID, timestamp time.Time, state int) *ANDPeerSessionState {
@@ -44,6 +46,7 @@ func NewANDPeerSessionState(peer abyss.IANDPeer, session_id uuid.UUID, timestamp
 		state,
 		false,
 		0,
+		time.Now(),
 	}
 }
 
@@ -228,6 +231,20 @@ func (w *ANDWorld) IsProperMemberOrReset(info *ANDPeerSessionState, peer_session
 	return false
 }
 
+// HasSession reports whether the peer is a member, or is becoming one.
+func (w *ANDWorld) HasSession(peer_hash string) bool {
+	info, ok := w.peers[peer_hash]
+	if !ok {
+		return false
+	}
+	switch info.state {
+	case WS_RMEM_NJNI, WS_JNI, WS_RMEM, WS_TMEM, WS_MEM:
+		return true
+	default:
+		return false
+	}
+}
+
 func (w *ANDWorld) PeerConnected(peer abyss.IANDPeer) {
 	info, ok := w.peers[peer.IDHash()]
 	if ok { // known peer
@@ -327,6 +344,11 @@ func (w *ANDWorld) JOK(peer_session abyss.ANDPeerSession, timestamp time.Time, w
 		LocalSessionID: w.lsid,
 		Text:           world_url,
 	}
+	w.ech <- abyss.NeighborEvent{
+		Type:           abyss.ANDTimerRequest,
+		LocalSessionID: w.lsid,
+		Value:          500,
+	}
 	w.ech <- abyss.NeighborEvent{
 		Type:           abyss.ANDSessionRequest,
 		LocalSessionID: w.lsid,
@@ -399,8 +421,9 @@ func (w *ANDWorld) JNI_MEMS(sender_id string, mem_info abyss.ANDFullPeerSessionI
 			},
 		}
 		w.ech <- abyss.NeighborEvent{
-			Type:   abyss.ANDConnectRequest,
-			Object: mem_info.AURL,
+			Type:           abyss.ANDConnectRequest,
+			ANDPeerSession: w.peers[sender_id].ANDPeerSession, //introducer, connected to both sides
+			Object:         mem_info.AURL,
 		}
 		return
 	}
@@ -415,6 +438,7 @@ func (w *ANDWorld) JNI_MEMS(sender_id string, mem_info abyss.ANDFullPeerSessionI
 			info.PeerSessionID = mem_info.SessionID
 			info.TimeStamp = mem_info.TimeStamp
 			info.state = WS_DC_JNI
+			info.dc_since = time.Now()
 		}
 		//previously, tried connecting. may need to refresh connection trials
 	case WS_CC:
@@ -611,7 +635,11 @@ func (w *ANDWorld) CRR_MEMS(origin *ANDPeerSessionState, mem_info abyss.ANDPeerS
 func (w *ANDWorld) SOA(peer_session abyss.ANDPeerSession, objects []abyss.ObjectInfo) {
 	w.o.stat.SOA_RX++
 
-	info := w.peers[peer_session.Peer.IDHash()]
+	info, ok := w.peers[peer_session.Peer.IDHash()]
+	if !ok { //object messages are sent at lower priority, and may arrive after the peer left.
+		w.o.stat.W(90)
+		return
+	}
 	if info.PeerSessionID != peer_session.PeerSessionID {
 		w.o.stat.W(48)
 
@@ -636,7 +664,11 @@ func (w *ANDWorld) SOA(peer_session abyss.ANDPeerSession, objects []abyss.Object
 func (w *ANDWorld) SOD(peer_session abyss.ANDPeerSession, objectIDs []uuid.UUID) {
 	w.o.stat.SOD_RX++
 
-	info := w.peers[peer_session.Peer.IDHash()]
+	info, ok := w.peers[peer_session.Peer.IDHash()]
+	if !ok { //object messages are sent at lower priority, and may arrive after the peer left.
+		w.o.stat.W(91)
+		return
+	}
 	if info.PeerSessionID != peer_session.PeerSessionID {
 		w.o.stat.W(51)
 
@@ -658,12 +690,186 @@ func (w *ANDWorld) SOD(peer_session abyss.ANDPeerSession, objectIDs []uuid.UUID)
 		w.o.stat.W(53)
 	}
 }
+func (w *ANDWorld) SOU(peer_session abyss.ANDPeerSession, updates []abyss.ObjectUpdate) {
+
+	info, ok := w.peers[peer_session.Peer.IDHash()]
+	if !ok { //object messages are sent at lower priority, and may arrive after the peer left.
+		w.o.stat.W(96)
+		return
+	}
+	if info.PeerSessionID != peer_session.PeerSessionID {
+		w.o.stat.W(97)
+
+		w.o.stat.RST_TX++
+		peer_session.Peer.TrySendRST(w.lsid, peer_session.PeerSessionID, "SOU::sessionID mismatch")
+		return
+	}
+	switch info.state {
+	case WS_MEM:
+		w.o.stat.W(98)
+
+		w.ech <- abyss.NeighborEvent{
+			Type:           abyss.ANDObjectUpdate,
+			LocalSessionID: w.lsid,
+			ANDPeerSession: peer_session,
+			Object:         updates,
+		}
+	default:
+		w.o.stat.W(99)
+	}
+}
+func (w *ANDWorld) SOT(peer_session abyss.ANDPeerSession, transforms []abyss.ObjectTransform) {
+	//SOT is unreliable, and may arrive after the session is reset. mismatches are silently dropped.
+	info, ok := w.peers[peer_session.Peer.IDHash()]
+	if !ok {
+		w.o.stat.W(86)
+		return
+	}
+	if info.PeerSessionID != peer_session.PeerSessionID {
+		w.o.stat.W(87)
+		return
+	}
+	switch info.state {
+	case WS_MEM:
+		w.o.stat.W(88)
+
+		w.ech <- abyss.NeighborEvent{
+			Type:           abyss.ANDObjectTransform,
+			LocalSessionID: w.lsid,
+			ANDPeerSession: peer_session,
+			Object:         transforms,
+		}
+	default:
+		w.o.stat.W(89)
+	}
+}
+func (w *ANDWorld) MSG(peer_session abyss.ANDPeerSession, topic string, payload []byte) {
+
+	info, ok := w.peers[peer_session.Peer.IDHash()]
+	if !ok {
+		w.o.stat.W(92)
+		return
+	}
+	if info.PeerSessionID != peer_session.PeerSessionID {
+		w.o.stat.W(93)
+
+		w.o.stat.RST_TX++
+		peer_session.Peer.TrySendRST(w.lsid, peer_session.PeerSessionID, "MSG::sessionID mismatch")
+		return
+	}
+	switch info.state {
+	case WS_MEM:
+		w.o.stat.W(94)
+
+		w.ech <- abyss.NeighborEvent{
+			Type:           abyss.ANDMemberMessage,
+			LocalSessionID: w.lsid,
+			ANDPeerSession: peer_session,
+			Text:           topic,
+			Object:         payload,
+		}
+	default:
+		w.o.stat.W(95)
+	}
+}
+func (w *ANDWorld) OWR(peer_session abyss.ANDPeerSession, object_id uuid.UUID, timestamp time.Time) {
+	info, ok := w.peers[peer_session.Peer.IDHash()]
+	if !ok {
+		w.o.stat.W(100)
+		return
+	}
+	if info.PeerSessionID != peer_session.PeerSessionID {
+		w.o.stat.W(101)
+
+		w.o.stat.RST_TX++
+		peer_session.Peer.TrySendRST(w.lsid, peer_session.PeerSessionID, "OWR::sessionID mismatch")
+		return
+	}
+	switch info.state {
+	case WS_MEM:
+		w.o.stat.W(102)
+
+		w.ech <- abyss.NeighborEvent{
+			Type:           abyss.ANDOwnershipRequest,
+			LocalSessionID: w.lsid,
+			ANDPeerSession: peer_session,
+			Object:         abyss.ObjectOwnershipRequest{ObjectID: object_id, TimeStamp: timestamp},
+		}
+	default:
+		w.o.stat.W(103)
+	}
+}
+func (w *ANDWorld) OHO(peer_session abyss.ANDPeerSession, handover abyss.ObjectHandover) {
+	info, ok := w.peers[peer_session.Peer.IDHash()]
+	if !ok {
+		w.o.stat.W(104)
+		return
+	}
+	if info.PeerSessionID != peer_session.PeerSessionID {
+		w.o.stat.W(105)
+
+		w.o.stat.RST_TX++
+		peer_session.Peer.TrySendRST(w.lsid, peer_session.PeerSessionID, "OHO::sessionID mismatch")
+		return
+	}
+	switch info.state {
+	case WS_MEM:
+		w.o.stat.W(106)
+
+		w.ech <- abyss.NeighborEvent{
+			Type:           abyss.ANDOwnershipHandover,
+			LocalSessionID: w.lsid,
+			ANDPeerSession: peer_session,
+			Object:         handover,
+		}
+	default:
+		w.o.stat.W(107)
+	}
+}
 func (w *ANDWorld) RST(peer_session abyss.ANDPeerSession) {
 	w.o.stat.RST_RX++
 
-	info := w.peers[peer_session.Peer.IDHash()]
+	info, ok := w.peers[peer_session.Peer.IDHash()]
+	if !ok {
+		w.o.stat.W(85)
+		return
+	}
 	w.ClearStates(info.Peer.IDHash(), info, "RST received")
 }
+func (w *ANDWorld) RSR(peer_session abyss.ANDPeerSession, code int, message string) {
+	w.o.stat.RSR_RX++
+
+	info, ok := w.peers[peer_session.Peer.IDHash()]
+	if !ok {
+		w.o.stat.W(110)
+		return
+	}
+	if info.PeerSessionID != peer_session.PeerSessionID { //stale reason
+		w.o.stat.W(111)
+		return
+	}
+
+	//the peer already cleared its states; no RST is sent back.
+	switch info.state {
+	case WS_MEM:
+		w.o.stat.W(112)
+
+		w.ech <- abyss.NeighborEvent{
+			Type:           abyss.ANDSessionClose,
+			LocalSessionID: w.lsid,
+			ANDPeerSession: info.ANDPeerSession,
+			Text:           message,
+			Value:          code,
+		}
+		info.Clear()
+	case WS_RMEM_NJNI, WS_JNI, WS_RMEM, WS_TMEM:
+		w.o.stat.W(113)
+
+		info.Clear()
+	default:
+		w.ClearStates(info.Peer.IDHash(), info, "RSR received")
+	}
+}
 
 func (w *ANDWorld) AcceptSession(peer_session abyss.ANDPeerSession) {
 	info, ok := w.peers[peer_session.Peer.IDHash()]
@@ -767,13 +973,46 @@ func (w *ANDWorld) DeclineSession(peer_session abyss.ANDPeerSession, code int, m
 	if info.PeerSessionID == peer_session.PeerSessionID {
 		w.o.stat.W(72)
 
-		//TODO: proper JDN
-		w.ClearStates(peer_session.Peer.IDHash(), info, "application-DeclineSession called")
+		//the application's reason reaches the peer.
+		switch info.state {
+		case WS_JN:
+			w.o.stat.W(108)
+
+			w.o.stat.JDN_TX++
+			info.Peer.TrySendJDN(info.PeerSessionID, code, message)
+			info.Clear()
+		case WS_MEM:
+			w.ech <- abyss.NeighborEvent{
+				Type:           abyss.ANDSessionClose,
+				LocalSessionID: w.lsid,
+				ANDPeerSession: info.ANDPeerSession,
+			}
+			fallthrough
+		case WS_RMEM_NJNI, WS_JNI, WS_RMEM, WS_TMEM:
+			w.o.stat.W(109)
+
+			w.o.stat.RSR_TX++
+			info.Peer.TrySendRSR(w.lsid, info.PeerSessionID, code, message)
+			info.Clear()
+		default:
+			w.ClearStates(peer_session.Peer.IDHash(), info, "application-DeclineSession called")
+		}
 	}
 	w.o.stat.W(73)
 
 }
 func (w *ANDWorld) TimerExpire() {
+	for peer_id, info := range w.peers {
+		if info.state != WS_DC_JNI ||
+			time.Since(info.dc_since) < RECONNECT_DEADLINE {
+			continue
+		}
+		w.o.stat.W(115)
+
+		//the member leave was raised on disconnection. it is not reconnected anymore.
+		delete(w.peers, peer_id)
+	}
+
 	sjn_mem := make([]abyss.ANDPeerSessionIdentity, 0)
 	for _, info := range w.peers {
 		if info.state != WS_MEM ||
@@ -815,13 +1054,54 @@ func (w *ANDWorld) TimerExpire() {
 	}
 }
 
+// the peer is already disconnected; no message is sent.
 func (w *ANDWorld) RemovePeer(peer abyss.IANDPeer) {
-	w.ClearStates(peer.IDHash(), w.peers[peer.IDHash()], "")
+	info, ok := w.peers[peer.IDHash()]
+	if !ok {
+		w.o.stat.W(82)
+		return
+	}
+	//the join target and the members are kept disconnected, as the peer may reconnect.
+	switch info.state {
+	case WS_JT:
+		w.o.stat.W(83)
+
+		//JN is sent again on reconnection. the join fails when the world is closed.
+		info.Peer = nil
+		info.state = WS_DC_JT
+		return
+	case WS_MEM:
+		w.o.stat.W(84)
+
+		w.ech <- abyss.NeighborEvent{
+			Type:           abyss.ANDSessionClose,
+			LocalSessionID: w.lsid,
+			ANDPeerSession: info.ANDPeerSession,
+		}
+
+		//on reconnection, the session is requested again, as if JNI was received.
+		//the entry is removed by TimerExpire after RECONNECT_DEADLINE.
+		info.Peer = nil
+		info.state = WS_DC_JNI
+		info.sjnp = false
+		info.sjnc = 0
+		info.dc_since = time.Now()
+		return
+	}
 	delete(w.peers, peer.IDHash())
 }
 func (w *ANDWorld) Close() {
 	for _, info := range w.peers {
 		switch info.state {
+		case WS_DC_JT:
+			w.o.stat.W(114)
+
+			w.ech <- abyss.NeighborEvent{
+				Type:           abyss.ANDJoinFail,
+				LocalSessionID: w.lsid,
+				Text:           JNM_CANCELED,
+				Value:          JNC_CANCELED,
+			}
 		case WS_CC:
 			//nothing
 		case WS_JT:
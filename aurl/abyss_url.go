@@ -120,11 +120,29 @@ func tryParseAbyss(input string) (*AURL, error) {
 			portPart = parts[1]
 		}
 
+		//IPv6 link-local addresses may have zone: [fe80::1%eth0]:port
+		var zonePart string
+		if zoneIdx := strings.Index(ipPart, "%"); zoneIdx != -1 {
+			zonePart = ipPart[zoneIdx+1:]
+			ipPart = ipPart[:zoneIdx]
+			if zonePart == "" {
+				continue
+			}
+		}
+
 		port, err := strconv.Atoi(portPart)
-		if net.ParseIP(ipPart) != nil && err == nil {
+		ip := net.ParseIP(ipPart)
+		if ip != nil && err == nil {
+			if ip4 := ip.To4(); ip4 != nil {
+				if zonePart != "" {
+					continue
+				}
+				ip = ip4
+			}
 			result.Addresses = append(result.Addresses, &net.UDPAddr{
-				IP:   net.ParseIP(ipPart),
+				IP:   ip,
 				Port: port,
+				Zone: zonePart,
 			})
 		}
 	}
@@ -30,6 +30,7 @@ func TestAurl(t *testing.T) {
 	ParsePrintAURL("abyss:abc")
 	ParsePrintAURL("abyss:hhh:1.2.3.4:1605/")
 	ParsePrintAURL("abyss:hhh:127.0.0.1:100/")
+	ParsePrintAURL("abyss:I3hN8bQ4kWzYx7VtRm2PcFjL9sGdAe5Zu6:[fd00::2]:1605|[fe80::fc:ff:fe00:1%eth0]:1605|[::1]:1605|127.0.0.1:1605/")
 
 	ParsePrintAURL("abyss:hhh:www.google.com:100/")
 	ParsePrintAURL("http:abc")
@@ -40,4 +41,6 @@ func TestAurl(t *testing.T) {
 	ParsePrintAURL("abyss:hhh:1.2.3.4.5:90/")
 	ParsePrintAURL("abyss:hhh:|/")
 	ParsePrintAURL("abyss:hhh::1605/")
+	ParsePrintAURL("abyss:I3hN8bQ4kWzYx7VtRm2PcFjL9sGdAe5Zu6:[fe80::1%]:1605/")
+	ParsePrintAURL("abyss:I3hN8bQ4kWzYx7VtRm2PcFjL9sGdAe5Zu6:1.2.3.4%eth0:1605/")
 }
@@ -29,6 +29,17 @@ type WorldCreationEvent struct {
 	world   *World
 }
 
+// JoinError is returned from JoinWorld when the join fails.
+// Code is one of the JNC_ codes in package and, or the code the join target's application declined with.
+type JoinError struct {
+	Code    int
+	Message string
+}
+
+func (e *JoinError) Error() string {
+	return e.Message
+}
+
 type AbyssHost struct {
 	ctx         context.Context //set at ListenAndServe(ctx)
 	listen_done chan bool
@@ -45,9 +56,16 @@ type AbyssHost struct {
 
 	join_queue map[uuid.UUID]chan *WorldCreationEvent //forwarding of AND join result event.
 	join_q_mtx *sync.Mutex
+
+	message_handlers     map[int]func(peer abyss.IANDPeer, message any) //application AHMP types
+	message_handlers_mtx *sync.Mutex
 }
 
 func NewAbyssHost(netServ abyss.INetworkService, nda abyss.INeighborDiscovery, path_resolver abyss.IPathResolver) *AbyssHost {
+	if hole_punch_accepter, ok := nda.(abyss.IHolePunchAccepter); ok {
+		//hole punches are coordinated only between members of a common world.
+		netServ.HandleHolePunch(hole_punch_accepter)
+	}
 	return &AbyssHost{
 		listen_done:                make(chan bool, 1),
 		event_done:                 make(chan bool, 1),
@@ -63,6 +81,9 @@ func NewAbyssHost(netServ abyss.INetworkService, nda abyss.INeighborDiscovery, p
 		worlds_mtx: new(sync.Mutex),
 		join_queue: make(map[uuid.UUID]chan *WorldCreationEvent),
 		join_q_mtx: new(sync.Mutex),
+
+		message_handlers:     make(map[int]func(peer abyss.IANDPeer, message any)),
+		message_handlers_mtx: new(sync.Mutex),
 	}
 }
 
@@ -146,7 +167,7 @@ func (h *AbyssHost) JoinWorld(ctx context.Context, abyss_url *aurl.AURL) (abyss.
 	ctx_done_waiter <- true
 
 	if !join_res.ok {
-		return nil, errors.New(join_res.message)
+		return nil, &JoinError{Code: join_res.code, Message: join_res.message}
 	}
 
 	return join_res.world, nil
@@ -188,13 +209,26 @@ func (h *AbyssHost) ListenAndServe(ctx context.Context) {
 }
 
 func (h *AbyssHost) GetStatistics() string {
-	return h.neighborDiscoveryAlgorithm.Statistics()
+	return h.NetworkService.Statistics() + h.neighborDiscoveryAlgorithm.Statistics()
+}
+
+// peerServeSlot is one connection lifetime of a peer, from PeerConnected to PeerClose.
+type peerServeSlot struct {
+	close_ch chan bool
+	done_ch  chan bool
 }
 
 func (h *AbyssHost) listenLoop() {
 	var wg sync.WaitGroup
 
 	accept_ch := h.NetworkService.GetAbyssPeerChannel()
+	close_ch := h.NetworkService.GetAbyssPeerCloseChannel()
+
+	//Connection and close notifications come from different channels, so a close may be received before its connection.
+	//Each close is paired with the oldest unclosed connection of the peer, and slots of a peer are served one after another.
+	open_slots := make(map[string][]*peerServeSlot)
+	last_slot := make(map[string]*peerServeSlot)
+	early_close := make(map[string]int)
 	for {
 		select {
 		case <-h.ctx.Done():
@@ -203,20 +237,49 @@ func (h *AbyssHost) listenLoop() {
 			return
 		case peer := <-accept_ch:
 			//watchdog.Info("new peer: " + peer.IDHash())
+			peer_hash := peer.IDHash()
+			if early_close[peer_hash] > 0 {
+				early_close[peer_hash]--
+				continue
+			}
+
+			slot := &peerServeSlot{
+				close_ch: make(chan bool, 1),
+				done_ch:  make(chan bool),
+			}
+			prev_slot := last_slot[peer_hash]
+			last_slot[peer_hash] = slot
+			open_slots[peer_hash] = append(open_slots[peer_hash], slot)
+
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				h.serveLoop(peer)
+				defer close(slot.done_ch)
+				if prev_slot != nil {
+					<-prev_slot.done_ch
+				}
+				h.serveLoop(peer, slot.close_ch)
 			}()
+		case peer := <-close_ch:
+			peer_hash := peer.IDHash()
+			slots := open_slots[peer_hash]
+			if len(slots) == 0 {
+				early_close[peer_hash]++
+				continue
+			}
+
+			slots[0].close_ch <- true
+			if len(slots) == 1 {
+				delete(open_slots, peer_hash)
+			} else {
+				open_slots[peer_hash] = slots[1:]
+			}
 		}
 	}
 }
 
-func (h *AbyssHost) serveLoop(peer abyss.IANDPeer) {
+func (h *AbyssHost) serveLoop(peer abyss.IANDPeer, close_ch chan bool) {
 	//fmt.Println(h.NetworkService.LocalIdentity().IDHash()[:6] + " connected " + peer.IDHash()[:6] + ": " + peer.AURL().Addresses[0].String())
-	if !peer.IsConnected() {
-		return
-	}
 	retval := h.neighborDiscoveryAlgorithm.PeerConnected(peer)
 	if retval != 0 {
 		return
@@ -227,9 +290,13 @@ func (h *AbyssHost) serveLoop(peer abyss.IANDPeer) {
 		select {
 		case <-h.ctx.Done():
 			return
+		case <-close_ch:
+			h.neighborDiscoveryAlgorithm.PeerClose(peer)
+			return
 		case <-peer.Context().Done():
 			//peer expired
-			fmt.Println("peer expired: " + peer.Error().Error())
+			watchdog.Info("peer expired: " + peer.IDHash())
+			h.neighborDiscoveryAlgorithm.PeerClose(peer)
 			return
 		case message_any := <-ahmp_channel:
 			var and_result abyss.ANDERROR
@@ -242,29 +309,13 @@ func (h *AbyssHost) serveLoop(peer abyss.IANDPeer) {
 					continue // TODO: respond with proper error code
 				}
 				and_result = h.neighborDiscoveryAlgorithm.JN(local_session_id, abyss.ANDPeerSession{Peer: peer, PeerSessionID: message.SenderSessionID}, message.TimeStamp)
-			case *ahmp.JOK:
-				and_result = h.neighborDiscoveryAlgorithm.JOK(message.RecverSessionID, abyss.ANDPeerSession{Peer: peer, PeerSessionID: message.SenderSessionID}, message.TimeStamp, message.Text, message.Neighbors)
-			case *ahmp.JDN:
-				and_result = h.neighborDiscoveryAlgorithm.JDN(message.RecverSessionID, peer, message.Code, message.Text)
-			case *ahmp.JNI:
-				and_result = h.neighborDiscoveryAlgorithm.JNI(message.RecverSessionID, abyss.ANDPeerSession{Peer: peer, PeerSessionID: message.SenderSessionID}, message.Neighbor)
-			case *ahmp.MEM:
-				and_result = h.neighborDiscoveryAlgorithm.MEM(message.RecverSessionID, abyss.ANDPeerSession{Peer: peer, PeerSessionID: message.SenderSessionID}, message.TimeStamp)
-			case *ahmp.SJN:
-				and_result = h.neighborDiscoveryAlgorithm.SJN(message.RecverSessionID, abyss.ANDPeerSession{Peer: peer, PeerSessionID: message.SenderSessionID}, message.MemberInfos)
-			case *ahmp.CRR:
-				and_result = h.neighborDiscoveryAlgorithm.CRR(message.RecverSessionID, abyss.ANDPeerSession{Peer: peer, PeerSessionID: message.SenderSessionID}, message.MemberInfos)
-			case *ahmp.RST:
-				and_result = h.neighborDiscoveryAlgorithm.RST(message.RecverSessionID, abyss.ANDPeerSession{Peer: peer, PeerSessionID: message.SenderSessionID}, message.Message)
-			case *ahmp.SOA:
-				and_result = h.neighborDiscoveryAlgorithm.SOA(message.RecverSessionID, abyss.ANDPeerSession{Peer: peer, PeerSessionID: message.SenderSessionID}, message.Objects)
-			case *ahmp.SOD:
-				and_result = h.neighborDiscoveryAlgorithm.SOD(message.RecverSessionID, abyss.ANDPeerSession{Peer: peer, PeerSessionID: message.SenderSessionID}, message.ObjectIDs)
+			case ahmp.ANDMessage:
+				and_result = message.Dispatch(h.neighborDiscoveryAlgorithm, peer)
 			case *ahmp.INVAL:
 				//parsing fail
 				watchdog.Error(message.Err)
 			default:
-				panic("unknown ahmp message type: This is internal implementation missing. MUST be resolved.")
+				h.handleMessage(peer, message_any)
 			}
 
 			switch and_result {
@@ -331,13 +382,13 @@ func (h *AbyssHost) eventLoop() {
 				}
 
 				e.Peer.Deactivate()
-				world.RaisePeerLeave(e.Peer.IDHash())
+				world.RaisePeerLeave(e.Peer.IDHash(), e.Value, e.Text)
 			case abyss.ANDJoinSuccess:
 				//fmt.Println(h.NetworkService.LocalIdentity().IDHash()[:6] + " event ::: abyss.ANDJoinSuccess")
 
 				var new_world *World
 				if e.Type == abyss.ANDJoinSuccess {
-					new_world = NewWorld(h.neighborDiscoveryAlgorithm, e.LocalSessionID, e.Text)
+					new_world = NewWorld(h.neighborDiscoveryAlgorithm, h.NetworkService.LocalIdentity().IDHash(), e.LocalSessionID, e.Text)
 					h.worlds_mtx.Lock()
 					h.worlds[e.LocalSessionID] = new_world
 					h.worlds_mtx.Unlock()
@@ -388,7 +439,12 @@ func (h *AbyssHost) eventLoop() {
 				}
 			case abyss.ANDConnectRequest:
 				//fmt.Println(h.NetworkService.LocalIdentity().IDHash()[:6] + " event ::: abyss.ANDConnectRequest")
-				h.NetworkService.ConnectAbyssAsync(e.Object.(*aurl.AURL))
+				target := e.Object.(*aurl.AURL)
+				h.NetworkService.ConnectAbyssAsync(target)
+				if e.Peer != nil {
+					//the introducer coordinates hole punching, in case NAT blocks the direct dial.
+					h.NetworkService.RequestHolePunch(e.Peer.IDHash(), target.Hash)
+				}
 			case abyss.ANDTimerRequest:
 				//fmt.Println(h.NetworkService.LocalIdentity().IDHash()[:6] + " event ::: abyss.ANDTimerRequest: " + strconv.Itoa(e.Value))
 				target_local_session := e.LocalSessionID
@@ -405,6 +461,9 @@ func (h *AbyssHost) eventLoop() {
 			case abyss.ANDPeerRegister:
 				//fmt.Println(h.NetworkService.LocalIdentity().IDHash()[:6] + " event ::: abyss.ANDPeerRegister")
 				certificates := e.Object.(*abyss.PeerCertificates)
+				if certificates.RootCertDer == nil { //omitted by a compact JOK or JNI; sent earlier on the same connection
+					continue
+				}
 				h.NetworkService.AppendKnownPeerDer(certificates.RootCertDer, certificates.HandshakeKeyCertDer)
 
 			case abyss.ANDObjectAppend:
@@ -433,6 +492,65 @@ func (h *AbyssHost) eventLoop() {
 				e.Peer.Renew()
 				world.RaiseObjectDelete(e.Peer.IDHash(), e.Object.([]uuid.UUID))
 
+			case abyss.ANDObjectTransform:
+				h.worlds_mtx.Lock()
+				world, ok := h.worlds[e.LocalSessionID]
+				h.worlds_mtx.Unlock()
+
+				if !ok { //transforms are unreliable. a late one is dropped.
+					break
+				}
+
+				e.Peer.Renew()
+				world.RaiseObjectTransform(e.Peer.IDHash(), e.Object.([]abyss.ObjectTransform))
+
+			case abyss.ANDObjectUpdate:
+				h.worlds_mtx.Lock()
+				world, ok := h.worlds[e.LocalSessionID]
+				h.worlds_mtx.Unlock()
+
+				if !ok {
+					panic("world not found")
+				}
+
+				e.Peer.Renew()
+				world.RaiseObjectUpdate(e.Peer.IDHash(), e.Object.([]abyss.ObjectUpdate))
+
+			case abyss.ANDMemberMessage:
+				h.worlds_mtx.Lock()
+				world, ok := h.worlds[e.LocalSessionID]
+				h.worlds_mtx.Unlock()
+
+				if !ok {
+					panic("world not found")
+				}
+
+				e.Peer.Renew()
+				world.RaiseMemberMessage(e.Peer.IDHash(), e.Text, e.Object.([]byte))
+
+			case abyss.ANDOwnershipRequest:
+				h.worlds_mtx.Lock()
+				world, ok := h.worlds[e.LocalSessionID]
+				h.worlds_mtx.Unlock()
+
+				if !ok {
+					panic("world not found")
+				}
+
+				world.RaiseOwnershipRequest(e.Peer.IDHash(), e.Object.(abyss.ObjectOwnershipRequest))
+
+			case abyss.ANDOwnershipHandover:
+				h.worlds_mtx.Lock()
+				world, ok := h.worlds[e.LocalSessionID]
+				h.worlds_mtx.Unlock()
+
+				if !ok {
+					panic("world not found")
+				}
+
+				e.Peer.Renew()
+				world.RaiseOwnershipHandover(e.Peer.IDHash(), e.Object.(abyss.ObjectHandover))
+
 			case abyss.ANDNeighborEventDebug:
 				//fmt.Println(h.NetworkService.LocalIdentity().IDHash()[:6] + " event ::: abyss.ANDNeighborEventDebug")
 				fmt.Println(time.Now().Format("00:00:00.000") + " " + e.Text)
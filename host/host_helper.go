@@ -10,12 +10,19 @@ import (
 )
 
 func NewBetaAbyssHost(ctx context.Context, root_private_key abyss_net.PrivateKey, abyst_server *http3.Server) (*AbyssHost, *SimplePathResolver, error) {
+	return NewBetaAbyssHostWithConfig(ctx, root_private_key, abyst_server, &abyss_net.BetaNetServiceConfig{})
+}
+
+func NewBetaAbyssHostWithConfig(ctx context.Context, root_private_key abyss_net.PrivateKey, abyst_server *http3.Server, config *abyss_net.BetaNetServiceConfig) (*AbyssHost, *SimplePathResolver, error) {
 	address_selector, err := abyss_net.NewBetaAddressSelector()
 	if err != nil {
 		return nil, nil, err
 	}
 	path_resolver := NewSimplePathResolver()
-	netserv, _ := abyss_net.NewBetaNetService(ctx, root_private_key, address_selector, abyst_server)
+	netserv, err := abyss_net.NewBetaNetServiceWithConfig(ctx, root_private_key, address_selector, abyst_server, config)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	return NewAbyssHost(netserv, abyss_and.NewAND(netserv.LocalAURL().Hash), path_resolver), path_resolver, nil
 }
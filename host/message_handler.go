@@ -0,0 +1,36 @@
+package host
+
+import (
+	"reflect"
+
+	"github.com/MinwooWebeng/abyss_core/ahmp"
+	abyss "github.com/MinwooWebeng/abyss_core/interfaces"
+	"github.com/MinwooWebeng/abyss_core/watchdog"
+)
+
+// HandleMessage sets the handler of an application AHMP type, which must be registered with ahmp.Register.
+// The handler runs in the serving goroutine of the peer, and must not block.
+func (h *AbyssHost) HandleMessage(ahmp_type int, handler func(peer abyss.IANDPeer, message any)) {
+	h.message_handlers_mtx.Lock()
+	defer h.message_handlers_mtx.Unlock()
+
+	h.message_handlers[ahmp_type] = handler
+}
+
+// handleMessage passes a message that is not for AND to its handler.
+func (h *AbyssHost) handleMessage(peer abyss.IANDPeer, message any) {
+	codec, ok := ahmp.LookupMessage(message)
+	if !ok {
+		watchdog.Warn("unknown AHMP message " + reflect.TypeOf(message).String())
+		return
+	}
+
+	h.message_handlers_mtx.Lock()
+	handler, ok := h.message_handlers[codec.Type]
+	h.message_handlers_mtx.Unlock()
+	if !ok {
+		watchdog.Warn("unhandled AHMP message " + codec.Name)
+		return
+	}
+	handler(peer, message)
+}
@@ -19,8 +19,27 @@ func (p *WorldMember) SessionID() uuid.UUID {
 	return p.peerSession.PeerSessionID
 }
 func (p *WorldMember) AppendObjects(objects []abyss.ObjectInfo) bool {
+	p.world.publish(objects)
 	return p.peerSession.Peer.TrySendSOA(p.world.session_id, p.peerSession.PeerSessionID, objects)
 }
 func (p *WorldMember) DeleteObjects(objectIDs []uuid.UUID) bool {
+	p.world.unpublish(objectIDs)
 	return p.peerSession.Peer.TrySendSOD(p.world.session_id, p.peerSession.PeerSessionID, objectIDs)
 }
+func (p *WorldMember) UpdateObjects(updates []abyss.ObjectUpdate) bool {
+	p.world.publishUpdates(updates)
+	return p.peerSession.Peer.TrySendSOU(p.world.session_id, p.peerSession.PeerSessionID, updates)
+}
+func (p *WorldMember) UpdateTransforms(transforms []abyss.ObjectTransform) bool {
+	if !p.peerSession.Peer.Capabilities().Has(abyss.CAP_DATAGRAM) {
+		return false
+	}
+	p.world.publishTransforms(transforms)
+	return p.peerSession.Peer.TrySendSOT(p.world.session_id, p.peerSession.PeerSessionID, p.world.transform_seq.Add(1), transforms)
+}
+func (p *WorldMember) SendMessage(topic string, payload []byte) bool {
+	if !p.peerSession.Peer.Capabilities().Has(abyss.CAP_CUSTOM_MESSAGE) {
+		return false
+	}
+	return p.peerSession.Peer.TrySendMSG(p.world.session_id, p.peerSession.PeerSessionID, topic, payload)
+}
@@ -1,24 +1,49 @@
 package host
 
 import (
+	"bytes"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+
 	abyss "github.com/MinwooWebeng/abyss_core/interfaces"
 
 	"github.com/google/uuid"
 )
 
 type World struct {
-	origin       abyss.INeighborDiscovery
-	session_id   uuid.UUID
-	url          string
-	eventChannel chan any
+	origin        abyss.INeighborDiscovery
+	local_hash    string
+	session_id    uuid.UUID
+	url           string
+	eventChannel  chan any
+	transform_seq atomic.Uint64 //SOT sequence
+
+	members     map[string]*WorldMember //ready members, by peer hash
+	members_mtx *sync.Mutex
+
+	objects *objectTable
+
+	published        map[uuid.UUID]abyss.ObjectInfo   //objects that the local host shared, replayed to new members
+	pending_requests map[uuid.UUID][]ownershipRequest //ownership requests of published objects
+	published_mtx    *sync.Mutex
 }
 
-func NewWorld(origin abyss.INeighborDiscovery, session_id uuid.UUID, url string) *World {
+func NewWorld(origin abyss.INeighborDiscovery, local_hash string, session_id uuid.UUID, url string) *World {
 	return &World{
 		origin:       origin,
+		local_hash:   local_hash,
 		session_id:   session_id,
 		url:          url,
 		eventChannel: make(chan any, 4096),
+		members:      make(map[string]*WorldMember),
+		members_mtx:  new(sync.Mutex),
+		objects:      newObjectTable(),
+
+		published:        make(map[uuid.UUID]abyss.ObjectInfo),
+		pending_requests: make(map[uuid.UUID][]ownershipRequest),
+		published_mtx:    new(sync.Mutex),
 	}
 }
 
@@ -28,6 +53,97 @@ func (w *World) GetEventChannel() chan any {
 	return w.eventChannel
 }
 
+// Members returns a snapshot of the ready members, ordered by hash.
+// a member is ready from its EWorldMemberReady until its EWorldMemberLeave is raised.
+func (w *World) Members() []abyss.IWorldMember {
+	members := w.readyMembers()
+	result := make([]abyss.IWorldMember, len(members))
+	for i, member := range members {
+		result[i] = member
+	}
+	return result
+}
+func (w *World) readyMembers() []*WorldMember {
+	w.members_mtx.Lock()
+	defer w.members_mtx.Unlock()
+
+	result := make([]*WorldMember, 0, len(w.members))
+	for _, hash := range slices.Sorted(maps.Keys(w.members)) {
+		result = append(result, w.members[hash])
+	}
+	return result
+}
+func (w *World) Member(peer_hash string) (abyss.IWorldMember, bool) {
+	w.members_mtx.Lock()
+	defer w.members_mtx.Unlock()
+
+	member, ok := w.members[peer_hash]
+	if !ok {
+		return nil, false
+	}
+	return member, true
+}
+
+// Broadcast sends the message to every ready member that accepts custom messages.
+func (w *World) Broadcast(topic string, payload []byte) {
+	for _, member := range w.Members() {
+		member.SendMessage(topic, payload)
+	}
+}
+
+func (w *World) publish(objects []abyss.ObjectInfo) {
+	w.published_mtx.Lock()
+	defer w.published_mtx.Unlock()
+
+	for _, object := range objects {
+		if w.objects.notOwner(w.local_hash, object.ID) { //handed over
+			continue
+		}
+		w.published[object.ID] = object
+	}
+}
+func (w *World) unpublish(objectIDs []uuid.UUID) {
+	w.published_mtx.Lock()
+	defer w.published_mtx.Unlock()
+
+	for _, id := range objectIDs {
+		delete(w.published, id)
+		delete(w.pending_requests, id)
+	}
+}
+func (w *World) publishTransforms(transforms []abyss.ObjectTransform) {
+	w.published_mtx.Lock()
+	defer w.published_mtx.Unlock()
+
+	for _, transform := range transforms {
+		if object, ok := w.published[transform.ID]; ok {
+			object.Transform = transform.Transform
+			w.published[transform.ID] = object
+		}
+	}
+}
+func (w *World) publishUpdates(updates []abyss.ObjectUpdate) {
+	w.published_mtx.Lock()
+	defer w.published_mtx.Unlock()
+
+	for _, update := range updates {
+		if object, ok := w.published[update.ID]; ok {
+			applyObjectUpdate(&object, update)
+			w.published[update.ID] = object
+		}
+	}
+}
+func (w *World) publishedObjects() []abyss.ObjectInfo {
+	w.published_mtx.Lock()
+	defer w.published_mtx.Unlock()
+
+	result := make([]abyss.ObjectInfo, 0, len(w.published))
+	for _, id := range slices.SortedFunc(maps.Keys(w.published), func(a, b uuid.UUID) int { return bytes.Compare(a[:], b[:]) }) {
+		result = append(result, w.published[id])
+	}
+	return result
+}
+
 func (w *World) RaisePeerRequest(peer_session abyss.ANDPeerSession) {
 	w.eventChannel <- abyss.EWorldMemberRequest{
 		MemberHash: peer_session.Peer.IDHash(),
@@ -40,29 +156,84 @@ func (w *World) RaisePeerRequest(peer_session abyss.ANDPeerSession) {
 	}
 }
 func (w *World) RaisePeerReady(peer_session abyss.ANDPeerSession) {
+	member := &WorldMember{
+		world:       w,
+		hash:        peer_session.Peer.IDHash(),
+		peerSession: peer_session,
+	}
+	w.members_mtx.Lock()
+	w.members[member.hash] = member
+	w.members_mtx.Unlock()
+
+	//a new member receives the published objects before the app sees it.
+	if objects := w.publishedObjects(); len(objects) != 0 {
+		peer_session.Peer.TrySendSOA(w.session_id, peer_session.PeerSessionID, objects)
+		w.replayEpochs(peer_session, objects)
+	}
+
 	w.eventChannel <- abyss.EWorldMemberReady{
-		Member: &WorldMember{
-			world:       w,
-			hash:        peer_session.Peer.IDHash(),
-			peerSession: peer_session,
-		},
+		Member: member,
 	}
 }
 func (w *World) RaiseObjectAppend(peer_hash string, objects []abyss.ObjectInfo) {
+	if objects = w.objects.append(peer_hash, objects); objects == nil {
+		return
+	}
 	w.eventChannel <- abyss.EMemberObjectAppend{
 		PeerHash: peer_hash,
 		Objects:  objects,
 	}
 }
 func (w *World) RaiseObjectDelete(peer_hash string, objectIDs []uuid.UUID) {
+	if objectIDs = w.objects.delete(peer_hash, objectIDs); objectIDs == nil {
+		return
+	}
 	w.eventChannel <- abyss.EMemberObjectDelete{
 		PeerHash:  peer_hash,
 		ObjectIDs: objectIDs,
 	}
 }
-func (w *World) RaisePeerLeave(peer_hash string) {
+func (w *World) RaiseObjectTransform(peer_hash string, transforms []abyss.ObjectTransform) {
+	if transforms = w.objects.transform(peer_hash, transforms); transforms == nil {
+		return
+	}
+	w.eventChannel <- abyss.EMemberObjectTransform{
+		PeerHash:   peer_hash,
+		Transforms: transforms,
+	}
+}
+func (w *World) RaiseObjectUpdate(peer_hash string, updates []abyss.ObjectUpdate) {
+	if updates = w.objects.update(peer_hash, updates); len(updates) == 0 {
+		return
+	}
+	w.eventChannel <- abyss.EMemberObjectUpdate{
+		PeerHash: peer_hash,
+		Updates:  updates,
+	}
+}
+func (w *World) RaiseMemberMessage(peer_hash string, topic string, payload []byte) {
+	w.eventChannel <- abyss.EWorldMemberMessage{
+		PeerHash: peer_hash,
+		Topic:    topic,
+		Payload:  payload,
+	}
+}
+func (w *World) RaisePeerLeave(peer_hash string, code int, message string) {
+	w.members_mtx.Lock()
+	delete(w.members, peer_hash)
+	w.members_mtx.Unlock()
+
+	//the objects of a leaving member are deleted before its leave.
+	if objectIDs := w.objects.deleteAll(peer_hash); len(objectIDs) != 0 {
+		w.eventChannel <- abyss.EMemberObjectDelete{
+			PeerHash:  peer_hash,
+			ObjectIDs: objectIDs,
+		}
+	}
 	w.eventChannel <- abyss.EWorldMemberLeave{
 		PeerHash: peer_hash,
+		Code:     code,
+		Message:  message,
 	}
 }
 func (w *World) RaiseWorldTerminate() {
@@ -0,0 +1,283 @@
+package host
+
+import (
+	"bytes"
+	"cmp"
+	"maps"
+	"slices"
+	"sync"
+
+	abyss "github.com/MinwooWebeng/abyss_core/interfaces"
+
+	"github.com/google/uuid"
+)
+
+// objectTable is the replicated table of the objects that members shared, by owner hash and object ID.
+// every change is forwarded to the subscribers in the order it is applied.
+type objectTable struct {
+	objects     map[string]map[uuid.UUID]abyss.ObjectInfo
+	owners      map[uuid.UUID]ownership //objects that were handed over, including local ones
+	deferred    map[uuid.UUID][]deferredHandover
+	subscribers map[*objectSubscriber]bool
+	overflows   int //subscribers that were dropped because they did not keep up
+	mtx         *sync.Mutex
+}
+
+// events that an object subscriber can fall behind before it is dropped.
+const OBJECT_SUBSCRIBER_BUFFER_SIZE = 4096
+
+type objectSubscriber struct {
+	ch chan any
+}
+
+func newObjectTable() *objectTable {
+	return &objectTable{
+		objects:     make(map[string]map[uuid.UUID]abyss.ObjectInfo),
+		owners:      make(map[uuid.UUID]ownership),
+		deferred:    make(map[uuid.UUID][]deferredHandover),
+		subscribers: make(map[*objectSubscriber]bool),
+		mtx:         new(sync.Mutex),
+	}
+}
+
+func sortMemberObjects(objects []abyss.MemberObject) {
+	slices.SortFunc(objects, func(a, b abyss.MemberObject) int {
+		return cmp.Or(cmp.Compare(a.OwnerHash, b.OwnerHash), bytes.Compare(a.ID[:], b.ID[:]))
+	})
+}
+
+// _snapshot must be called with mtx held.
+func (t *objectTable) _snapshot() []abyss.MemberObject {
+	result := make([]abyss.MemberObject, 0)
+	for owner_hash, owned := range t.objects {
+		for _, object := range owned {
+			result = append(result, abyss.MemberObject{OwnerHash: owner_hash, ObjectInfo: object})
+		}
+	}
+	sortMemberObjects(result)
+	return result
+}
+
+// _notOwner must be called with mtx held.
+// an object that was handed over only accepts messages from its current owner.
+func (t *objectTable) _notOwner(peer_hash string, object_id uuid.UUID) bool {
+	owner, ok := t.owners[object_id]
+	return ok && owner.hash != peer_hash
+}
+
+func (t *objectTable) notOwner(peer_hash string, object_id uuid.UUID) bool {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	return t._notOwner(peer_hash, object_id)
+}
+
+// _publish must be called with mtx held, so that subscribers see the changes in order.
+// it never blocks. a subscriber whose channel is full would miss the event, so it is dropped instead,
+// and its channel is closed.
+func (t *objectTable) _publish(event any) {
+	for subscriber := range t.subscribers {
+		select {
+		case subscriber.ch <- event:
+		default:
+			delete(t.subscribers, subscriber)
+			close(subscriber.ch)
+			t.overflows++
+		}
+	}
+}
+
+// append registers the objects, and returns the ones that were accepted.
+func (t *objectTable) append(peer_hash string, objects []abyss.ObjectInfo) []abyss.ObjectInfo {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	objects = slices.DeleteFunc(slices.Clone(objects), func(o abyss.ObjectInfo) bool { return t._notOwner(peer_hash, o.ID) })
+	if len(objects) == 0 {
+		return nil
+	}
+	owned, ok := t.objects[peer_hash]
+	if !ok {
+		owned = make(map[uuid.UUID]abyss.ObjectInfo)
+		t.objects[peer_hash] = owned
+	}
+	for _, object := range objects {
+		owned[object.ID] = object
+	}
+	t._publish(abyss.EMemberObjectAppend{PeerHash: peer_hash, Objects: objects})
+	return objects
+}
+
+func (t *objectTable) delete(peer_hash string, objectIDs []uuid.UUID) []uuid.UUID {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	objectIDs = slices.DeleteFunc(slices.Clone(objectIDs), func(id uuid.UUID) bool { return t._notOwner(peer_hash, id) })
+	if len(objectIDs) == 0 {
+		return nil
+	}
+	if owned, ok := t.objects[peer_hash]; ok {
+		for _, id := range objectIDs {
+			delete(owned, id)
+		}
+		if len(owned) == 0 {
+			delete(t.objects, peer_hash)
+		}
+	}
+	t._forget(objectIDs)
+	t._publish(abyss.EMemberObjectDelete{PeerHash: peer_hash, ObjectIDs: objectIDs})
+	return objectIDs
+}
+
+// _forget must be called with mtx held.
+// the ownership of a deleted object is not kept, as no one can hand it over anymore.
+func (t *objectTable) _forget(objectIDs []uuid.UUID) {
+	for _, id := range objectIDs {
+		delete(t.owners, id)
+		delete(t.deferred, id)
+	}
+}
+
+func (t *objectTable) transform(peer_hash string, transforms []abyss.ObjectTransform) []abyss.ObjectTransform {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	transforms = slices.DeleteFunc(slices.Clone(transforms), func(o abyss.ObjectTransform) bool { return t._notOwner(peer_hash, o.ID) })
+	if len(transforms) == 0 {
+		return nil
+	}
+	owned := t.objects[peer_hash]
+	for _, transform := range transforms {
+		if object, ok := owned[transform.ID]; ok { //a transform of an unknown object is only forwarded.
+			object.Transform = transform.Transform
+			owned[transform.ID] = object
+		}
+	}
+	t._publish(abyss.EMemberObjectTransform{PeerHash: peer_hash, Transforms: transforms})
+	return transforms
+}
+
+// applyObjectUpdate applies the update to the object, and returns the part of it that changed the object.
+// the properties map is copied before it is changed, as snapshots share it.
+func applyObjectUpdate(object *abyss.ObjectInfo, update abyss.ObjectUpdate) (abyss.ObjectUpdate, bool) {
+	applied := abyss.ObjectUpdate{ID: update.ID}
+	if update.Addr != nil {
+		object.Addr = *update.Addr
+		applied.Addr = update.Addr
+	}
+	if update.Transform != nil {
+		object.Transform = *update.Transform
+		applied.Transform = update.Transform
+	}
+	for key, property := range update.Properties {
+		if current, ok := object.Properties[key]; ok && current.Version >= property.Version { //stale
+			continue
+		}
+		if applied.Properties == nil {
+			applied.Properties = make(map[string]abyss.ObjectProperty)
+			object.Properties = maps.Clone(object.Properties)
+			if object.Properties == nil {
+				object.Properties = make(map[string]abyss.ObjectProperty)
+			}
+		}
+		object.Properties[key] = property
+		applied.Properties[key] = property
+	}
+	return applied, applied.Addr != nil || applied.Transform != nil || applied.Properties != nil
+}
+
+// update applies the updates of known objects, and returns the changes.
+func (t *objectTable) update(peer_hash string, updates []abyss.ObjectUpdate) []abyss.ObjectUpdate {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	owned := t.objects[peer_hash]
+	result := make([]abyss.ObjectUpdate, 0, len(updates))
+	for _, update := range updates {
+		object, ok := owned[update.ID]
+		if !ok { //the update of an unknown object is dropped.
+			continue
+		}
+		if applied, changed := applyObjectUpdate(&object, update); changed {
+			owned[update.ID] = object
+			result = append(result, applied)
+		}
+	}
+	if len(result) != 0 {
+		t._publish(abyss.EMemberObjectUpdate{PeerHash: peer_hash, Updates: result})
+	}
+	return result
+}
+
+// deleteAll removes every object of the member, and returns their IDs.
+func (t *objectTable) deleteAll(peer_hash string) []uuid.UUID {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	owned, ok := t.objects[peer_hash]
+	if !ok {
+		return nil
+	}
+	delete(t.objects, peer_hash)
+
+	objectIDs := slices.SortedFunc(maps.Keys(owned), func(a, b uuid.UUID) int { return bytes.Compare(a[:], b[:]) })
+	t._forget(objectIDs)
+	t._publish(abyss.EMemberObjectDelete{PeerHash: peer_hash, ObjectIDs: objectIDs})
+	return objectIDs
+}
+
+// Objects returns a snapshot of all shared objects, ordered by owner hash and object ID.
+func (w *World) Objects() []abyss.MemberObject {
+	w.objects.mtx.Lock()
+	defer w.objects.mtx.Unlock()
+
+	return w.objects._snapshot()
+}
+
+// MemberObjects returns the objects that the member shared.
+func (w *World) MemberObjects(peer_hash string) []abyss.ObjectInfo {
+	w.objects.mtx.Lock()
+	defer w.objects.mtx.Unlock()
+
+	result := make([]abyss.ObjectInfo, 0, len(w.objects.objects[peer_hash]))
+	for _, object := range w.objects.objects[peer_hash] {
+		result = append(result, object)
+	}
+	slices.SortFunc(result, func(a, b abyss.ObjectInfo) int { return bytes.Compare(a.ID[:], b.ID[:]) })
+	return result
+}
+
+func (w *World) Object(peer_hash string, object_id uuid.UUID) (abyss.ObjectInfo, bool) {
+	w.objects.mtx.Lock()
+	defer w.objects.mtx.Unlock()
+
+	object, ok := w.objects.objects[peer_hash][object_id]
+	return object, ok
+}
+
+// SubscribeObjects returns a snapshot of all shared objects, and a channel of the object events that follow it.
+// if the subscriber falls OBJECT_SUBSCRIBER_BUFFER_SIZE events behind, the channel is closed,
+// and it must subscribe again for a new snapshot.
+func (w *World) SubscribeObjects() ([]abyss.MemberObject, <-chan any, func()) {
+	subscriber := &objectSubscriber{
+		ch: make(chan any, OBJECT_SUBSCRIBER_BUFFER_SIZE),
+	}
+
+	w.objects.mtx.Lock()
+	defer w.objects.mtx.Unlock()
+
+	w.objects.subscribers[subscriber] = true
+	return w.objects._snapshot(), subscriber.ch, func() {
+		w.objects.mtx.Lock()
+		delete(w.objects.subscribers, subscriber)
+		w.objects.mtx.Unlock()
+	}
+}
+
+// ObjectSubscriberOverflows returns the number of object subscribers that were dropped for falling behind.
+func (w *World) ObjectSubscriberOverflows() int {
+	w.objects.mtx.Lock()
+	defer w.objects.mtx.Unlock()
+
+	return w.objects.overflows
+}
@@ -0,0 +1,40 @@
+package host
+
+import (
+	"testing"
+
+	abyss "github.com/MinwooWebeng/abyss_core/interfaces"
+
+	"github.com/google/uuid"
+)
+
+func TestObjectSubscriberOverflow(t *testing.T) {
+	w := NewWorld(nil, "A", uuid.New(), "http://a.world.com")
+	_, slow_ch, unsubscribe_slow := w.SubscribeObjects()
+	defer unsubscribe_slow()
+
+	//the slow subscriber never reads; publishing must not block on it.
+	for range OBJECT_SUBSCRIBER_BUFFER_SIZE + 1 {
+		w.objects.append("B", []abyss.ObjectInfo{{ID: uuid.New(), Addr: "ball.aml"}})
+	}
+	if w.ObjectSubscriberOverflows() != 1 {
+		t.Fatal("slow subscriber not dropped")
+	}
+	for range OBJECT_SUBSCRIBER_BUFFER_SIZE {
+		<-slow_ch
+	}
+	if _, ok := <-slow_ch; ok {
+		t.Fatal("channel of a dropped subscriber not closed")
+	}
+
+	//a new subscription starts from a complete snapshot.
+	snapshot, object_ch, unsubscribe := w.SubscribeObjects()
+	defer unsubscribe()
+	if len(snapshot) != OBJECT_SUBSCRIBER_BUFFER_SIZE+1 {
+		t.Fatal("unexpected snapshot size", len(snapshot))
+	}
+	w.objects.append("B", []abyss.ObjectInfo{{ID: uuid.New(), Addr: "ball.aml"}})
+	if _, ok := (<-object_ch).(abyss.EMemberObjectAppend); !ok {
+		t.Fatal("event not delivered after resubscription")
+	}
+}
@@ -0,0 +1,319 @@
+package host
+
+import (
+	"slices"
+	"time"
+
+	abyss "github.com/MinwooWebeng/abyss_core/interfaces"
+
+	"github.com/google/uuid"
+)
+
+// ownership is the last handover of an object.
+type ownership struct {
+	hash  string
+	epoch uint64
+}
+
+type ownershipRequest struct {
+	peer_hash string
+	timestamp time.Time
+}
+
+// deferredHandover is a handover from a member that is not the owner yet.
+// it may arrive before the handover that makes the sender the owner.
+type deferredHandover struct {
+	sender_hash string
+	handover    abyss.ObjectHandover
+}
+
+const MAX_DEFERRED_HANDOVERS = 16 //per object
+
+// _current must be called with mtx held.
+// returns the owner of a remote object, or the last handover of an object.
+// a local object that was never handed over is not found.
+func (t *objectTable) _current(object_id uuid.UUID) (ownership, bool) {
+	if known, ok := t.owners[object_id]; ok {
+		return known, true
+	}
+	for owner_hash, owned := range t.objects {
+		if _, ok := owned[object_id]; ok {
+			return ownership{hash: owner_hash}, true
+		}
+	}
+	return ownership{}, false
+}
+
+// handover moves the object to the new owner. only the current owner can hand it over,
+// with the epoch that follows the known one. a handover from a later owner is deferred.
+// local_hash sends only for a local object, which the caller checked.
+// returns the previous owner.
+func (t *objectTable) handover(local_hash string, sender_hash string, handover abyss.ObjectHandover) (string, bool) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	id := handover.Object.ID
+	current, ok := t._current(id)
+	if !ok {
+		if sender_hash != local_hash { //unknown object
+			return "", false
+		}
+		current = ownership{hash: local_hash}
+	}
+	if current.hash != sender_hash {
+		if ok && handover.Epoch > current.epoch+1 && len(t.deferred[id]) < MAX_DEFERRED_HANDOVERS {
+			t.deferred[id] = append(t.deferred[id], deferredHandover{sender_hash, handover})
+		}
+		return "", false
+	}
+	if handover.Epoch != current.epoch+1 { //stale
+		return "", false
+	}
+
+	next := ownership{hash: handover.NewOwnerHash, epoch: handover.Epoch}
+	t.owners[id] = next
+
+	if owned, ok := t.objects[current.hash]; ok {
+		delete(owned, id)
+		if len(owned) == 0 {
+			delete(t.objects, current.hash)
+		}
+	}
+	if next.hash != local_hash {
+		owned, ok := t.objects[next.hash]
+		if !ok {
+			owned = make(map[uuid.UUID]abyss.ObjectInfo)
+			t.objects[next.hash] = owned
+		}
+		owned[id] = handover.Object
+	}
+	t._publish(abyss.EObjectOwnershipChange{
+		OldOwnerHash: current.hash,
+		NewOwnerHash: next.hash,
+		Object:       handover.Object,
+	})
+	return current.hash, true
+}
+
+// restate raises the epoch of an object that its current owner replayed to a new member.
+// the object is not moved, and the epoch never goes back.
+func (t *objectTable) restate(sender_hash string, handover abyss.ObjectHandover) bool {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	id := handover.Object.ID
+	current, ok := t._current(id)
+	if !ok || current.hash != sender_hash || handover.Epoch <= current.epoch {
+		return false
+	}
+	t.owners[id] = ownership{hash: sender_hash, epoch: handover.Epoch}
+	return true
+}
+
+// nextDeferred takes the deferred handover that follows the last one, if any.
+// an owner hands an object over only once, so there is at most one.
+func (t *objectTable) nextDeferred(object_id uuid.UUID) (string, abyss.ObjectHandover, bool) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	current := t.owners[object_id]
+	deferred := slices.DeleteFunc(t.deferred[object_id], func(d deferredHandover) bool { return d.handover.Epoch <= current.epoch })
+	i := slices.IndexFunc(deferred, func(d deferredHandover) bool {
+		return d.sender_hash == current.hash && d.handover.Epoch == current.epoch+1
+	})
+	if i < 0 {
+		t._setDeferred(object_id, deferred)
+		return "", abyss.ObjectHandover{}, false
+	}
+	next := deferred[i]
+	t._setDeferred(object_id, slices.Delete(deferred, i, i+1))
+	return next.sender_hash, next.handover, true
+}
+
+// _setDeferred must be called with mtx held.
+func (t *objectTable) _setDeferred(object_id uuid.UUID, deferred []deferredHandover) {
+	if len(deferred) == 0 {
+		delete(t.deferred, object_id)
+		return
+	}
+	t.deferred[object_id] = deferred
+}
+
+// owner returns the owner of a remote object.
+func (t *objectTable) owner(object_id uuid.UUID) (string, bool) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	current, ok := t._current(object_id)
+	if !ok {
+		return "", false
+	}
+	_, ok = t.objects[current.hash][object_id]
+	return current.hash, ok
+}
+
+func (t *objectTable) epoch(object_id uuid.UUID) uint64 {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	return t.owners[object_id].epoch
+}
+
+func (w *World) ObjectOwner(object_id uuid.UUID) (string, bool) {
+	w.published_mtx.Lock()
+	_, ok := w.published[object_id]
+	w.published_mtx.Unlock()
+	if ok {
+		return w.local_hash, true
+	}
+	return w.objects.owner(object_id)
+}
+
+// RequestOwnership asks the owner to hand the object over. The owner's app decides whether to grant it.
+func (w *World) RequestOwnership(owner_hash string, object_id uuid.UUID) bool {
+	if owner, ok := w.objects.owner(object_id); !ok || owner != owner_hash {
+		return false
+	}
+	w.members_mtx.Lock()
+	member, ok := w.members[owner_hash]
+	w.members_mtx.Unlock()
+	if !ok {
+		return false
+	}
+	return member.peerSession.Peer.TrySendOWR(w.session_id, member.peerSession.PeerSessionID, object_id, time.Now())
+}
+
+// TransferOwnership hands a local object over to a ready member, and tells every member.
+func (w *World) TransferOwnership(object_id uuid.UUID, new_owner_hash string) bool {
+	if _, ok := w.Member(new_owner_hash); !ok {
+		return false
+	}
+
+	w.published_mtx.Lock()
+	object, ok := w.published[object_id]
+	if !ok {
+		w.published_mtx.Unlock()
+		return false
+	}
+	delete(w.published, object_id)
+	delete(w.pending_requests, object_id)
+	w.published_mtx.Unlock()
+
+	handover := abyss.ObjectHandover{
+		Object:       object,
+		NewOwnerHash: new_owner_hash,
+		Epoch:        w.objects.epoch(object_id) + 1,
+		TimeStamp:    time.Now(),
+	}
+	w.objects.handover(w.local_hash, w.local_hash, handover)
+	w.eventChannel <- abyss.EObjectOwnershipChange{
+		OldOwnerHash: w.local_hash,
+		NewOwnerHash: new_owner_hash,
+		Object:       object,
+	}
+
+	for _, member := range w.readyMembers() {
+		member.peerSession.Peer.TrySendOHO(w.session_id, member.peerSession.PeerSessionID, handover)
+	}
+	return true
+}
+
+// grantOwnership hands the object over to the earliest pending requester that is still a member.
+func (w *World) grantOwnership(object_id uuid.UUID) bool {
+	w.published_mtx.Lock()
+	requests := slices.Clone(w.pending_requests[object_id])
+	w.published_mtx.Unlock()
+
+	var winner *ownershipRequest
+	for _, request := range requests {
+		if _, ok := w.Member(request.peer_hash); !ok {
+			continue
+		}
+		if winner == nil || request.timestamp.Before(winner.timestamp) ||
+			(request.timestamp.Equal(winner.timestamp) && request.peer_hash < winner.peer_hash) {
+			winner = &request
+		}
+	}
+	if winner == nil {
+		return false
+	}
+	return w.TransferOwnership(object_id, winner.peer_hash)
+}
+
+func (w *World) RaiseOwnershipRequest(peer_hash string, request abyss.ObjectOwnershipRequest) {
+	w.published_mtx.Lock()
+	if _, ok := w.published[request.ObjectID]; !ok { //not a local object, or already handed over.
+		w.published_mtx.Unlock()
+		return
+	}
+	requests := w.pending_requests[request.ObjectID]
+	for i := range requests {
+		if requests[i].peer_hash == peer_hash {
+			requests = append(requests[:i], requests[i+1:]...)
+			break
+		}
+	}
+	w.pending_requests[request.ObjectID] = append(requests, ownershipRequest{peer_hash, request.TimeStamp})
+	w.published_mtx.Unlock()
+
+	w.eventChannel <- abyss.EObjectOwnershipRequest{
+		PeerHash: peer_hash,
+		ObjectID: request.ObjectID,
+		Grant: func() bool {
+			return w.grantOwnership(request.ObjectID)
+		},
+	}
+}
+
+// replayEpochs restates the epochs of the replayed objects that were handed over, after their SOA.
+// without it, a new member would drop the next handover of the object as stale.
+func (w *World) replayEpochs(peer_session abyss.ANDPeerSession, objects []abyss.ObjectInfo) {
+	for _, object := range objects {
+		epoch := w.objects.epoch(object.ID)
+		if epoch == 0 {
+			continue
+		}
+		peer_session.Peer.TrySendOHO(w.session_id, peer_session.PeerSessionID, abyss.ObjectHandover{
+			Object:       object,
+			NewOwnerHash: w.local_hash,
+			Epoch:        epoch,
+			TimeStamp:    time.Now(),
+		})
+	}
+}
+
+func (w *World) RaiseOwnershipHandover(peer_hash string, handover abyss.ObjectHandover) {
+	if handover.NewOwnerHash == peer_hash { //restated
+		if !w.objects.restate(peer_hash, handover) {
+			return
+		}
+	} else if !w.raiseOwnershipChange(peer_hash, handover) {
+		return
+	}
+
+	//the new owner may have handed it over already.
+	if sender_hash, next, ok := w.objects.nextDeferred(handover.Object.ID); ok {
+		w.RaiseOwnershipHandover(sender_hash, next)
+	}
+}
+func (w *World) raiseOwnershipChange(peer_hash string, handover abyss.ObjectHandover) bool {
+	previous_hash, ok := w.objects.handover(w.local_hash, peer_hash, handover)
+	if !ok {
+		return false
+	}
+
+	//a local object is published by its owner, and replayed to new members.
+	if previous_hash == w.local_hash {
+		w.unpublish([]uuid.UUID{handover.Object.ID})
+	}
+	if handover.NewOwnerHash == w.local_hash {
+		w.publish([]abyss.ObjectInfo{handover.Object})
+	}
+
+	w.eventChannel <- abyss.EObjectOwnershipChange{
+		OldOwnerHash: previous_hash,
+		NewOwnerHash: handover.NewOwnerHash,
+		Object:       handover.Object,
+	}
+	return true
+}
@@ -0,0 +1,76 @@
+package host
+
+import (
+	"testing"
+	"time"
+
+	abyss "github.com/MinwooWebeng/abyss_core/interfaces"
+
+	"github.com/google/uuid"
+)
+
+func TestOwnershipHandoverSender(t *testing.T) {
+	w := NewWorld(nil, "A", uuid.New(), "http://a.world.com")
+	object := abyss.ObjectInfo{ID: uuid.New(), Addr: "ball.aml"}
+	w.RaiseObjectAppend("B", []abyss.ObjectInfo{object})
+	<-w.eventChannel
+
+	//C does not own the object.
+	w.RaiseOwnershipHandover("C", abyss.ObjectHandover{Object: object, NewOwnerHash: "C", Epoch: 1, TimeStamp: time.Now()})
+	if owner, ok := w.ObjectOwner(object.ID); !ok || owner != "B" {
+		t.Fatal("ownership changed by a non-owner", owner)
+	}
+	if len(w.eventChannel) != 0 {
+		t.Fatal("unexpected event")
+	}
+	if w.RaiseObjectAppend("B", []abyss.ObjectInfo{object}); len(w.eventChannel) != 1 {
+		t.Fatal("owner rejected")
+	}
+	<-w.eventChannel
+
+	//C hands it over to D before A learns that B handed it over to C.
+	w.RaiseOwnershipHandover("C", abyss.ObjectHandover{Object: object, NewOwnerHash: "D", Epoch: 2, TimeStamp: time.Now()})
+	w.RaiseOwnershipHandover("B", abyss.ObjectHandover{Object: object, NewOwnerHash: "C", Epoch: 1, TimeStamp: time.Now()})
+	for _, new_owner_hash := range []string{"C", "D"} {
+		if change := (<-w.eventChannel).(abyss.EObjectOwnershipChange); change.NewOwnerHash != new_owner_hash {
+			t.Fatal("unexpected ownership change", change)
+		}
+	}
+	if owner, _ := w.ObjectOwner(object.ID); owner != "D" || len(w.MemberObjects("B")) != 0 || len(w.MemberObjects("C")) != 0 {
+		t.Fatal("object not moved", owner)
+	}
+
+	//a replayed handover is stale.
+	w.RaiseOwnershipHandover("B", abyss.ObjectHandover{Object: object, NewOwnerHash: "C", Epoch: 1, TimeStamp: time.Now()})
+	if owner, _ := w.ObjectOwner(object.ID); owner != "D" || len(w.eventChannel) != 0 {
+		t.Fatal("stale handover applied", owner)
+	}
+}
+
+func TestOwnershipRestate(t *testing.T) {
+	w := NewWorld(nil, "D", uuid.New(), "http://a.world.com")
+	object := abyss.ObjectInfo{ID: uuid.New(), Addr: "ball.aml"}
+
+	//D becomes ready after two handovers. A replays the object, and restates its epoch.
+	w.RaiseObjectAppend("A", []abyss.ObjectInfo{object})
+	<-w.eventChannel
+	w.RaiseOwnershipHandover("B", abyss.ObjectHandover{Object: object, NewOwnerHash: "B", Epoch: 2, TimeStamp: time.Now()})
+	w.RaiseOwnershipHandover("A", abyss.ObjectHandover{Object: object, NewOwnerHash: "A", Epoch: 2, TimeStamp: time.Now()})
+	if owner, _ := w.ObjectOwner(object.ID); owner != "A" || len(w.eventChannel) != 0 {
+		t.Fatal("restated ownership changed", owner)
+	}
+	if w.objects.epoch(object.ID) != 2 {
+		t.Fatal("epoch not restated")
+	}
+
+	w.RaiseOwnershipHandover("A", abyss.ObjectHandover{Object: object, NewOwnerHash: "C", Epoch: 3, TimeStamp: time.Now()})
+	if change := (<-w.eventChannel).(abyss.EObjectOwnershipChange); change.NewOwnerHash != "C" {
+		t.Fatal("unexpected ownership change", change)
+	}
+
+	//the ownership is forgotten when the owner leaves.
+	w.RaisePeerLeave("C", 0, "")
+	if _, ok := w.ObjectOwner(object.ID); ok || len(w.objects.owners) != 0 {
+		t.Fatal("ownership kept after the owner left")
+	}
+}
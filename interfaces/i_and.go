@@ -23,6 +23,11 @@ const (
 
 	ANDObjectAppend
 	ANDObjectDelete
+	ANDObjectTransform
+	ANDObjectUpdate
+	ANDMemberMessage
+	ANDOwnershipRequest
+	ANDOwnershipHandover
 	ANDNeighborEventDebug
 )
 
@@ -70,9 +75,17 @@ type INeighborDiscovery interface { // all calls must be thread-safe
 	SJN(local_session_id uuid.UUID, peer_session ANDPeerSession, member_infos []ANDPeerSessionIdentity) ANDERROR
 	CRR(local_session_id uuid.UUID, peer_session ANDPeerSession, member_infos []ANDPeerSessionIdentity) ANDERROR
 	RST(local_session_id uuid.UUID, peer_session ANDPeerSession, message string) ANDERROR
+	RSR(local_session_id uuid.UUID, peer_session ANDPeerSession, code int, message string) ANDERROR
 
 	SOA(local_session_id uuid.UUID, peer_session ANDPeerSession, objects []ObjectInfo) ANDERROR
 	SOD(local_session_id uuid.UUID, peer_session ANDPeerSession, objectIDs []uuid.UUID) ANDERROR
+	SOT(local_session_id uuid.UUID, peer_session ANDPeerSession, transforms []ObjectTransform) ANDERROR
+	SOU(local_session_id uuid.UUID, peer_session ANDPeerSession, updates []ObjectUpdate) ANDERROR
+
+	MSG(local_session_id uuid.UUID, peer_session ANDPeerSession, topic string, payload []byte) ANDERROR
+
+	OWR(local_session_id uuid.UUID, peer_session ANDPeerSession, object_id uuid.UUID, timestamp time.Time) ANDERROR
+	OHO(local_session_id uuid.UUID, peer_session ANDPeerSession, handover ObjectHandover) ANDERROR
 
 	Statistics() string
 }
@@ -32,6 +32,20 @@ type ANDFullPeerSessionIdentity struct {
 	HandshakeKeyCertificateDer []byte
 }
 
+// PeerCapability is a bitmap of the optional protocol features.
+// The capabilities of a peer are the ones that both sides advertised in the handshake.
+type PeerCapability uint64
+
+const (
+	CAP_DATAGRAM       PeerCapability = 1 << iota //SOT over QUIC datagrams
+	CAP_COMPRESSION                               //compact AHMP encoding
+	CAP_CUSTOM_MESSAGE                            //application defined world messages
+)
+
+func (c PeerCapability) Has(capability PeerCapability) bool {
+	return c&capability == capability
+}
+
 type IANDPeer interface {
 	IDHash() string
 	RootCertificateDer() []byte
@@ -40,6 +54,10 @@ type IANDPeer interface {
 	IsConnected() bool
 	AURL() *aurl.AURL
 
+	//negotiated in the handshake. zero while not connected.
+	ProtocolVersion() int
+	Capabilities() PeerCapability
+
 	//inactivity check
 	Context() context.Context
 	Activate()
@@ -49,6 +67,8 @@ type IANDPeer interface {
 
 	AhmpCh() chan any
 
+	TrySend(message any) bool //any registered AHMP message
+
 	TrySendJN(local_session_id uuid.UUID, path string, timestamp time.Time) bool
 	TrySendJOK(local_session_id uuid.UUID, peer_session_id uuid.UUID, timestamp time.Time, world_url string, member_sessions []ANDPeerSessionWithTimeStamp) bool
 	TrySendJDN(peer_session_id uuid.UUID, code int, message string) bool
@@ -57,7 +77,15 @@ type IANDPeer interface {
 	TrySendSJN(local_session_id uuid.UUID, peer_session_id uuid.UUID, member_sessions []ANDPeerSessionIdentity) bool
 	TrySendCRR(local_session_id uuid.UUID, peer_session_id uuid.UUID, member_sessions []ANDPeerSessionIdentity) bool
 	TrySendRST(local_session_id uuid.UUID, peer_session_id uuid.UUID, message string) bool
+	TrySendRSR(local_session_id uuid.UUID, peer_session_id uuid.UUID, code int, message string) bool
 
 	TrySendSOA(local_session_id uuid.UUID, peer_session_id uuid.UUID, objects []ObjectInfo) bool
 	TrySendSOD(local_session_id uuid.UUID, peer_session_id uuid.UUID, objectIDs []uuid.UUID) bool
+	TrySendSOU(local_session_id uuid.UUID, peer_session_id uuid.UUID, updates []ObjectUpdate) bool
+	TrySendSOT(local_session_id uuid.UUID, peer_session_id uuid.UUID, sequence uint64, transforms []ObjectTransform) bool //QUIC datagram
+
+	TrySendMSG(local_session_id uuid.UUID, peer_session_id uuid.UUID, topic string, payload []byte) bool
+
+	TrySendOWR(local_session_id uuid.UUID, peer_session_id uuid.UUID, object_id uuid.UUID, timestamp time.Time) bool
+	TrySendOHO(local_session_id uuid.UUID, peer_session_id uuid.UUID, handover ObjectHandover) bool
 }
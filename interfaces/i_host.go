@@ -2,6 +2,7 @@ package interfaces
 
 import (
 	"context"
+	"time"
 
 	"github.com/MinwooWebeng/abyss_core/aurl"
 
@@ -14,8 +15,55 @@ type IPathResolver interface {
 }
 
 type ObjectInfo struct {
+	ID         uuid.UUID
+	Addr       string
+	Transform  [7]float32
+	Properties map[string]ObjectProperty //optional
+}
+
+// ObjectProperty is an application-defined property of a shared object.
+// a property is only replaced by a higher version.
+type ObjectProperty struct {
+	Version uint64
+	Value   []byte
+}
+
+// ObjectUpdate is a partial update of a shared object. nil fields are not changed,
+// and properties that are not in the map are kept.
+type ObjectUpdate struct {
+	ID         uuid.UUID
+	Addr       *string
+	Transform  *[7]float32
+	Properties map[string]ObjectProperty
+}
+
+// MemberObject is a shared object, with the hash of the member that owns it.
+type MemberObject struct {
+	OwnerHash string
+	ObjectInfo
+}
+
+// ObjectHandover moves a shared object to a new owner.
+// Epoch increases with each handover of the object; of two handovers with the same epoch,
+// the earlier one wins, and the lower new owner hash breaks a tie.
+// A handover to its sender restates the epoch for a member that became ready after the handover.
+type ObjectHandover struct {
+	Object       ObjectInfo
+	NewOwnerHash string
+	Epoch        uint64
+	TimeStamp    time.Time
+}
+
+// ObjectOwnershipRequest asks the owner for an object. Of concurrent requests, the earliest wins,
+// and the lower requester hash breaks a tie.
+type ObjectOwnershipRequest struct {
+	ObjectID  uuid.UUID
+	TimeStamp time.Time
+}
+
+// ObjectTransform is a transform update of a shared object.
+type ObjectTransform struct {
 	ID        uuid.UUID
-	Addr      string
 	Transform [7]float32
 }
 
@@ -24,6 +72,9 @@ type IWorldMember interface {
 	SessionID() uuid.UUID
 	AppendObjects(objects []ObjectInfo) bool
 	DeleteObjects(objectIDs []uuid.UUID) bool
+	UpdateTransforms(transforms []ObjectTransform) bool //unreliable. a lost update is not retransmitted.
+	UpdateObjects(updates []ObjectUpdate) bool
+	SendMessage(topic string, payload []byte) bool //fails if the member does not accept custom messages.
 }
 
 type EWorldMemberRequest struct {
@@ -42,8 +93,33 @@ type EMemberObjectDelete struct {
 	PeerHash  string
 	ObjectIDs []uuid.UUID
 }
+type EMemberObjectTransform struct { //only the latest transform of each object is delivered; stale ones are dropped.
+	PeerHash   string
+	Transforms []ObjectTransform
+}
+type EMemberObjectUpdate struct { //only the changes that applied; stale properties are dropped.
+	PeerHash string
+	Updates  []ObjectUpdate
+}
+type EObjectOwnershipRequest struct {
+	PeerHash string
+	ObjectID uuid.UUID
+	Grant    func() bool //hands the object over to the earliest pending requester, which may not be this one.
+}
+type EObjectOwnershipChange struct { //every member observes the changes of an object in the same order.
+	OldOwnerHash string
+	NewOwnerHash string
+	Object       ObjectInfo
+}
+type EWorldMemberMessage struct {
+	PeerHash string
+	Topic    string
+	Payload  []byte
+}
 type EWorldMemberLeave struct { //now, the peer must be closed as soon as possible.
 	PeerHash string
+	Code     int    //non-zero if the peer declined the session
+	Message  string //the peer's reason, if Code is set
 }
 type EWorldTerminate struct{}
 
@@ -51,6 +127,20 @@ type IAbyssWorld interface {
 	SessionID() uuid.UUID
 	URL() string
 	GetEventChannel() chan any
+	Members() []IWorldMember //snapshot of the ready members
+	Member(peer_hash string) (IWorldMember, bool)
+	Broadcast(topic string, payload []byte) //to all ready members
+
+	//replicated objects of the ready members
+	Objects() []MemberObject
+	MemberObjects(peer_hash string) []ObjectInfo
+	Object(peer_hash string, object_id uuid.UUID) (ObjectInfo, bool)
+	SubscribeObjects() ([]MemberObject, <-chan any, func()) //snapshot, and the object events after it. call the func to unsubscribe. the channel is closed if the subscriber falls behind.
+
+	//ownership
+	ObjectOwner(object_id uuid.UUID) (string, bool) //the local hash for local objects.
+	RequestOwnership(owner_hash string, object_id uuid.UUID) bool
+	TransferOwnership(object_id uuid.UUID, new_owner_hash string) bool //of a local object, to a ready member.
 }
 
 type IAbyssHost interface {
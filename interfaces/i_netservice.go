@@ -8,10 +8,18 @@ import (
 	"github.com/quic-go/quic-go"
 )
 
+// IPreAccepter decides whether an inbound connection is accepted, before the peer identity is looked up.
+// address is nil for a relayed connection, and peer_hash is empty for an abyst client that is not a connected peer.
 type IPreAccepter interface {
 	PreAccept(peer_hash string, address *net.UDPAddr) (bool, int, string)
 }
 
+// IHolePunchAccepter decides whether a hole punch requested by a peer is coordinated.
+// it is asked only for a target that was introduced to the requester.
+type IHolePunchAccepter interface {
+	AcceptHolePunch(requester_hash string, target_hash string) bool
+}
+
 type AbystInboundSession struct {
 	PeerHash   string
 	Connection quic.Connection
@@ -23,22 +31,30 @@ type INetworkService interface {
 	LocalIdentity() IHostIdentity
 	LocalAURL() *aurl.AURL
 
-	HandlePreAccept(preaccept_handler IPreAccepter) // if false, return status code and message
+	HandlePreAccept(preaccept_handler IPreAccepter)         // if false, return status code and message
+	HandleHolePunch(hole_punch_accepter IHolePunchAccepter) // if false, the hole punch request is ignored
 
 	ListenAndServe() error
 
 	AppendKnownPeer(root_cert string, handshake_key_cert string) error
 	AppendKnownPeerDer(root_cert []byte, handshake_key_cert []byte) error
 
-	GetAbyssPeerChannel() chan IANDPeer //wait for established abyss mutual connection
+	GetAbyssPeerChannel() chan IANDPeer      //wait for established abyss mutual connection
+	GetAbyssPeerCloseChannel() chan IANDPeer //wait for the established connection to close. sent once for each peer from GetAbyssPeerChannel.
 
 	ConnectAbyssAsync(url *aurl.AURL) error                 //may return error if peer information has expired.
 	ConnectAbyst(peer_hash string) (quic.Connection, error) //should take ~2 rtt.
+
+	RequestHolePunch(introducer_hash string, peer_hash string) error //ask a mutual peer to coordinate simultaneous dials.
+
+	Statistics() string
 }
 
 type IAddressSelector interface {
 	LocalPrivateIPAddr() net.IP
+	LocalIPAddrs() []net.IPAddr //all usable local unicast addresses, IPv4 first.
 	FilterAddressCandidates(addresses []*net.UDPAddr) []*net.UDPAddr
+	SetPublicIP(ip net.IP) //reflexive address observed by peers
 }
 
 // TLS ALPN code
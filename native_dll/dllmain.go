@@ -7,6 +7,7 @@ package main
 import "C"
 
 import (
+	"bytes"
 	"context"
 	"encoding/hex"
 	"encoding/json"
@@ -411,6 +412,21 @@ type ObjectDeleteData struct {
 	body_json string
 }
 
+type ObjectTransformData struct {
+	peer_hash string
+	body_json string
+}
+
+type ObjectUpdateData struct {
+	peer_hash string
+	body_json string
+}
+
+type ObjectOwnershipChangeData struct {
+	peer_hash string //new owner
+	body_json string
+}
+
 //export World_GetURL
 func World_GetURL(h C.uintptr_t, buf_ptr *C.char, buf_len C.int) C.int {
 	world, ok := cgo.Handle(h).Value().(*WorldExport)
@@ -420,6 +436,140 @@ func World_GetURL(h C.uintptr_t, buf_ptr *C.char, buf_len C.int) C.int {
 	return TryMarshalBytes(buf_ptr, buf_len, []byte(world.inner.URL()))
 }
 
+//export World_GetMemberHashes
+func World_GetMemberHashes(h C.uintptr_t, buf_ptr *C.char, buf_len C.int) C.int {
+	world, ok := cgo.Handle(h).Value().(*WorldExport)
+	if !ok {
+		return INVALID_HANDLE
+	}
+
+	data, _ := json.Marshal(functional.Filter(world.inner.Members(), func(m abyss.IWorldMember) string {
+		return m.Hash()
+	}))
+	return TryMarshalBytes(buf_ptr, buf_len, data)
+}
+
+//export World_GetMember
+func World_GetMember(h C.uintptr_t, peer_hash_ptr *C.char, peer_hash_len C.int) C.uintptr_t {
+	world, ok := cgo.Handle(h).Value().(*WorldExport)
+	if !ok {
+		watchdog.Error(errors.New("invalid handle"))
+		return 0
+	}
+
+	peer_hash, ok := TryUnmarshalBytes(peer_hash_ptr, peer_hash_len)
+	if !ok {
+		return 0
+	}
+	member, ok := world.inner.Member(string(peer_hash))
+	if !ok { //not a ready member
+		return 0
+	}
+
+	watchdog.CountHandleExport()
+	return C.uintptr_t(cgo.NewHandle(member))
+}
+
+//export World_GetObjects
+func World_GetObjects(h C.uintptr_t, buf_ptr *C.char, buf_len C.int) C.int {
+	world, ok := cgo.Handle(h).Value().(*WorldExport)
+	if !ok {
+		return INVALID_HANDLE
+	}
+
+	data, _ := json.Marshal(functional.Filter(world.inner.Objects(), func(i abyss.MemberObject) struct {
+		OwnerHash  string
+		ID         string
+		Addr       string
+		Transform  [7]float32
+		Properties map[string]abyss.ObjectProperty `json:",omitempty"`
+	} {
+		return struct {
+			OwnerHash  string
+			ID         string
+			Addr       string
+			Transform  [7]float32
+			Properties map[string]abyss.ObjectProperty `json:",omitempty"`
+		}{
+			OwnerHash:  i.OwnerHash,
+			ID:         hex.EncodeToString(i.ID[:]),
+			Addr:       i.Addr,
+			Transform:  i.Transform,
+			Properties: i.Properties,
+		}
+	}))
+	return TryMarshalBytes(buf_ptr, buf_len, data)
+}
+
+//export World_GetObjectOwner
+func World_GetObjectOwner(h C.uintptr_t, object_ID *C.char, buf_ptr *C.char, buf_len C.int) C.int {
+	world, ok := cgo.Handle(h).Value().(*WorldExport)
+	if !ok {
+		return INVALID_HANDLE
+	}
+
+	var object_uuid uuid.UUID
+	data, ok := TryUnmarshalBytes(object_ID, 16)
+	if !ok {
+		return INVALID_ARGUMENTS
+	}
+	copy(object_uuid[:], data)
+
+	owner_hash, ok := world.inner.ObjectOwner(object_uuid)
+	if !ok {
+		return ERROR
+	}
+	return TryMarshalBytes(buf_ptr, buf_len, []byte(owner_hash))
+}
+
+//export World_RequestOwnership
+func World_RequestOwnership(h C.uintptr_t, owner_hash_ptr *C.char, owner_hash_len C.int, object_ID *C.char) C.int {
+	world, ok := cgo.Handle(h).Value().(*WorldExport)
+	if !ok {
+		return INVALID_HANDLE
+	}
+
+	owner_hash, ok := TryUnmarshalBytes(owner_hash_ptr, owner_hash_len)
+	if !ok {
+		return INVALID_ARGUMENTS
+	}
+	var object_uuid uuid.UUID
+	data, ok := TryUnmarshalBytes(object_ID, 16)
+	if !ok {
+		return INVALID_ARGUMENTS
+	}
+	copy(object_uuid[:], data)
+
+	if !world.inner.RequestOwnership(string(owner_hash), object_uuid) {
+		return ERROR
+	}
+	return 0
+}
+
+//export World_TransferOwnership
+func World_TransferOwnership(h C.uintptr_t, object_ID *C.char, new_owner_hash_ptr *C.char, new_owner_hash_len C.int) C.int {
+	world, ok := cgo.Handle(h).Value().(*WorldExport)
+	if !ok {
+		return INVALID_HANDLE
+	}
+
+	var object_uuid uuid.UUID
+	data, ok := TryUnmarshalBytes(object_ID, 16)
+	if !ok {
+		return INVALID_ARGUMENTS
+	}
+	copy(object_uuid[:], data)
+	new_owner_hash, ok := TryUnmarshalBytes(new_owner_hash_ptr, new_owner_hash_len)
+	if !ok {
+		return INVALID_ARGUMENTS
+	}
+
+	if !world.inner.TransferOwnership(object_uuid, string(new_owner_hash)) {
+		return ERROR
+	}
+	return 0
+}
+
 //export World_WaitEvent
 func World_WaitEvent(h C.uintptr_t, event_type_out *C.int) C.uintptr_t {
 	world, ok := cgo.Handle(h).Value().(*WorldExport)
@@ -442,18 +592,21 @@ func World_WaitEvent(h C.uintptr_t, event_type_out *C.int) C.uintptr_t {
 	case abyss.EMemberObjectAppend:
 		*event_type_out = 3
 		data, _ := json.Marshal(functional.Filter(event.Objects, func(i abyss.ObjectInfo) struct {
-			ID        string
-			Addr      string
-			Transform [7]float32
+			ID         string
+			Addr       string
+			Transform  [7]float32
+			Properties map[string]abyss.ObjectProperty `json:",omitempty"`
 		} {
 			return struct {
-				ID        string
-				Addr      string
-				Transform [7]float32
+				ID         string
+				Addr       string
+				Transform  [7]float32
+				Properties map[string]abyss.ObjectProperty `json:",omitempty"`
 			}{
-				ID:        hex.EncodeToString(i.ID[:]),
-				Addr:      i.Addr,
-				Transform: i.Transform,
+				ID:         hex.EncodeToString(i.ID[:]),
+				Addr:       i.Addr,
+				Transform:  i.Transform,
+				Properties: i.Properties,
 			}
 		}))
 		watchdog.CountHandleExport()
@@ -471,6 +624,80 @@ func World_WaitEvent(h C.uintptr_t, event_type_out *C.int) C.uintptr_t {
 			peer_hash: event.PeerHash,
 			body_json: string(data),
 		}))
+	case abyss.EMemberObjectTransform:
+		*event_type_out = 7
+		data, _ := json.Marshal(functional.Filter(event.Transforms, func(i abyss.ObjectTransform) struct {
+			ID        string
+			Transform [7]float32
+		} {
+			return struct {
+				ID        string
+				Transform [7]float32
+			}{
+				ID:        hex.EncodeToString(i.ID[:]),
+				Transform: i.Transform,
+			}
+		}))
+		watchdog.CountHandleExport()
+		return C.uintptr_t(cgo.NewHandle(&ObjectTransformData{
+			peer_hash: event.PeerHash,
+			body_json: string(data),
+		}))
+	case abyss.EMemberObjectUpdate:
+		*event_type_out = 9
+		data, _ := json.Marshal(functional.Filter(event.Updates, func(i abyss.ObjectUpdate) struct {
+			ID         string
+			Addr       *string                         `json:",omitempty"`
+			Transform  *[7]float32                     `json:",omitempty"`
+			Properties map[string]abyss.ObjectProperty `json:",omitempty"`
+		} {
+			return struct {
+				ID         string
+				Addr       *string                         `json:",omitempty"`
+				Transform  *[7]float32                     `json:",omitempty"`
+				Properties map[string]abyss.ObjectProperty `json:",omitempty"`
+			}{
+				ID:         hex.EncodeToString(i.ID[:]),
+				Addr:       i.Addr,
+				Transform:  i.Transform,
+				Properties: i.Properties,
+			}
+		}))
+		watchdog.CountHandleExport()
+		return C.uintptr_t(cgo.NewHandle(&ObjectUpdateData{
+			peer_hash: event.PeerHash,
+			body_json: string(data),
+		}))
+	case abyss.EObjectOwnershipRequest:
+		*event_type_out = 10
+		watchdog.CountHandleExport()
+		return C.uintptr_t(cgo.NewHandle(&event))
+	case abyss.EObjectOwnershipChange:
+		*event_type_out = 11
+		data, _ := json.Marshal(struct {
+			OldOwnerHash string
+			NewOwnerHash string
+			ID           string
+			Addr         string
+			Transform    [7]float32
+			Properties   map[string]abyss.ObjectProperty `json:",omitempty"`
+		}{
+			OldOwnerHash: event.OldOwnerHash,
+			NewOwnerHash: event.NewOwnerHash,
+			ID:           hex.EncodeToString(event.Object.ID[:]),
+			Addr:         event.Object.Addr,
+			Transform:    event.Object.Transform,
+			Properties:   event.Object.Properties,
+		})
+		watchdog.CountHandleExport()
+		return C.uintptr_t(cgo.NewHandle(&ObjectOwnershipChangeData{
+			peer_hash: event.NewOwnerHash,
+			body_json: string(data),
+		}))
+	case abyss.EWorldMemberMessage:
+		*event_type_out = 8
+		watchdog.CountHandleExport()
+		return C.uintptr_t(cgo.NewHandle(&event))
 	case abyss.EWorldMemberLeave:
 		*event_type_out = 5
 		watchdog.CountHandleExport()
@@ -549,9 +776,10 @@ func WorldPeer_AppendObjects(h C.uintptr_t, json_ptr *C.char, json_len C.int) C.
 		return INVALID_ARGUMENTS
 	}
 	var raw_object_infos []struct {
-		ID        string
-		Addr      string
-		Transform [7]float32
+		ID         string
+		Addr       string
+		Transform  [7]float32
+		Properties map[string]abyss.ObjectProperty
 	}
 	err := json.Unmarshal(json_data, &raw_object_infos)
 	if err != nil {
@@ -559,18 +787,20 @@ func WorldPeer_AppendObjects(h C.uintptr_t, json_ptr *C.char, json_len C.int) C.
 		return INVALID_ARGUMENTS
 	}
 	res, _, err := functional.Filter_until_err(raw_object_infos, func(i struct {
-		ID        string
-		Addr      string
-		Transform [7]float32
+		ID         string
+		Addr       string
+		Transform  [7]float32
+		Properties map[string]abyss.ObjectProperty
 	}) (abyss.ObjectInfo, error) {
 		bytes, err := hex.DecodeString(i.ID)
 		if err != nil {
 			return abyss.ObjectInfo{}, err
 		}
 		return abyss.ObjectInfo{
-			ID:        uuid.UUID(bytes),
-			Addr:      i.Addr,
-			Transform: i.Transform,
+			ID:         uuid.UUID(bytes),
+			Addr:       i.Addr,
+			Transform:  i.Transform,
+			Properties: i.Properties,
 		}, nil
 	})
 	if err != nil {
@@ -615,6 +845,132 @@ func WorldPeer_DeleteObjects(h C.uintptr_t, json_ptr *C.char, json_len C.int) C.
 	return 0
 }
 
+//export WorldPeer_UpdateTransforms
+func WorldPeer_UpdateTransforms(h C.uintptr_t, json_ptr *C.char, json_len C.int) C.int {
+	peer, ok := cgo.Handle(h).Value().(abyss.IWorldMember)
+	if !ok {
+		return INVALID_HANDLE
+	}
+
+	json_data, ok := TryUnmarshalBytes(json_ptr, json_len)
+	if !ok {
+		return INVALID_ARGUMENTS
+	}
+	var raw_transforms []struct {
+		ID        string
+		Transform [7]float32
+	}
+	err := json.Unmarshal(json_data, &raw_transforms)
+	if err != nil {
+		watchdog.Error(err)
+		return INVALID_ARGUMENTS
+	}
+	res, _, err := functional.Filter_until_err(raw_transforms, func(i struct {
+		ID        string
+		Transform [7]float32
+	}) (abyss.ObjectTransform, error) {
+		bytes, err := hex.DecodeString(i.ID)
+		if err != nil {
+			return abyss.ObjectTransform{}, err
+		}
+		return abyss.ObjectTransform{
+			ID:        uuid.UUID(bytes),
+			Transform: i.Transform,
+		}, nil
+	})
+	if err != nil {
+		watchdog.Error(err)
+		return INVALID_ARGUMENTS
+	}
+
+	peer.UpdateTransforms(res)
+	return 0
+}
+
+//export WorldPeer_UpdateObjects
+func WorldPeer_UpdateObjects(h C.uintptr_t, json_ptr *C.char, json_len C.int) C.int {
+	peer, ok := cgo.Handle(h).Value().(abyss.IWorldMember)
+	if !ok {
+		return INVALID_HANDLE
+	}
+
+	json_data, ok := TryUnmarshalBytes(json_ptr, json_len)
+	if !ok {
+		return INVALID_ARGUMENTS
+	}
+	var raw_updates []struct {
+		ID         string
+		Addr       *string
+		Transform  *[7]float32
+		Properties map[string]abyss.ObjectProperty
+	}
+	err := json.Unmarshal(json_data, &raw_updates)
+	if err != nil {
+		watchdog.Error(err)
+		return INVALID_ARGUMENTS
+	}
+	res, _, err := functional.Filter_until_err(raw_updates, func(i struct {
+		ID         string
+		Addr       *string
+		Transform  *[7]float32
+		Properties map[string]abyss.ObjectProperty
+	}) (abyss.ObjectUpdate, error) {
+		bytes, err := hex.DecodeString(i.ID)
+		if err != nil {
+			return abyss.ObjectUpdate{}, err
+		}
+		return abyss.ObjectUpdate{
+			ID:         uuid.UUID(bytes),
+			Addr:       i.Addr,
+			Transform:  i.Transform,
+			Properties: i.Properties,
+		}, nil
+	})
+	if err != nil {
+		watchdog.Error(err)
+		return INVALID_ARGUMENTS
+	}
+
+	peer.UpdateObjects(res)
+	return 0
+}
+
+//export WorldPeer_SendMessage
+func WorldPeer_SendMessage(h C.uintptr_t, topic_ptr *C.char, topic_len C.int, payload_ptr *C.char, payload_len C.int) C.int {
+	peer, ok := cgo.Handle(h).Value().(abyss.IWorldMember)
+	if !ok {
+		return INVALID_HANDLE
+	}
+
+	topic, ok := TryUnmarshalBytes(topic_ptr, topic_len)
+	if !ok {
+		return INVALID_ARGUMENTS
+	}
+	payload, _ := TryUnmarshalBytes(payload_ptr, payload_len) //may be empty
+
+	if !peer.SendMessage(string(topic), bytes.Clone(payload)) {
+		return ERROR
+	}
+	return 0
+}
+
+//export World_Broadcast
+func World_Broadcast(h C.uintptr_t, topic_ptr *C.char, topic_len C.int, payload_ptr *C.char, payload_len C.int) C.int {
+	world, ok := cgo.Handle(h).Value().(*WorldExport)
+	if !ok {
+		return INVALID_HANDLE
+	}
+
+	topic, ok := TryUnmarshalBytes(topic_ptr, topic_len)
+	if !ok {
+		return INVALID_ARGUMENTS
+	}
+	payload, _ := TryUnmarshalBytes(payload_ptr, payload_len)
+
+	world.inner.Broadcast(string(topic), bytes.Clone(payload))
+	return 0
+}
+
 //export WorldPeerObjectAppend_GetHead
 func WorldPeerObjectAppend_GetHead(h C.uintptr_t, peer_hash_out *C.char, body_len *C.int) C.int {
 	data, ok := cgo.Handle(h).Value().(*ObjectAppendData)
@@ -657,6 +1013,27 @@ func WorldPeerObjectDelete_GetBody(h C.uintptr_t, buf *C.char, buf_len C.int) C.
 	return TryMarshalBytes(buf, buf_len, []byte(data.body_json))
 }
 
+//export WorldPeerObjectTransform_GetHead
+func WorldPeerObjectTransform_GetHead(h C.uintptr_t, peer_hash_out *C.char, body_len *C.int) C.int {
+	data, ok := cgo.Handle(h).Value().(*ObjectTransformData)
+	if !ok {
+		return INVALID_HANDLE
+	}
+
+	*body_len = C.int(len(data.body_json))
+	return TryMarshalBytes(peer_hash_out, 128, []byte(data.peer_hash))
+}
+
+//export WorldPeerObjectTransform_GetBody
+func WorldPeerObjectTransform_GetBody(h C.uintptr_t, buf *C.char, buf_len C.int) C.int {
+	data, ok := cgo.Handle(h).Value().(*ObjectTransformData)
+	if !ok {
+		return INVALID_HANDLE
+	}
+
+	return TryMarshalBytes(buf, buf_len, []byte(data.body_json))
+}
+
 //export WorldPeerLeave_GetHash
 func WorldPeerLeave_GetHash(h C.uintptr_t, buf *C.char, buf_len C.int) C.int {
 	event, ok := cgo.Handle(h).Value().(*abyss.EWorldMemberLeave)
@@ -667,6 +1044,119 @@ func WorldPeerLeave_GetHash(h C.uintptr_t, buf *C.char, buf_len C.int) C.int {
 	return TryMarshalBytes(buf, buf_len, []byte(event.PeerHash))
 }
 
+//export WorldPeerLeave_GetReason
+func WorldPeerLeave_GetReason(h C.uintptr_t, code_out *C.int, buf *C.char, buf_len C.int) C.int {
+	event, ok := cgo.Handle(h).Value().(*abyss.EWorldMemberLeave)
+	if !ok {
+		return INVALID_HANDLE
+	}
+
+	*code_out = C.int(event.Code)
+	return TryMarshalBytes(buf, buf_len, []byte(event.Message))
+}
+
+//export WorldPeerObjectUpdate_GetHead
+func WorldPeerObjectUpdate_GetHead(h C.uintptr_t, peer_hash_out *C.char, body_len *C.int) C.int {
+	data, ok := cgo.Handle(h).Value().(*ObjectUpdateData)
+	if !ok {
+		return INVALID_HANDLE
+	}
+
+	*body_len = C.int(len(data.body_json))
+	return TryMarshalBytes(peer_hash_out, 128, []byte(data.peer_hash))
+}
+
+//export WorldPeerObjectUpdate_GetBody
+func WorldPeerObjectUpdate_GetBody(h C.uintptr_t, buf *C.char, buf_len C.int) C.int {
+	data, ok := cgo.Handle(h).Value().(*ObjectUpdateData)
+	if !ok {
+		return INVALID_HANDLE
+	}
+
+	return TryMarshalBytes(buf, buf_len, []byte(data.body_json))
+}
+
+//export WorldObjectOwnershipRequest_GetHead
+func WorldObjectOwnershipRequest_GetHead(h C.uintptr_t, peer_hash_out *C.char, object_ID_out *C.char) C.int {
+	event, ok := cgo.Handle(h).Value().(*abyss.EObjectOwnershipRequest)
+	if !ok {
+		return INVALID_HANDLE
+	}
+
+	dest, ok := TryUnmarshalBytes(object_ID_out, 16)
+	if !ok {
+		return INVALID_ARGUMENTS
+	}
+	copy(dest, event.ObjectID[:])
+	return TryMarshalBytes(peer_hash_out, 128, []byte(event.PeerHash))
+}
+
+//export WorldObjectOwnershipRequest_Grant
+func WorldObjectOwnershipRequest_Grant(h C.uintptr_t) C.int {
+	event, ok := cgo.Handle(h).Value().(*abyss.EObjectOwnershipRequest)
+	if !ok {
+		return INVALID_HANDLE
+	}
+
+	if !event.Grant() {
+		return ERROR
+	}
+	return 0
+}
+
+//export WorldObjectOwnershipChange_GetHead
+func WorldObjectOwnershipChange_GetHead(h C.uintptr_t, peer_hash_out *C.char, body_len *C.int) C.int {
+	data, ok := cgo.Handle(h).Value().(*ObjectOwnershipChangeData)
+	if !ok {
+		return INVALID_HANDLE
+	}
+
+	*body_len = C.int(len(data.body_json))
+	return TryMarshalBytes(peer_hash_out, 128, []byte(data.peer_hash))
+}
+
+//export WorldObjectOwnershipChange_GetBody
+func WorldObjectOwnershipChange_GetBody(h C.uintptr_t, buf *C.char, buf_len C.int) C.int {
+	data, ok := cgo.Handle(h).Value().(*ObjectOwnershipChangeData)
+	if !ok {
+		return INVALID_HANDLE
+	}
+
+	return TryMarshalBytes(buf, buf_len, []byte(data.body_json))
+}
+
+//export WorldPeerMessage_GetHead
+func WorldPeerMessage_GetHead(h C.uintptr_t, peer_hash_out *C.char, topic_len *C.int, body_len *C.int) C.int {
+	event, ok := cgo.Handle(h).Value().(*abyss.EWorldMemberMessage)
+	if !ok {
+		return INVALID_HANDLE
+	}
+
+	*topic_len = C.int(len(event.Topic))
+	*body_len = C.int(len(event.Payload))
+	return TryMarshalBytes(peer_hash_out, 128, []byte(event.PeerHash))
+}
+
+//export WorldPeerMessage_GetTopic
+func WorldPeerMessage_GetTopic(h C.uintptr_t, buf *C.char, buf_len C.int) C.int {
+	event, ok := cgo.Handle(h).Value().(*abyss.EWorldMemberMessage)
+	if !ok {
+		return INVALID_HANDLE
+	}
+
+	return TryMarshalBytes(buf, buf_len, []byte(event.Topic))
+}
+
+//export WorldPeerMessage_GetBody
+func WorldPeerMessage_GetBody(h C.uintptr_t, buf *C.char, buf_len C.int) C.int {
+	event, ok := cgo.Handle(h).Value().(*abyss.EWorldMemberMessage)
+	if !ok {
+		return INVALID_HANDLE
+	}
+
+	return TryMarshalBytes(buf, buf_len, event.Payload)
+}
+
 //export WorldLeave
 func WorldLeave(h C.uintptr_t) C.int {
 	world, ok := cgo.Handle(h).Value().(*WorldExport)
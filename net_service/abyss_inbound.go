@@ -4,51 +4,24 @@ import (
 	"context"
 	"crypto/x509"
 	"errors"
+	"net"
+	"strconv"
 
 	"github.com/fxamacker/cbor/v2"
 	"github.com/quic-go/quic-go"
 
 	"github.com/MinwooWebeng/abyss_core/aerr"
 	"github.com/MinwooWebeng/abyss_core/ahmp"
+	"github.com/MinwooWebeng/abyss_core/watchdog"
 )
 
 func (h *BetaNetService) PrepareAbyssInbound(listen_ctx context.Context, connection quic.Connection) {
 	//watchdog.Info("inbound detected")
-	var target *ContextedPeer
-	var ahmp_decoder *cbor.Decoder
 	var err error
 
 	defer func() {
-		if target == nil { //peer not found.
-			return
-		}
-
-		target.mtx.Lock()
-		defer target.mtx.Unlock()
-
-		if err != nil {
-			if target.err == nil {
-				target.err = err
-			}
-			target.state = PNCS_CLOSED
-		} else {
-			switch target.state {
-			case PNCS_DISCONNECTED:
-				target.state = PNCS_INBOUND
-				target.inbound_conn = connection
-				target.ahmp_decoder = ahmp_decoder
-				go target.listenAhmp()
-			case PNCS_OUTBOUND:
-				target.state = PNCS_CONNECTED
-				target.inbound_conn = connection
-				target.ahmp_decoder = ahmp_decoder
-				go target.listenAhmp()
-				h.abyssPeerCH <- target
-			case PNCS_INBOUND, PNCS_CONNECTED:
-				connection.CloseWithError(ABYSS_ALREADY_CONNECTED, ABYSS_ALREADY_CONNECTED_M)
-			case PNCS_CLOSED:
-				connection.CloseWithError(ABYSS_EARLY_RECONNECTION, ABYSS_EARLY_RECONNECTION_M)
-			}
+		if err != nil { //a failed inbound does not affect the peer. the remote side will retry.
+			connection.CloseWithError(ABYSS_AHMP_FAILED, ABYSS_AHMP_FAILED_M)
 		}
 	}()
 
@@ -62,7 +35,7 @@ func (h *BetaNetService) PrepareAbyssInbound(listen_ctx context.Context, connect
 		return
 	}
 	ahmp_encoder := cbor.NewEncoder(ahmp_stream)
-	ahmp_decoder = cbor.NewDecoder(ahmp_stream)
+	ahmp_decoder := cbor.NewDecoder(ahmp_stream)
 
 	//receive connecter-side handshake1 self-authentication payload
 	var handshake_1_raw []byte
@@ -85,191 +58,131 @@ func (h *BetaNetService) PrepareAbyssInbound(listen_ctx context.Context, connect
 		err = aerr.NewConnErr(connection, nil, err)
 		return
 	}
+	remote_hello, err := receiveHello(ahmp_decoder)
+	if err != nil {
+		err = aerr.NewConnErr(connection, nil, err)
+		return
+	}
+	version, capabilities, err := h.negotiate(remote_hello, connection)
+	if err != nil {
+		connection.CloseWithError(ABYSS_VERSION_MISMATCH, ABYSS_VERSION_MISMATCH_M)
+		err = nil
+		return
+	}
 
-	//****Important****
-	//TODO: make sure that only one inbound connection is answered for a peer. use atomic.
 	//retrieve known identity and verify
 	peer_hash := abyss_bind_cert_x509.Issuer.CommonName
-	target, err = h.peers.Wait(listen_ctx, peer_hash)
+	if !h.preAccept(peer_hash, connection) {
+		return
+	}
+	if !h.rateLimits.allowConnectionOf(peer_hash) {
+		connection.CloseWithError(ABYSS_RATE_LIMITED, ABYSS_RATE_LIMITED_M)
+		return
+	}
+	//the peer may be introduced later. the wait is bounded by the pending handshake table, which closes the connection on failure.
+	peer, err := h.pendingHandshakes.wait(listen_ctx, h.peers, peer_hash, connection)
 	if err != nil {
 		err = aerr.NewConnErrM(connection, nil, "unknown peer")
 		return
 	}
-	if err = target.identity.VerifyTLSBinding(abyss_bind_cert_x509, client_tls_cert); err != nil {
+	if err = peer.identity.VerifyTLSBinding(abyss_bind_cert_x509, client_tls_cert); err != nil {
 		err = aerr.NewConnErr(connection, nil, err)
 		return
 	}
 
-	//send local tls-abyss binding cert
+	//only one connection is kept for a peer pair.
+	//if both sides are dialing, the connection dialed by the smaller ID hash wins.
+	//a handshake from a new instance of the peer, with a new TLS key, means that the remote side restarted,
+	//and the current connection is stale. it is replaced, instead of waiting for the idle timeout.
+	peer.mtx.Lock()
+	defer peer.mtx.Unlock()
+
+	switch {
+	case peer.state == PNCS_CONNECTED && !isRestarted(peer.conn, client_tls_cert):
+		connection.CloseWithError(ABYSS_ALREADY_CONNECTED, ABYSS_ALREADY_CONNECTED_M)
+		return
+	case peer.dialing && h.localIdentity.root_id_hash < peer_hash:
+		connection.CloseWithError(ABYSS_TIE_BREAK, ABYSS_TIE_BREAK_M)
+		return
+	}
+
+	//send local tls-abyss binding cert and hello.
+	//this is done before the peer becomes visible, so that no AHMP message precedes it.
 	if err = ahmp_encoder.Encode(h.tlsIdentity.abyss_bind_cert); err != nil {
 		err = aerr.NewConnErr(connection, nil, err)
 		return
 	}
+	if err = h.sendHello(ahmp_encoder); err != nil {
+		err = aerr.NewConnErr(connection, nil, err)
+		return
+	}
+
+	if peer.state == PNCS_CONNECTED {
+		watchdog.Info("replacing the stale connection of " + peer_hash)
+		peer.conn.CloseWithError(ABYSS_CONNECTION_REPLACED, ABYSS_CONNECTION_REPLACED_M)
+	}
+	peer._reset()
+	if address, ok := connection.RemoteAddr().(*net.UDPAddr); ok { //not relayed
+		peer._appendAddresses([]*net.UDPAddr{address})
+	}
+	h._adopt(peer, connection, ahmp_encoder, ahmp_decoder, version, capabilities)
+}
 
-	//return: defer will update the peer.
+// isRestarted reports whether the new connection is from another instance of the peer than the current one.
+// each instance presents its own TLS certificate, so a duplicate dial of the same instance is not a restart.
+func isRestarted(current quic.Connection, client_tls_cert *x509.Certificate) bool {
+	current_certs := current.ConnectionState().TLS.PeerCertificates
+	return len(current_certs) == 0 || !current_certs[0].Equal(client_tls_cert)
 }
 
-func (p *AbyssPeer) listenAhmp() {
+// listenAhmp reads the AHMP frames of the stream until it fails.
+// On return, the connection is closed, which is detected by watchAbyssPeer.
+// Each message must pass admit, which applies the rate limits, before it is delivered.
+// RAR, HPR and HPS are network service messages, which are handled by on_netmsg instead of AND.
+func (p *AbyssPeer) listenAhmp(connection quic.Connection, ahmp_decoder *cbor.Decoder, compact bool, admit func(ahmp_type int, message any) bool, on_netmsg func(any)) {
 	var err error
 	defer func() {
 		p.mtx.Lock()
-		p.state = PNCS_CLOSED
-		p.err = err
+		if p.conn == connection && p.err == nil { //a replaced connection does not affect the new one.
+			p.err = err
+		}
 		p.mtx.Unlock()
+		connection.CloseWithError(ABYSS_AHMP_FAILED, ABYSS_AHMP_FAILED_M)
 	}()
 
 	for {
-		var ahmp_type int
-		err := p.ahmp_decoder.Decode(&ahmp_type)
+		var frame ahmp.RawFrame
+		err = ahmp_decoder.Decode(&frame)
 		if err != nil {
 			return
 		}
-
-		//fmt.Println(p.inbound_conn.LocalAddr().String() + " < " + p.inbound_conn.RemoteAddr().String() + " " + strconv.Itoa(ahmp_type))
-		switch ahmp_type {
-		case ahmp.JN_T:
-			//fmt.Println("receiving JN")
-			var raw_msg ahmp.RawJN
-			err = p.ahmp_decoder.Decode(&raw_msg)
-			if err != nil {
-				p.ahmp_decoded_ch <- &ahmp.INVAL{Err: errors.Join(errors.New("parsing JN"), err)}
-				return
-			}
-			parsed_msg, err := raw_msg.TryParse()
-			if err != nil {
-				p.ahmp_decoded_ch <- &ahmp.INVAL{Err: errors.Join(errors.New("parsing JN"), err)}
-				return
-			}
-			p.ahmp_decoded_ch <- parsed_msg
-		case ahmp.JOK_T:
-			//fmt.Println("receiving JOK")
-			var raw_msg ahmp.RawJOK
-			err = p.ahmp_decoder.Decode(&raw_msg)
-			if err != nil {
-				p.ahmp_decoded_ch <- &ahmp.INVAL{Err: errors.Join(errors.New("parsing JOK"), err)}
-				return
-			}
-			parsed_msg, err := raw_msg.TryParse()
-			if err != nil {
-				p.ahmp_decoded_ch <- &ahmp.INVAL{Err: errors.Join(errors.New("parsing JOK"), err)}
-				return
-			}
-			p.ahmp_decoded_ch <- parsed_msg
-		case ahmp.JDN_T:
-			//fmt.Println("receiving JDN")
-			var raw_msg ahmp.RawJDN
-			err = p.ahmp_decoder.Decode(&raw_msg)
-			if err != nil {
-				p.ahmp_decoded_ch <- &ahmp.INVAL{Err: errors.Join(errors.New("parsing JDN"), err)}
-				return
-			}
-			parsed_msg, err := raw_msg.TryParse()
-			if err != nil {
-				p.ahmp_decoded_ch <- &ahmp.INVAL{Err: errors.Join(errors.New("parsing JDN"), err)}
-				return
-			}
-			p.ahmp_decoded_ch <- parsed_msg
-		case ahmp.JNI_T:
-			//fmt.Println("receiving JNI")
-			var raw_msg ahmp.RawJNI
-			err = p.ahmp_decoder.Decode(&raw_msg)
-			if err != nil {
-				p.ahmp_decoded_ch <- &ahmp.INVAL{Err: errors.Join(errors.New("parsing JNI"), err)}
-				return
-			}
-			parsed_msg, err := raw_msg.TryParse()
-			if err != nil {
-				p.ahmp_decoded_ch <- &ahmp.INVAL{Err: errors.Join(errors.New("parsing JNI"), err)}
-				return
-			}
-			p.ahmp_decoded_ch <- parsed_msg
-		case ahmp.MEM_T:
-			//fmt.Println("receiving MEM")
-			var raw_msg ahmp.RawMEM
-			err = p.ahmp_decoder.Decode(&raw_msg)
-			if err != nil {
-				p.ahmp_decoded_ch <- &ahmp.INVAL{Err: errors.Join(errors.New("parsing MEM"), err)}
-				return
-			}
-			parsed_msg, err := raw_msg.TryParse()
-			if err != nil {
-				p.ahmp_decoded_ch <- &ahmp.INVAL{Err: errors.Join(errors.New("parsing MEM"), err)}
-				return
-			}
-			p.ahmp_decoded_ch <- parsed_msg
-		case ahmp.SJN_T:
-			//fmt.Println("receiving SJN")
-			var raw_msg ahmp.RawSJN
-			err = p.ahmp_decoder.Decode(&raw_msg)
-			if err != nil {
-				p.ahmp_decoded_ch <- &ahmp.INVAL{Err: errors.Join(errors.New("parsing SJN"), err)}
-				return
-			}
-			parsed_msg, err := raw_msg.TryParse()
-			if err != nil {
-				p.ahmp_decoded_ch <- &ahmp.INVAL{Err: errors.Join(errors.New("parsing SJN"), err)}
-				return
-			}
-			p.ahmp_decoded_ch <- parsed_msg
-		case ahmp.CRR_T:
-			//fmt.Println("receiving CRR")
-			var raw_msg ahmp.RawCRR
-			err = p.ahmp_decoder.Decode(&raw_msg)
-			if err != nil {
-				p.ahmp_decoded_ch <- &ahmp.INVAL{Err: errors.Join(errors.New("parsing CRR"), err)}
-				return
-			}
-			parsed_msg, err := raw_msg.TryParse()
-			if err != nil {
-				p.ahmp_decoded_ch <- &ahmp.INVAL{Err: errors.Join(errors.New("parsing CRR"), err)}
-				return
-			}
-			p.ahmp_decoded_ch <- parsed_msg
-		case ahmp.RST_T:
-			//fmt.Println("receiving RST")
-			var raw_msg ahmp.RawRST
-			err = p.ahmp_decoder.Decode(&raw_msg)
-			if err != nil {
-				p.ahmp_decoded_ch <- &ahmp.INVAL{Err: errors.Join(errors.New("parsing RST"), err)}
-				return
-			}
-			parsed_msg, err := raw_msg.TryParse()
-			if err != nil {
-				p.ahmp_decoded_ch <- &ahmp.INVAL{Err: errors.Join(errors.New("parsing RST"), err)}
-				return
-			}
-			p.ahmp_decoded_ch <- parsed_msg
-		case ahmp.SOA_T:
-			//fmt.Println("receiving SOA")
-			var raw_msg ahmp.RawSOA
-			err = p.ahmp_decoder.Decode(&raw_msg)
-			if err != nil {
-				p.ahmp_decoded_ch <- &ahmp.INVAL{Err: errors.Join(errors.New("parsing SOA"), err)}
-				return
-			}
-			parsed_msg, err := raw_msg.TryParse()
-			if err != nil {
-				p.ahmp_decoded_ch <- &ahmp.INVAL{Err: errors.Join(errors.New("parsing SOA"), err)}
-				return
-			}
-			p.ahmp_decoded_ch <- parsed_msg
-		case ahmp.SOD_T:
-			//fmt.Println("receiving SOD")
-			var raw_msg ahmp.RawSOD
-			err = p.ahmp_decoder.Decode(&raw_msg)
-			if err != nil {
-				p.ahmp_decoded_ch <- &ahmp.INVAL{Err: errors.Join(errors.New("parsing SOD"), err)}
-				return
-			}
-			parsed_msg, err := raw_msg.TryParse()
-			if err != nil {
-				p.ahmp_decoded_ch <- &ahmp.INVAL{Err: errors.Join(errors.New("parsing SOD"), err)}
-				return
-			}
-			p.ahmp_decoded_ch <- parsed_msg
-		default:
-			p.ahmp_decoded_ch <- &ahmp.INVAL{Err: errors.New("unknown AHMP message type")}
+		ahmp_type := frame.Type
+
+		//fmt.Println(connection.LocalAddr().String() + " < " + connection.RemoteAddr().String() + " " + strconv.Itoa(ahmp_type))
+		parsed_msg, parse_err := ahmp.ParseFrame(&frame, compact)
+		switch {
+		case errors.Is(parse_err, ahmp.ErrUnknownType):
+			//a peer of a newer version may send types that this build does not know. the frame is skipped as a whole.
+			watchdog.Warn("skipping unknown AHMP message type " + strconv.Itoa(ahmp_type))
+			continue
+		case parse_err != nil:
+			p.ahmp_decoded_ch <- &ahmp.INVAL{Err: errors.Join(errors.New("parsing "+ahmp.Name(ahmp_type)), parse_err)}
 			return
 		}
+		if !admit(ahmp_type, parsed_msg) {
+			continue
+		}
+
+		switch message := parsed_msg.(type) {
+		case *ahmp.RAR, *ahmp.HPR, *ahmp.HPS:
+			on_netmsg(parsed_msg)
+			continue
+		case *ahmp.JOK:
+			//recorded before an HPS that follows on the stream is handled.
+			p.recordIntroductions(p.introductions_received, message.Neighbors...)
+		case *ahmp.JNI:
+			p.recordIntroductions(p.introductions_received, message.Neighbor)
+		}
+		p.ahmp_decoded_ch <- parsed_msg
 	}
 }
@@ -7,46 +7,76 @@ import (
 
 	"github.com/fxamacker/cbor/v2"
 	"github.com/quic-go/quic-go"
+
+	abyss "github.com/MinwooWebeng/abyss_core/interfaces"
 )
 
 func (h *BetaNetService) PrepareAbyssOutbound(target *ContextedPeer, addresses []*net.UDPAddr) {
+	h.prepareAbyssOutbound(target, addresses, func(preferred_address *net.UDPAddr) (quic.Connection, *net.UDPAddr, error) {
+		address_selected := preferAddress(h.addressSelector.FilterAddressCandidates(addresses), preferred_address)
+		return h.raceDial(target.ctx, address_selected, h.abyssTlsConf)
+	})
+}
+
+// prepareAbyssOutbound establishes a connection with dial, and runs the outbound handshake on it.
+// dial returns the connected address, or nil if the connection is not direct.
+func (h *BetaNetService) prepareAbyssOutbound(target *ContextedPeer, addresses []*net.UDPAddr, dial func(preferred_address *net.UDPAddr) (quic.Connection, *net.UDPAddr, error)) {
 	//watchdog.Info("outbound detected")
+	target.mtx.Lock()
+	switch {
+	case target.state == PNCS_CONNECTED, target.dialing:
+		target.mtx.Unlock()
+		return
+	case target.state == PNCS_CLOSED:
+		target._reset()
+	}
+	target.dialing = true
+	preferred_address := target.preferred_address
+	target.mtx.Unlock()
+
 	var connection quic.Connection
+	var connected_address *net.UDPAddr
 	var ahmp_encoder *cbor.Encoder
+	var ahmp_decoder *cbor.Decoder
+	var version int
+	var capabilities abyss.PeerCapability
 	var err error
 
 	defer func() {
 		target.mtx.Lock()
 		defer target.mtx.Unlock()
 
+		target.dialing = false
 		if err != nil {
+			if connection != nil {
+				connection.CloseWithError(ABYSS_AHMP_FAILED, ABYSS_AHMP_FAILED_M)
+			}
+			if target.state == PNCS_CONNECTED {
+				return //we lost the tie-break, or a stray failure. must not break the established connection.
+			}
 			if target.err == nil {
 				target.err = err
 			}
 			target.state = PNCS_CLOSED
-		} else {
-			switch target.state {
-			case PNCS_DISCONNECTED:
-				target.state = PNCS_OUTBOUND
-				target.outbound_conn = connection
-				target.addresses = append(target.addresses, addresses...)
-				target.ahmp_encoder = ahmp_encoder
-			case PNCS_INBOUND:
-				target.state = PNCS_CONNECTED
-				target.outbound_conn = connection
-				target.addresses = append(target.addresses, addresses...)
-				target.ahmp_encoder = ahmp_encoder
-				h.abyssPeerCH <- target
-			case PNCS_OUTBOUND, PNCS_CONNECTED:
-				connection.CloseWithError(ABYSS_ALREADY_CONNECTED, ABYSS_ALREADY_CONNECTED_M)
-			case PNCS_CLOSED:
-				connection.CloseWithError(ABYSS_EARLY_RECONNECTION, ABYSS_EARLY_RECONNECTION_M)
+			h._startReconnect(target)
+			return
+		}
+
+		switch target.state {
+		case PNCS_DISCONNECTED, PNCS_CLOSED:
+			target._reset()
+			target._appendAddresses(addresses)
+			if connected_address != nil {
+				target.preferred_address = connected_address
 			}
+			h._adopt(target, connection, ahmp_encoder, ahmp_decoder, version, capabilities)
+		case PNCS_CONNECTED:
+			//the remote side's connection was taken while we were dialing.
+			connection.CloseWithError(ABYSS_ALREADY_CONNECTED, ABYSS_ALREADY_CONNECTED_M)
 		}
 	}()
 
-	address_selected := h.addressSelector.FilterAddressCandidates(addresses)
-	connection, err = h.quicTransport.Dial(target.ctx, address_selected[0], h.abyssTlsConf, h.quicConf)
+	connection, connected_address, err = dial(preferred_address)
 	if err != nil {
 		return
 	}
@@ -60,7 +90,7 @@ func (h *BetaNetService) PrepareAbyssOutbound(target *ContextedPeer, addresses [
 		return
 	}
 	ahmp_encoder = cbor.NewEncoder(ahmp_stream)
-	ahmp_decoder := cbor.NewDecoder(ahmp_stream)
+	ahmp_decoder = cbor.NewDecoder(ahmp_stream)
 
 	//send {local peer_hash, local tls-abyss binding cert} encrypted with remote handshake key.
 	var handshake_1_buf bytes.Buffer
@@ -76,14 +106,29 @@ func (h *BetaNetService) PrepareAbyssOutbound(target *ContextedPeer, addresses [
 	if err != nil {
 		return
 	}
+	if err = h.sendHello(ahmp_encoder); err != nil {
+		return
+	}
 
-	//receive accepter-side self-authentication
+	//receive accepter-side self-authentication.
+	//the accepter closes the connection instead, if it keeps its own connection by the tie-break.
 	var handshake_2_payload []byte
-	if err := ahmp_decoder.Decode(&handshake_2_payload); err != nil {
+	if err = ahmp_decoder.Decode(&handshake_2_payload); err != nil {
 		return
 	}
 	handshake_2_payload_x509, err := x509.ParseCertificate(handshake_2_payload)
-	if err := target.identity.VerifyTLSBinding(handshake_2_payload_x509, client_tls_cert); err != nil {
+	if err != nil {
+		return
+	}
+	if err = target.identity.VerifyTLSBinding(handshake_2_payload_x509, client_tls_cert); err != nil {
+		return
+	}
+	remote_hello, err := receiveHello(ahmp_decoder)
+	if err != nil {
+		return
+	}
+	if version, capabilities, err = h.negotiate(remote_hello, connection); err != nil {
+		connection.CloseWithError(ABYSS_VERSION_MISMATCH, ABYSS_VERSION_MISMATCH_M)
 		return
 	}
 
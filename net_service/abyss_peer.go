@@ -2,6 +2,7 @@ package net_service
 
 import (
 	"net"
+	"slices"
 	"sync"
 	"time"
 
@@ -13,7 +14,6 @@ import (
 	"github.com/MinwooWebeng/abyss_core/aurl"
 	abyss "github.com/MinwooWebeng/abyss_core/interfaces"
 	"github.com/MinwooWebeng/abyss_core/tools/functional"
-	"github.com/MinwooWebeng/abyss_core/watchdog"
 )
 
 // Peer Network Complex State
@@ -21,22 +21,28 @@ type PNCState int
 
 const (
 	PNCS_DISCONNECTED PNCState = iota
-	PNCS_INBOUND
-	PNCS_OUTBOUND
 	PNCS_CONNECTED
 	PNCS_CLOSED
 )
 
 type AbyssPeer struct {
-	state           PNCState     //can be checked without entering mtx only after once its state becomes PNCS_CONNECTED
-	identity        PeerIdentity //must be set at creation
-	addresses       []*net.UDPAddr
-	inbound_conn    quic.Connection
-	outbound_conn   quic.Connection
-	ahmp_encoder    *cbor.Encoder
-	ahmp_decoder    *cbor.Decoder //only listenAhmp() reads from this
-	ahmp_decoded_ch chan any
-	err             error
+	state             PNCState     //must be read with mtx held. a closed peer goes back to PNCS_DISCONNECTED on reconnection
+	identity          PeerIdentity //must be set at creation
+	addresses         []*net.UDPAddr
+	preferred_address *net.UDPAddr         //the address that the last outbound connection was established with
+	conn              quic.Connection      //single connection, either dialed or accepted. AHMP runs both ways.
+	send_queue        *sendQueue           //AHMP messages are written by its goroutine
+	ahmp_decoder      *cbor.Decoder        //only listenAhmp() reads from this
+	version           int                  //negotiated AHMP version
+	capabilities      abyss.PeerCapability //supported by both sides
+	dialing           bool                 //PrepareAbyssOutbound is running
+	ahmp_decoded_ch   chan any
+	err               error
+	reconnecting      bool     //reconnectLoop is running
+	relays            []string //hashes of the peers that introduced this peer. they may relay for it.
+
+	introductions_sent     map[string]bool //peers that we introduced to this peer, in JOK or JNI. see onHolePunchRequest.
+	introductions_received map[string]bool //peers that this peer introduced to us, in JOK or JNI. see holePunch.
 
 	mtx sync.Mutex //for peer component changes.
 }
@@ -47,6 +53,9 @@ func NewAbyssPeer(identity PeerIdentity) *AbyssPeer {
 		identity:        identity,
 		addresses:       make([]*net.UDPAddr, 0),
 		ahmp_decoded_ch: make(chan any, 32),
+
+		introductions_sent:     make(map[string]bool),
+		introductions_received: make(map[string]bool),
 	}
 }
 
@@ -76,135 +85,231 @@ func (p *AbyssPeer) IsConnected() bool {
 
 	return p.state == PNCS_CONNECTED
 }
+
+// _reset drops the connections of a closed peer so that it can be reconnected.
+// must be called with p.mtx held.
+func (p *AbyssPeer) _reset() {
+	if p.conn != nil {
+		p.conn.CloseWithError(ABYSS_PAIR_CLOSED, ABYSS_PAIR_CLOSED_M)
+	}
+	p.state = PNCS_DISCONNECTED
+	p.conn = nil
+	p.send_queue = nil
+	p.ahmp_decoder = nil
+	p.version = 0
+	p.capabilities = 0
+	p.err = nil
+}
+
+// _appendAddresses appends addresses that are not already known.
+// must be called with p.mtx held.
+func (p *AbyssPeer) _appendAddresses(addresses []*net.UDPAddr) {
+	for _, address := range addresses {
+		if !slices.ContainsFunc(p.addresses, func(known *net.UDPAddr) bool {
+			return known.String() == address.String()
+		}) {
+			p.addresses = append(p.addresses, address)
+		}
+	}
+}
+
+// observedAddresses returns the remote address of the current connection first, then the other known addresses.
+func (p *AbyssPeer) observedAddresses() []*net.UDPAddr {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	result := make([]*net.UDPAddr, 0, len(p.addresses)+1)
+	if p.conn != nil {
+		if address, ok := p.conn.RemoteAddr().(*net.UDPAddr); ok { //not relayed
+			result = append(result, address)
+		}
+	}
+	for _, address := range p.addresses {
+		if !slices.ContainsFunc(result, func(known *net.UDPAddr) bool {
+			return known.String() == address.String()
+		}) {
+			result = append(result, address)
+		}
+	}
+	return result
+}
+
 func (p *AbyssPeer) AhmpCh() chan any {
 	return p.ahmp_decoded_ch
 }
 
-func (p *ContextedPeer) _trySend(v any) bool {
-	if p.state != PNCS_CONNECTED {
+// TrySend queues the AHMP message, which must be of a registered type. It never blocks.
+// returns false if the peer is not connected, or the message is dropped by the send queue.
+func (p *ContextedPeer) TrySend(message any) bool {
+	p.mtx.Lock()
+	queue := p.send_queue
+	connected := p.state == PNCS_CONNECTED
+	p.mtx.Unlock()
+	if !connected || queue == nil {
 		return false
 	}
 
-	err := p.ahmp_encoder.Encode(v)
-	if err != nil {
-		p.mtx.Lock()
-		p.state = PNCS_CLOSED
-		p.err = err
-		p.mtx.Unlock()
+	return queue.send(message)
+}
+
+func fullSessionIdentity(session abyss.ANDPeerSessionWithTimeStamp) abyss.ANDFullPeerSessionIdentity {
+	return abyss.ANDFullPeerSessionIdentity{
+		AURL:                       session.Peer.AURL(),
+		SessionID:                  session.PeerSessionID,
+		TimeStamp:                  session.TimeStamp,
+		RootCertificateDer:         session.Peer.RootCertificateDer(),
+		HandshakeKeyCertificateDer: session.Peer.HandshakeKeyCertificateDer(),
+	}
+}
 
-		p.cancelfunc()
-		return false
+// recordIntroductions adds the neighbors to the introductions of the peer, which must be one of its introduction maps.
+func (p *AbyssPeer) recordIntroductions(introductions map[string]bool, neighbors ...abyss.ANDFullPeerSessionIdentity) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	for _, neighbor := range neighbors {
+		introductions[neighbor.AURL.Hash] = true
 	}
-	return true
 }
-func (p *ContextedPeer) _trySend2(v int, w any) bool {
-	//debug
-	watchdog.InfoV(ahmp.Msg_type_names[v]+"> "+p.inbound_conn.RemoteAddr().String(), w)
-	type_sent := p._trySend(v)
-	body_sent := p._trySend(w)
-	return type_sent && body_sent
+
+// introduced reports whether the peer is in the introductions of p.
+func (p *AbyssPeer) introduced(introductions map[string]bool, peer_hash string) bool {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	return introductions[peer_hash]
 }
 
 func (p *ContextedPeer) TrySendJN(local_session_id uuid.UUID, path string, timestamp time.Time) bool {
-	return p._trySend2(ahmp.JN_T, ahmp.RawJN{
-		SenderSessionID: local_session_id.String(),
+	return p.TrySend(&ahmp.JN{
+		SenderSessionID: local_session_id,
 		Text:            path,
-		TimeStamp:       timestamp.UnixMilli(),
+		TimeStamp:       timestamp,
 	})
 }
 func (p *ContextedPeer) TrySendJOK(local_session_id uuid.UUID, peer_session_id uuid.UUID, timestamp time.Time, world_url string, member_sessions []abyss.ANDPeerSessionWithTimeStamp) bool {
-	return p._trySend2(ahmp.JOK_T, ahmp.RawJOK{
-		SenderSessionID: local_session_id.String(),
-		RecverSessionID: peer_session_id.String(),
-		TimeStamp:       timestamp.UnixMilli(),
+	neighbors := functional.Filter(member_sessions, fullSessionIdentity)
+	p.recordIntroductions(p.introductions_sent, neighbors...)
+	return p.TrySend(&ahmp.JOK{
+		SenderSessionID: local_session_id,
+		RecverSessionID: peer_session_id,
+		TimeStamp:       timestamp,
 		Text:            world_url,
-		Neighbors: functional.Filter(member_sessions, func(session abyss.ANDPeerSessionWithTimeStamp) ahmp.RawSessionInfoForDiscovery {
-			return ahmp.RawSessionInfoForDiscovery{
-				AURL:                       session.Peer.AURL().ToString(),
-				SessionID:                  session.PeerSessionID.String(),
-				TimeStamp:                  session.TimeStamp.UnixMilli(),
-				RootCertificateDer:         session.Peer.RootCertificateDer(),
-				HandshakeKeyCertificateDer: session.Peer.HandshakeKeyCertificateDer(),
-			}
-		}),
+		Neighbors:       neighbors,
 	})
 }
 func (p *ContextedPeer) TrySendJDN(peer_session_id uuid.UUID, code int, message string) bool {
-	return p._trySend2(ahmp.JDN_T, ahmp.RawJDN{
-		RecverSessionID: peer_session_id.String(),
+	return p.TrySend(&ahmp.JDN{
+		RecverSessionID: peer_session_id,
 		Text:            message,
 		Code:            code,
 	})
 }
 func (p *ContextedPeer) TrySendJNI(local_session_id uuid.UUID, peer_session_id uuid.UUID, member_session abyss.ANDPeerSessionWithTimeStamp) bool {
-	return p._trySend2(ahmp.JNI_T, ahmp.RawJNI{
-		SenderSessionID: local_session_id.String(),
-		RecverSessionID: peer_session_id.String(),
-		Neighbor: ahmp.RawSessionInfoForDiscovery{
-			AURL:                       member_session.Peer.AURL().ToString(),
-			SessionID:                  member_session.PeerSessionID.String(),
-			TimeStamp:                  member_session.TimeStamp.UnixMilli(),
-			RootCertificateDer:         member_session.Peer.RootCertificateDer(),
-			HandshakeKeyCertificateDer: member_session.Peer.HandshakeKeyCertificateDer(),
-		},
+	neighbor := fullSessionIdentity(member_session)
+	p.recordIntroductions(p.introductions_sent, neighbor)
+	return p.TrySend(&ahmp.JNI{
+		SenderSessionID: local_session_id,
+		RecverSessionID: peer_session_id,
+		Neighbor:        neighbor,
 	})
 }
 func (p *ContextedPeer) TrySendMEM(local_session_id uuid.UUID, peer_session_id uuid.UUID, timestamp time.Time) bool {
-	return p._trySend2(ahmp.MEM_T, ahmp.RawMEM{
-		SenderSessionID: local_session_id.String(),
-		RecverSessionID: peer_session_id.String(),
-		TimeStamp:       timestamp.UnixMilli(),
+	return p.TrySend(&ahmp.MEM{
+		SenderSessionID: local_session_id,
+		RecverSessionID: peer_session_id,
+		TimeStamp:       timestamp,
 	})
 }
 func (p *ContextedPeer) TrySendSJN(local_session_id uuid.UUID, peer_session_id uuid.UUID, member_sessions []abyss.ANDPeerSessionIdentity) bool {
-	return p._trySend2(ahmp.SJN_T, ahmp.RawSJN{
-		SenderSessionID: local_session_id.String(),
-		RecverSessionID: peer_session_id.String(),
-		MemberInfos: functional.Filter(member_sessions, func(i abyss.ANDPeerSessionIdentity) ahmp.RawSessionInfoForSJN {
-			return ahmp.RawSessionInfoForSJN{
-				PeerHash:  i.PeerHash,
-				SessionID: i.SessionID.String(),
-			}
-		}),
+	return p.TrySend(&ahmp.SJN{
+		SenderSessionID: local_session_id,
+		RecverSessionID: peer_session_id,
+		MemberInfos:     member_sessions,
 	})
 }
 func (p *ContextedPeer) TrySendCRR(local_session_id uuid.UUID, peer_session_id uuid.UUID, member_sessions []abyss.ANDPeerSessionIdentity) bool {
-	return p._trySend2(ahmp.CRR_T, ahmp.RawCRR{
-		SenderSessionID: local_session_id.String(),
-		RecverSessionID: peer_session_id.String(),
-		MemberInfos: functional.Filter(member_sessions, func(i abyss.ANDPeerSessionIdentity) ahmp.RawSessionInfoForSJN {
-			return ahmp.RawSessionInfoForSJN{
-				PeerHash:  i.PeerHash,
-				SessionID: i.SessionID.String(),
-			}
-		}),
+	return p.TrySend(&ahmp.CRR{
+		SenderSessionID: local_session_id,
+		RecverSessionID: peer_session_id,
+		MemberInfos:     member_sessions,
 	})
 }
 func (p *ContextedPeer) TrySendRST(local_session_id uuid.UUID, peer_session_id uuid.UUID, message string) bool {
-	return p._trySend2(ahmp.RST_T, ahmp.RawRST{
-		SenderSessionID: local_session_id.String(),
-		RecverSessionID: peer_session_id.String(),
+	return p.TrySend(&ahmp.RST{
+		SenderSessionID: local_session_id,
+		RecverSessionID: peer_session_id,
+		Message:         message,
+	})
+}
+func (p *ContextedPeer) TrySendRSR(local_session_id uuid.UUID, peer_session_id uuid.UUID, code int, message string) bool {
+	return p.TrySend(&ahmp.RSR{
+		SenderSessionID: local_session_id,
+		RecverSessionID: peer_session_id,
+		Code:            code,
 		Message:         message,
 	})
 }
 
 func (p *ContextedPeer) TrySendSOA(local_session_id uuid.UUID, peer_session_id uuid.UUID, objects []abyss.ObjectInfo) bool {
-	return p._trySend2(ahmp.SOA_T, ahmp.RawSOA{
-		SenderSessionID: local_session_id.String(),
-		RecverSessionID: peer_session_id.String(),
-		Objects: functional.Filter(objects, func(u abyss.ObjectInfo) ahmp.RawObjectInfo {
-			return ahmp.RawObjectInfo{
-				ID:        u.ID.String(),
-				Address:   u.Addr,
-				Transform: u.Transform,
-			}
-		}),
+	return p.TrySend(&ahmp.SOA{
+		SenderSessionID: local_session_id,
+		RecverSessionID: peer_session_id,
+		Objects:         objects,
 	})
 }
 func (p *ContextedPeer) TrySendSOD(local_session_id uuid.UUID, peer_session_id uuid.UUID, objectIDs []uuid.UUID) bool {
-	return p._trySend2(ahmp.SOD_T, ahmp.RawSOD{
-		SenderSessionID: local_session_id.String(),
-		RecverSessionID: peer_session_id.String(),
-		ObjectIDs:       functional.Filter(objectIDs, func(u uuid.UUID) string { return u.String() }),
+	return p.TrySend(&ahmp.SOD{
+		SenderSessionID: local_session_id,
+		RecverSessionID: peer_session_id,
+		ObjectIDs:       objectIDs,
+	})
+}
+func (p *ContextedPeer) TrySendSOU(local_session_id uuid.UUID, peer_session_id uuid.UUID, updates []abyss.ObjectUpdate) bool {
+	return p.TrySend(&ahmp.SOU{
+		SenderSessionID: local_session_id,
+		RecverSessionID: peer_session_id,
+		Updates:         updates,
+	})
+}
+func (p *ContextedPeer) TrySendMSG(local_session_id uuid.UUID, peer_session_id uuid.UUID, topic string, payload []byte) bool {
+	return p.TrySend(&ahmp.MSG{
+		SenderSessionID: local_session_id,
+		RecverSessionID: peer_session_id,
+		Topic:           topic,
+		Payload:         payload,
+	})
+}
+func (p *ContextedPeer) TrySendOWR(local_session_id uuid.UUID, peer_session_id uuid.UUID, object_id uuid.UUID, timestamp time.Time) bool {
+	return p.TrySend(&ahmp.OWR{
+		SenderSessionID: local_session_id,
+		RecverSessionID: peer_session_id,
+		ObjectID:        object_id,
+		TimeStamp:       timestamp,
+	})
+}
+func (p *ContextedPeer) TrySendOHO(local_session_id uuid.UUID, peer_session_id uuid.UUID, handover abyss.ObjectHandover) bool {
+	return p.TrySend(&ahmp.OHO{
+		SenderSessionID: local_session_id,
+		RecverSessionID: peer_session_id,
+		Handover:        handover,
+	})
+}
+
+func (p *ContextedPeer) TrySendRAR(observed_address *net.UDPAddr) bool {
+	return p.TrySend(&ahmp.RAR{
+		Address: observed_address,
+	})
+}
+func (p *ContextedPeer) TrySendHPR(peer_hash string) bool {
+	return p.TrySend(&ahmp.HPR{
+		PeerHash: peer_hash,
+	})
+}
+func (p *ContextedPeer) TrySendHPS(peer_hash string, addresses []*net.UDPAddr, start_time time.Time) bool {
+	return p.TrySend(&ahmp.HPS{
+		PeerHash:  peer_hash,
+		Addresses: addresses,
+		StartTime: start_time,
 	})
 }
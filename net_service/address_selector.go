@@ -7,8 +7,9 @@ import (
 )
 
 type BetaAddressSelector struct {
-	localPrivateAddr net.IP
-	localPublicAddr  net.IP //can be added later
+	localPrivateAddr net.IP       //primary local address. IPv4 if available.
+	localAddrs       []net.IPAddr //all usable local unicast addresses, IPv4 first. link-local IPv6 addresses have zone.
+	localPublicAddr  net.IP       //reflexive address reported by peers, set by SetPublicIP
 
 	mtx *sync.Mutex
 }
@@ -19,7 +20,13 @@ func NewBetaAddressSelector() (*BetaAddressSelector, error) {
 		return nil, err
 	}
 
+	v4_addrs := make([]net.IPAddr, 0)
+	v6_addrs := make([]net.IPAddr, 0)
 	for _, i := range interfaces {
+		if i.Flags&net.FlagUp == 0 {
+			continue
+		}
+
 		addrs, err := i.Addrs()
 		if err != nil {
 			return nil, err
@@ -35,22 +42,36 @@ func NewBetaAddressSelector() (*BetaAddressSelector, error) {
 				ip = v.IP
 			}
 
-			// Skip loopback and non-IPv4 addresses
-			if ip == nil || ip.IsLoopback() || ip.To4() == nil || ip.IsLinkLocalUnicast() {
+			// Skip loopback, multicast, and IPv4 link-local addresses
+			if ip == nil || ip.IsLoopback() || ip.IsMulticast() || ip.IsUnspecified() {
 				continue
 			}
-
-			//fmt.Println("ffff: " + ip.String())
-
-			return &BetaAddressSelector{
-				ip,
-				net.IPv4zero,
-				new(sync.Mutex),
-			}, nil
+			if ip4 := ip.To4(); ip4 != nil {
+				if ip4.IsLinkLocalUnicast() {
+					continue
+				}
+				v4_addrs = append(v4_addrs, net.IPAddr{IP: ip4})
+				continue
+			}
+			if ip.IsLinkLocalUnicast() {
+				v6_addrs = append(v6_addrs, net.IPAddr{IP: ip, Zone: i.Name})
+				continue
+			}
+			v6_addrs = append(v6_addrs, net.IPAddr{IP: ip})
 		}
 	}
 
-	return nil, errors.New("no network interface available")
+	local_addrs := append(v4_addrs, v6_addrs...)
+	if len(local_addrs) == 0 {
+		return nil, errors.New("no network interface available")
+	}
+
+	return &BetaAddressSelector{
+		local_addrs[0].IP,
+		local_addrs,
+		net.IPv4zero,
+		new(sync.Mutex),
+	}, nil
 }
 
 func (s *BetaAddressSelector) SetPublicIP(ip net.IP) {
@@ -63,24 +84,95 @@ func (s *BetaAddressSelector) LocalPrivateIPAddr() net.IP {
 	return s.localPrivateAddr
 }
 
+func (s *BetaAddressSelector) LocalIPAddrs() []net.IPAddr {
+	return s.localAddrs
+}
+
+// hasFamily reports whether a local address of the family (and, for IPv6, the scope) exists.
+func (s *BetaAddressSelector) hasFamily(is_v4 bool, is_link_local bool) bool {
+	for _, local := range s.localAddrs {
+		if (local.IP.To4() != nil) != is_v4 {
+			continue
+		}
+		if !is_v4 && local.IP.IsLinkLocalUnicast() != is_link_local {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// linkLocalZone returns the zone of the first local link-local IPv6 address.
+// the zone in a remote AURL names the remote's interface, so it is replaced with ours.
+func (s *BetaAddressSelector) linkLocalZone() string {
+	for _, local := range s.localAddrs {
+		if local.IP.To4() == nil && local.IP.IsLinkLocalUnicast() {
+			return local.Zone
+		}
+	}
+	return ""
+}
+
+func (s *BetaAddressSelector) isLocal(ip net.IP) bool {
+	for _, local := range s.localAddrs {
+		if local.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// preferFamily orders addresses so that the preferred family comes first, keeping relative order.
+func preferFamily(addresses []*net.UDPAddr, prefer_v6 bool) []*net.UDPAddr {
+	preferred := make([]*net.UDPAddr, 0, len(addresses))
+	others := make([]*net.UDPAddr, 0, len(addresses))
+	for _, address := range addresses {
+		if (address.IP.To4() == nil) == prefer_v6 {
+			preferred = append(preferred, address)
+		} else {
+			others = append(others, address)
+		}
+	}
+	return append(preferred, others...)
+}
+
 func (s *BetaAddressSelector) FilterAddressCandidates(addresses []*net.UDPAddr) []*net.UDPAddr {
 	public_addresses := make([]*net.UDPAddr, 0)
-
-	var loopbackaddr *net.UDPAddr
-	var privateaddr *net.UDPAddr
+	private_addresses := make([]*net.UDPAddr, 0)
+	loopback_addresses := make([]*net.UDPAddr, 0)
 
 	for _, address := range addresses {
-		if address.IP.Equal(net.IPv4zero) || address.IP.Equal(net.IPv4bcast) {
+		if address.IP == nil || address.IP.IsUnspecified() || address.IP.IsMulticast() || address.IP.Equal(net.IPv4bcast) {
 			continue
 		}
 
-		if address.IP.Equal([]byte{127, 0, 0, 1}) {
-			loopbackaddr = address
+		if address.IP.IsLoopback() {
+			loopback_addresses = append(loopback_addresses, address)
 			continue
 		}
 
-		if address.IP[0] == 192 && address.IP[1] == 168 {
-			privateaddr = address
+		is_v4 := address.IP.To4() != nil
+		is_link_local := !is_v4 && address.IP.IsLinkLocalUnicast()
+		if !s.hasFamily(is_v4, is_link_local) {
+			continue //unreachable family
+		}
+
+		if is_link_local {
+			if s.isLocal(address.IP) {
+				continue
+			}
+			private_addresses = append(private_addresses, &net.UDPAddr{
+				IP:   address.IP,
+				Port: address.Port,
+				Zone: s.linkLocalZone(),
+			})
+			continue
+		}
+
+		if address.IP.IsPrivate() {
+			if !s.isLocal(address.IP) {
+				private_addresses = append(private_addresses, address)
+			}
 			continue
 		}
 
@@ -94,15 +186,10 @@ func (s *BetaAddressSelector) FilterAddressCandidates(addresses []*net.UDPAddr)
 		public_addresses = append(public_addresses, address)
 	}
 
-	if len(public_addresses) == 0 { //no public address found
-		if privateaddr != nil && !privateaddr.IP.Equal(s.localPrivateAddr) {
-			return []*net.UDPAddr{privateaddr}
-		}
-
-		if loopbackaddr != nil {
-			return []*net.UDPAddr{loopbackaddr}
-		}
-		return []*net.UDPAddr{}
-	}
-	return public_addresses
+	//prefer IPv6 if we have a non-link-local IPv6 address. the other family is kept as fallback.
+	//candidates are ordered public, private, loopback, so that they can be raced in this order.
+	prefer_v6 := s.hasFamily(false, false)
+	result := preferFamily(public_addresses, prefer_v6)
+	result = append(result, preferFamily(private_addresses, prefer_v6)...)
+	return append(result, preferFamily(loopback_addresses, prefer_v6)...)
 }
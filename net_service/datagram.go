@@ -0,0 +1,100 @@
+package net_service
+
+import (
+	"github.com/fxamacker/cbor/v2"
+	"github.com/google/uuid"
+	"github.com/quic-go/quic-go"
+
+	"github.com/MinwooWebeng/abyss_core/ahmp"
+	abyss "github.com/MinwooWebeng/abyss_core/interfaces"
+)
+
+// maximum transforms in a SOT datagram. keeps the datagram within the minimum QUIC packet size.
+const SOT_MAX_TRANSFORMS = 8
+
+// the last received sequences are forgotten when more than this many objects are tracked.
+// objects of ended sessions are never removed otherwise.
+const SOT_SEQUENCE_TABLE_SIZE = 4096
+
+// TrySendSOT sends the transforms in QUIC datagrams, without retransmission.
+func (p *ContextedPeer) TrySendSOT(local_session_id uuid.UUID, peer_session_id uuid.UUID, sequence uint64, transforms []abyss.ObjectTransform) bool {
+	p.mtx.Lock()
+	connection := p.conn
+	connected := p.state == PNCS_CONNECTED
+	compact := p.capabilities.Has(abyss.CAP_COMPRESSION)
+	p.mtx.Unlock()
+	if !connected {
+		return false
+	}
+
+	for start := 0; start < len(transforms); start += SOT_MAX_TRANSFORMS {
+		_, datagram, err := ahmp.EncodeFrame(&ahmp.SOT{
+			SenderSessionID: local_session_id,
+			RecverSessionID: peer_session_id,
+			Sequence:        sequence,
+			Transforms:      transforms[start:min(start+SOT_MAX_TRANSFORMS, len(transforms))],
+		}, compact)
+		if err != nil {
+			return false
+		}
+		if err := connection.SendDatagram(datagram); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+type sotKey struct {
+	sender_session_id uuid.UUID
+	object_id         uuid.UUID
+}
+
+// listenDatagrams reads the datagrams of the connection until it closes.
+// Only the transforms newer than the last received one of the same object are delivered.
+// The table of last received sequences is bounded by SOT_SEQUENCE_TABLE_SIZE.
+// Datagrams are dropped, instead of blocking, when AHMP messages are piling up.
+func (p *AbyssPeer) listenDatagrams(connection quic.Connection, compact bool, admit func(ahmp_type int, message any) bool) {
+	latest := make(map[sotKey]uint64)
+	for {
+		datagram, err := connection.ReceiveDatagram(connection.Context())
+		if err != nil {
+			return
+		}
+
+		var frame ahmp.RawFrame
+		if err := cbor.Unmarshal(datagram, &frame); err != nil || frame.Type != ahmp.SOT_T {
+			continue
+		}
+		parsed_any, err := ahmp.ParseFrame(&frame, compact)
+		if err != nil {
+			continue
+		}
+		parsed_msg := parsed_any.(*ahmp.SOT)
+
+		fresh := make([]abyss.ObjectTransform, 0, len(parsed_msg.Transforms))
+		for _, transform := range parsed_msg.Transforms {
+			key := sotKey{parsed_msg.SenderSessionID, transform.ID}
+			sequence, ok := latest[key]
+			if ok && sequence >= parsed_msg.Sequence {
+				continue
+			}
+			if !ok && len(latest) >= SOT_SEQUENCE_TABLE_SIZE {
+				clear(latest) //a reordered transform may be delivered once more after this.
+			}
+			latest[key] = parsed_msg.Sequence
+			fresh = append(fresh, transform)
+		}
+		if len(fresh) == 0 {
+			continue
+		}
+		parsed_msg.Transforms = fresh
+
+		if !admit(ahmp.SOT_T, parsed_msg) {
+			continue
+		}
+		select {
+		case p.ahmp_decoded_ch <- parsed_msg:
+		default:
+		}
+	}
+}
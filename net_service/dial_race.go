@@ -0,0 +1,100 @@
+package net_service
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// delay between the starts of two dial attempts (RFC 8305 Connection Attempt Delay)
+const DIAL_ATTEMPT_DELAY = time.Millisecond * 250
+
+type dialResult struct {
+	address    *net.UDPAddr
+	connection quic.Connection
+	err        error
+}
+
+// raceDial dials the candidates in the given order, with staggered starts.
+// A failed attempt starts the next one immediately.
+// The first established connection wins; the others are cancelled, or closed if they are established later.
+func (h *BetaNetService) raceDial(ctx context.Context, candidates []*net.UDPAddr, tls_conf *tls.Config) (quic.Connection, *net.UDPAddr, error) {
+	if len(candidates) == 0 {
+		return nil, nil, errors.New("no valid IP address")
+	}
+
+	race_ctx, race_cancel := context.WithCancel(ctx)
+	defer race_cancel()
+
+	result_ch := make(chan dialResult, len(candidates))
+	next := 0
+	running := 0
+	start := func() {
+		address := candidates[next]
+		next++
+		running++
+		go func() {
+			connection, err := h.quicTransport.Dial(race_ctx, address, tls_conf, h.quicConf)
+			result_ch <- dialResult{address: address, connection: connection, err: err}
+		}()
+	}
+
+	start()
+	timer := time.NewTimer(DIAL_ATTEMPT_DELAY)
+	defer timer.Stop()
+
+	errs := make([]error, 0, len(candidates))
+	for running > 0 {
+		var timer_ch <-chan time.Time
+		if next < len(candidates) {
+			timer_ch = timer.C
+		}
+
+		select {
+		case <-timer_ch:
+			start()
+			timer.Reset(DIAL_ATTEMPT_DELAY)
+		case result := <-result_ch:
+			running--
+			if result.err == nil {
+				race_cancel()
+				go func(remaining int) { //close the losers that were established anyway.
+					for range remaining {
+						loser := <-result_ch
+						if loser.err == nil {
+							loser.connection.CloseWithError(ABYSS_ALREADY_CONNECTED, ABYSS_ALREADY_CONNECTED_M)
+						}
+					}
+				}(running)
+				return result.connection, result.address, nil
+			}
+
+			errs = append(errs, errors.Join(errors.New(result.address.String()), result.err))
+			if next < len(candidates) {
+				start()
+				timer.Reset(DIAL_ATTEMPT_DELAY)
+			}
+		}
+	}
+	return nil, nil, errors.Join(errs...)
+}
+
+// preferAddress moves the address that worked last time to the front.
+func preferAddress(candidates []*net.UDPAddr, preferred *net.UDPAddr) []*net.UDPAddr {
+	if preferred == nil {
+		return candidates
+	}
+	result := make([]*net.UDPAddr, 0, len(candidates))
+	for _, candidate := range candidates {
+		if candidate.String() == preferred.String() {
+			result = append([]*net.UDPAddr{candidate}, result...)
+		} else {
+			result = append(result, candidate)
+		}
+	}
+	return result
+}
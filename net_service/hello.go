@@ -0,0 +1,61 @@
+package net_service
+
+import (
+	"errors"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/quic-go/quic-go"
+
+	"github.com/MinwooWebeng/abyss_core/ahmp"
+	abyss "github.com/MinwooWebeng/abyss_core/interfaces"
+)
+
+// the optional features this build supports.
+const LOCAL_CAPABILITIES = abyss.CAP_DATAGRAM | abyss.CAP_COMPRESSION | abyss.CAP_CUSTOM_MESSAGE
+
+var ErrVersionMismatch = errors.New("AHMP version mismatch")
+
+func (h *BetaNetService) sendHello(ahmp_encoder *cbor.Encoder) error {
+	return ahmp_encoder.Encode(ahmp.RawHello{
+		Version:      ahmp.AHMP_VERSION,
+		MinVersion:   ahmp.AHMP_MIN_VERSION,
+		Capabilities: uint64(h.localCapabilities),
+	})
+}
+
+func receiveHello(ahmp_decoder *cbor.Decoder) (*ahmp.Hello, error) {
+	var raw_hello ahmp.RawHello
+	if err := ahmp_decoder.Decode(&raw_hello); err != nil {
+		return nil, err
+	}
+	return raw_hello.TryParse()
+}
+
+// negotiate returns the highest version that both sides speak, and the capabilities that both support.
+// datagrams are also dropped if QUIC did not negotiate them for the connection.
+func (h *BetaNetService) negotiate(remote *ahmp.Hello, connection quic.Connection) (int, abyss.PeerCapability, error) {
+	version := min(ahmp.AHMP_VERSION, remote.Version)
+	if version < ahmp.AHMP_MIN_VERSION || version < remote.MinVersion {
+		return 0, 0, ErrVersionMismatch
+	}
+
+	capabilities := h.localCapabilities & remote.Capabilities
+	if !connection.ConnectionState().SupportsDatagrams {
+		capabilities &^= abyss.CAP_DATAGRAM
+	}
+	return version, capabilities, nil
+}
+
+func (p *AbyssPeer) ProtocolVersion() int {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	return p.version
+}
+
+func (p *AbyssPeer) Capabilities() abyss.PeerCapability {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	return p.capabilities
+}
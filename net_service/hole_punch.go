@@ -0,0 +1,96 @@
+package net_service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"time"
+)
+
+// delay from the hole punch request to the simultaneous dials. it should exceed the RTT to both sides.
+const HOLE_PUNCH_DELAY = time.Millisecond * 500
+
+// an HPS with a start time further than this is dialed after this.
+const HOLE_PUNCH_MAX_DELAY = time.Second * 5
+
+// RequestHolePunch asks the introducer, which is connected to both sides, to coordinate
+// simultaneous dials between us and the peer. Each side's outbound packets open its own NAT
+// for the other side, so that the dials can pass through NATs on both sides.
+func (h *BetaNetService) RequestHolePunch(introducer_hash string, peer_hash string) error {
+	introducer, ok := h.peers.Find(introducer_hash)
+	if !ok {
+		return errors.New("unknown peer")
+	}
+	if !introducer.IsConnected() {
+		return errors.New("introducer not connected")
+	}
+	if !introducer.TrySendHPR(peer_hash) {
+		return errors.New("failed to send hole punch request")
+	}
+	return nil
+}
+
+// onHolePunchRequest relays the observed addresses of the requester and the target to each other, with a common start time.
+// The request is served only if we introduced the target to the requester, and the IHolePunchAccepter,
+// if any, confirms that they share a world. Otherwise, any peer could learn the addresses of our peers,
+// and make them send traffic to arbitrary addresses.
+func (h *BetaNetService) onHolePunchRequest(requester *ContextedPeer, peer_hash string) {
+	target, ok := h.peers.Find(peer_hash)
+	if !ok || target == requester || !target.IsConnected() {
+		return
+	}
+	if !requester.introduced(requester.introductions_sent, peer_hash) {
+		return
+	}
+
+	h.hole_punch_accepter_mtx.Lock()
+	hole_punch_accepter := h.holePunchAccepter
+	h.hole_punch_accepter_mtx.Unlock()
+	if hole_punch_accepter != nil && !hole_punch_accepter.AcceptHolePunch(requester.IDHash(), peer_hash) {
+		return
+	}
+
+	start_time := time.Now().Add(HOLE_PUNCH_DELAY)
+	requester.TrySendHPS(target.IDHash(), target.observedAddresses(), start_time)
+	target.TrySendHPS(requester.IDHash(), requester.observedAddresses(), start_time)
+}
+
+// holePunch dials the peer at the start time given by the introducer.
+// An HPS for a peer that the introducer did not introduce to us is ignored.
+// If a dial to the peer is already running, it keeps sending to the peer, so no new dial is made.
+// The introducer is remembered as a relay candidate, in case hole punching fails.
+func (h *BetaNetService) holePunch(introducer *ContextedPeer, peer_hash string, addresses []*net.UDPAddr, start_time time.Time) {
+	if !introducer.introduced(introducer.introductions_received, peer_hash) {
+		return
+	}
+	if latest := time.Now().Add(HOLE_PUNCH_MAX_DELAY); start_time.After(latest) {
+		start_time = latest
+	}
+
+	//the introducer may tell us about the peer before AND registers it.
+	wait_ctx, wait_cancel := context.WithDeadline(h.ctx, start_time)
+	defer wait_cancel()
+	peer, err := h.peers.Wait(wait_ctx, peer_hash)
+	if err != nil {
+		return
+	}
+
+	peer.mtx.Lock()
+	if !slices.Contains(peer.relays, introducer.IDHash()) {
+		peer.relays = append(peer.relays, introducer.IDHash())
+	}
+	peer.mtx.Unlock()
+
+	select {
+	case <-h.ctx.Done():
+		return
+	case <-time.After(time.Until(start_time)):
+	}
+
+	candidate_addresses := h.addressSelector.FilterAddressCandidates(addresses)
+	if len(candidate_addresses) == 0 {
+		return
+	}
+	h.PrepareAbyssOutbound(peer, candidate_addresses)
+}
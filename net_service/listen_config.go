@@ -0,0 +1,102 @@
+package net_service
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"strconv"
+	"time"
+
+	abyss "github.com/MinwooWebeng/abyss_core/interfaces"
+)
+
+// BetaNetServiceConfig controls where BetaNetService listens, and whether it relays for other peers.
+// The zero value listens dual-stack on an ephemeral port, and does not relay.
+// The pending handshake limits default to PENDING_HANDSHAKE_TIMEOUT, PENDING_HANDSHAKE_MAX and PENDING_HANDSHAKE_MAX_PER_SOURCE.
+type BetaNetServiceConfig struct {
+	BindIP       net.IP         //nil or unspecified: all interfaces. IPv4 unspecified restricts to IPv4.
+	Port         int            //0: ephemeral port
+	PortRangeEnd int            //if Port is in use, Port+1 ... PortRangeEnd are tried in order.
+	PacketConn   net.PacketConn //if set, used as is; BindIP, Port and PortRangeEnd are ignored.
+
+	RelayBandwidth int //bytes per second for each relayed peer pair. 0: relaying for other peers is disabled.
+
+	MaxIdleTimeout time.Duration //a connection that receives nothing for this long is closed, and reconnected. 0: one hour
+
+	//inbound handshakes from peers that are not introduced yet. 0: default
+	PendingHandshakeTimeout         time.Duration
+	MaxPendingHandshakes            int
+	MaxPendingHandshakesPerSourceIP int
+
+	//token bucket limits. the zero RateLimit, or a missing AHMP type, is unlimited.
+	ConnectionRateLimitPerIP   RateLimit         //inbound connections from an IP address
+	ConnectionRateLimitPerPeer RateLimit         //inbound abyss connections of a peer
+	MessageRateLimitsPerIP     map[int]RateLimit //AHMP type -> limit for all peers on an IP address
+	MessageRateLimitsPerPeer   map[int]RateLimit //AHMP type -> limit for a peer
+
+	DisabledCapabilities abyss.PeerCapability //optional features not advertised in the handshake
+}
+
+func listenPacketConn(config *BetaNetServiceConfig) (net.PacketConn, error) {
+	if config.PacketConn != nil {
+		return config.PacketConn, nil
+	}
+
+	port_end := max(config.PortRangeEnd, config.Port)
+	if config.Port == 0 {
+		port_end = 0
+	}
+
+	var last_err error
+	for port := config.Port; port <= port_end; port++ {
+		conn, err := listenUDP(config.BindIP, port)
+		if err == nil {
+			return conn, nil
+		}
+		last_err = err
+	}
+	return nil, errors.Join(errors.New("no available port in "+strconv.Itoa(config.Port)+"-"+strconv.Itoa(port_end)), last_err)
+}
+
+func listenUDP(bind_ip net.IP, port int) (*net.UDPConn, error) {
+	if bind_ip == nil || bind_ip.Equal(net.IPv6unspecified) {
+		//dual-stack if possible. falls back to IPv4 only.
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv6unspecified, Port: port})
+		if err == nil {
+			return conn, nil
+		}
+		return net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero, Port: port})
+	}
+	if bind_ip.To4() != nil {
+		return net.ListenUDP("udp4", &net.UDPAddr{IP: bind_ip, Port: port})
+	}
+	return net.ListenUDP("udp6", &net.UDPAddr{IP: bind_ip, Port: port})
+}
+
+// localCandidates lists the address candidates of the local AURL for the listening address.
+// loopback is always the last one.
+func localCandidates(local_addr net.Addr, address_selector abyss.IAddressSelector) ([]*net.UDPAddr, error) {
+	addrport, err := netip.ParseAddrPort(local_addr.String())
+	if err != nil {
+		return nil, err
+	}
+	local_ip := net.IP(addrport.Addr().AsSlice())
+	local_port := int(addrport.Port())
+
+	if !local_ip.IsUnspecified() { //bound to a single address
+		return []*net.UDPAddr{{IP: local_ip, Port: local_port, Zone: addrport.Addr().Zone()}}, nil
+	}
+
+	dual_stack := local_ip.To4() == nil
+	result := make([]*net.UDPAddr, 0)
+	for _, ip := range address_selector.LocalIPAddrs() {
+		if !dual_stack && ip.IP.To4() == nil {
+			continue
+		}
+		result = append(result, &net.UDPAddr{IP: ip.IP, Port: local_port, Zone: ip.Zone})
+	}
+	if dual_stack {
+		result = append(result, &net.UDPAddr{IP: net.IPv6loopback, Port: local_port})
+	}
+	return append(result, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1).To4(), Port: local_port}), nil
+}
@@ -2,16 +2,19 @@ package net_service
 
 import (
 	"context"
+	"crypto"
 	"crypto/tls"
 	"encoding/pem"
 	"errors"
 	"net"
-	"strconv"
+	"sync"
 	"time"
 
+	"github.com/fxamacker/cbor/v2"
 	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/http3"
 
+	"github.com/MinwooWebeng/abyss_core/ahmp"
 	"github.com/MinwooWebeng/abyss_core/aurl"
 	abyss "github.com/MinwooWebeng/abyss_core/interfaces"
 )
@@ -19,26 +22,46 @@ import (
 type BetaNetService struct {
 	ctx context.Context
 
-	localIdentity   *RootSecrets
-	local_aurl      *aurl.AURL
-	addressSelector abyss.IAddressSelector
+	localIdentity    *RootSecrets
+	local_candidates []*net.UDPAddr //addresses of the bound socket, without reflexive address
+	local_aurl       *aurl.AURL     //replaced as a whole when the reflexive address changes
+	local_aurl_mtx   sync.Mutex
+	addressSelector  abyss.IAddressSelector
+	reflexive        *reflexiveReports
 
-	quicTransport *quic.Transport
-	tlsIdentity   *TLSIdentity
-	abyssTlsConf  *tls.Config
-	abystTlsConf  *tls.Config
-	quicConf      *quic.Config
+	quicTransport  *quic.Transport
+	relayConn      *relayPacketConn
+	relayTransport *quic.Transport //QUIC over relay streams. see relay_conn.go
+	relays         *relayTable
+	tlsIdentity    *TLSIdentity
+	abyssTlsConf   *tls.Config
+	abystTlsConf   *tls.Config
+	quicConf       *quic.Config
 
-	preAccepter abyss.IPreAccepter
+	localCapabilities abyss.PeerCapability //advertised in the handshake
 
-	peers *ContextedPeerMap
+	preAccepter      abyss.IPreAccepter
+	pre_accepter_mtx sync.Mutex
 
-	abyssPeerCH chan abyss.IANDPeer //before actually using the peer, each thread must check IsConnected()
+	holePunchAccepter       abyss.IHolePunchAccepter
+	hole_punch_accepter_mtx sync.Mutex
+
+	peers             *ContextedPeerMap
+	pendingHandshakes *pendingHandshakeTable
+	rateLimits        *rateLimits
+	sendQueueCounters *sendQueueCounters
+
+	abyssPeerCH      chan abyss.IANDPeer //before actually using the peer, each thread must check IsConnected()
+	abyssPeerCloseCH chan abyss.IANDPeer //a peer is sent here once for each connection that was sent to abyssPeerCH
 
 	abystServer *http3.Server
 }
 
 func NewBetaNetService(ctx context.Context, local_private_key PrivateKey, address_selector abyss.IAddressSelector, abyst_server *http3.Server) (*BetaNetService, error) {
+	return NewBetaNetServiceWithConfig(ctx, local_private_key, address_selector, abyst_server, &BetaNetServiceConfig{})
+}
+
+func NewBetaNetServiceWithConfig(ctx context.Context, local_private_key PrivateKey, address_selector abyss.IAddressSelector, abyst_server *http3.Server, config *BetaNetServiceConfig) (*BetaNetService, error) {
 	result := new(BetaNetService)
 
 	result.ctx = ctx
@@ -49,6 +72,7 @@ func NewBetaNetService(ctx context.Context, local_private_key PrivateKey, addres
 	}
 	result.localIdentity = root_secret
 	result.addressSelector = address_selector
+	result.reflexive = newReflexiveReports()
 
 	tls_identity, err := root_secret.NewTLSIdentity()
 	if err != nil {
@@ -57,27 +81,39 @@ func NewBetaNetService(ctx context.Context, local_private_key PrivateKey, addres
 	result.tlsIdentity = tls_identity
 	result.abyssTlsConf = NewDefaultTlsConf(tls_identity)
 
-	udpConn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero, Port: 0})
+	packet_conn, err := listenPacketConn(config)
 	if err != nil {
 		return nil, err
 	}
-	result.quicTransport = &quic.Transport{Conn: udpConn}
+	result.quicTransport = &quic.Transport{Conn: packet_conn}
+	result.relayConn = newRelayPacketConn(root_secret.IDHash(), result.onRelayLinkClosed)
+	result.relayTransport = &quic.Transport{Conn: result.relayConn}
+	result.relays = newRelayTable(config.RelayBandwidth)
 	result.quicConf = NewDefaultQuicConf()
+	if config.MaxIdleTimeout != 0 {
+		result.quicConf.MaxIdleTimeout = config.MaxIdleTimeout
+	}
+	result.localCapabilities = LOCAL_CAPABILITIES &^ config.DisabledCapabilities
 
-	local_port := strconv.Itoa(udpConn.LocalAddr().(*net.UDPAddr).Port)
-	local_ip := address_selector.LocalPrivateIPAddr().String()
-	local_aurl, err := aurl.TryParse("abyss:" +
-		root_secret.IDHash() +
-		":" + local_ip + ":" + local_port +
-		"|127.0.0.1:" + local_port)
+	local_candidates, err := localCandidates(packet_conn.LocalAddr(), address_selector)
 	if err != nil {
 		return nil, err
 	}
+	local_aurl := &aurl.AURL{
+		Scheme:    "abyss",
+		Hash:      root_secret.IDHash(),
+		Addresses: local_candidates,
+	}
+	result.local_candidates = local_candidates
 	result.local_aurl = local_aurl
 
 	result.peers = NewContextedPeerMap()
+	result.rateLimits = newRateLimits(config)
+	result.sendQueueCounters = new(sendQueueCounters)
+	result.pendingHandshakes = newPendingHandshakeTable(config.PendingHandshakeTimeout, config.MaxPendingHandshakes, config.MaxPendingHandshakesPerSourceIP)
 
 	result.abyssPeerCH = make(chan abyss.IANDPeer, 8)
+	result.abyssPeerCloseCH = make(chan abyss.IANDPeer, 8)
 
 	result.abystTlsConf = NewDefaultTlsConf(tls_identity)
 	result.abystTlsConf.NextProtos = []string{http3.NextProtoH3} //abyst only.
@@ -125,34 +161,216 @@ func (h *BetaNetService) LocalIdentity() abyss.IHostIdentity {
 	return h.localIdentity
 }
 func (h *BetaNetService) LocalAURL() *aurl.AURL {
+	h.local_aurl_mtx.Lock()
+	defer h.local_aurl_mtx.Unlock()
+
 	return h.local_aurl
 }
 
 func (h *BetaNetService) HandlePreAccept(preaccept_handler abyss.IPreAccepter) {
+	h.pre_accepter_mtx.Lock()
+	defer h.pre_accepter_mtx.Unlock()
+
 	h.preAccepter = preaccept_handler
 }
 
+func (h *BetaNetService) HandleHolePunch(hole_punch_accepter abyss.IHolePunchAccepter) {
+	h.hole_punch_accepter_mtx.Lock()
+	defer h.hole_punch_accepter_mtx.Unlock()
+
+	h.holePunchAccepter = hole_punch_accepter
+}
+
+// PendingHandshakes reports the inbound handshakes that are waiting for the peer to be introduced.
+func (h *BetaNetService) PendingHandshakes() PendingHandshakeStatistics {
+	return h.pendingHandshakes.statistics()
+}
+
+// RateLimited reports the rate limit violations.
+func (h *BetaNetService) RateLimited() RateLimitStatistics {
+	return h.rateLimits.statistics()
+}
+
+// SendQueues reports the messages that did not fit in the send queues.
+func (h *BetaNetService) SendQueues() SendQueueStatistics {
+	return h.sendQueueCounters.statistics()
+}
+
+func (h *BetaNetService) Statistics() string {
+	return h.pendingHandshakes.statistics().String() + "\n" +
+		h.rateLimits.statistics().String() + "\n" +
+		h.sendQueueCounters.statistics().String() + "\n"
+}
+
+// preAccept consults the IPreAccepter about an inbound connection.
+// If declined, the connection is closed with the returned status code and message.
+func (h *BetaNetService) preAccept(peer_hash string, connection quic.Connection) bool {
+	h.pre_accepter_mtx.Lock()
+	pre_accepter := h.preAccepter
+	h.pre_accepter_mtx.Unlock()
+	if pre_accepter == nil {
+		return true
+	}
+
+	address, _ := connection.RemoteAddr().(*net.UDPAddr) //nil if relayed
+	ok, code, message := pre_accepter.PreAccept(peer_hash, address)
+	if !ok {
+		connection.CloseWithError(quic.ApplicationErrorCode(code), message)
+	}
+	return ok
+}
+
+// abystPeerHash finds the connected peer that presented the same TLS key on its abyss connection.
+// returns "" for an unknown abyst client.
+func (h *BetaNetService) abystPeerHash(connection quic.Connection) string {
+	certs := connection.ConnectionState().TLS.PeerCertificates
+	if len(certs) == 0 {
+		return ""
+	}
+	tls_key, ok := certs[0].PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		return ""
+	}
+	for _, peer := range h.peers.Snapshot() {
+		peer.mtx.Lock()
+		peer_conn := peer.conn
+		peer.mtx.Unlock()
+		if peer_conn == nil {
+			continue
+		}
+		peer_certs := peer_conn.ConnectionState().TLS.PeerCertificates
+		if len(peer_certs) != 0 && tls_key.Equal(peer_certs[0].PublicKey) {
+			return peer.IDHash()
+		}
+	}
+	return ""
+}
+
 func (h *BetaNetService) ListenAndServe() error {
 	listener, err := h.quicTransport.Listen(h.abyssTlsConf, h.quicConf)
 	if err != nil {
 		return err
 	}
+	relay_listener, err := h.relayTransport.Listen(h.abyssTlsConf, h.quicConf)
+	if err != nil {
+		return err
+	}
 	//go h.constructingAbyssPeers(ctx)
 
+	go func() {
+		for {
+			connection, err := relay_listener.Accept(h.ctx)
+			if err != nil {
+				return
+			}
+			h.serveConnection(connection)
+		}
+	}()
+
 	for {
 		connection, err := listener.Accept(h.ctx)
 		if err != nil {
+			h.closeAllPeers()
 			return err
 		}
-		switch connection.ConnectionState().TLS.NegotiatedProtocol {
-		case abyss.NextProtoAbyss:
-			go h.PrepareAbyssInbound(h.ctx, connection)
-		case http3.NextProtoH3:
-			go h.abystServer.ServeQUICConn(connection)
-		default:
-			connection.CloseWithError(0, "unknown TLS ALPN protocol ID")
+		h.serveConnection(connection)
+	}
+}
+
+func (h *BetaNetService) serveConnection(connection quic.Connection) {
+	if !h.rateLimits.allowConnectionFrom(connection.RemoteAddr()) {
+		connection.CloseWithError(ABYSS_RATE_LIMITED, ABYSS_RATE_LIMITED_M)
+		return
+	}
+	switch connection.ConnectionState().TLS.NegotiatedProtocol {
+	case abyss.NextProtoAbyss:
+		go h.PrepareAbyssInbound(h.ctx, connection)
+	case http3.NextProtoH3:
+		go func() {
+			if h.preAccept(h.abystPeerHash(connection), connection) {
+				h.abystServer.ServeQUICConn(connection)
+			}
+		}()
+	default:
+		connection.CloseWithError(0, "unknown TLS ALPN protocol ID")
+	}
+}
+
+// closeAllPeers notifies every connected peer that this service is going away.
+func (h *BetaNetService) closeAllPeers() {
+	for _, peer := range h.peers.Snapshot() {
+		peer.mtx.Lock()
+		if peer.conn != nil {
+			peer.conn.CloseWithError(ABYSS_SERVICE_CLOSED, ABYSS_SERVICE_CLOSED_M)
+		}
+		peer.mtx.Unlock()
+	}
+	h.quicTransport.Close()
+	h.relayConn.Close()
+	h.relayTransport.Close()
+}
+
+// _adopt makes the handshaked connection the peer's AHMP connection, and publishes the peer.
+// must be called with peer.mtx held.
+func (h *BetaNetService) _adopt(peer *ContextedPeer, connection quic.Connection, ahmp_encoder *cbor.Encoder, ahmp_decoder *cbor.Decoder, version int, capabilities abyss.PeerCapability) {
+	peer.state = PNCS_CONNECTED
+	peer.conn = connection
+	peer.version = version
+	peer.capabilities = capabilities
+	compact := capabilities.Has(abyss.CAP_COMPRESSION)
+	peer.send_queue = newSendQueue(peer.AbyssPeer, connection, ahmp_encoder, compact, h.sendQueueCounters)
+	go peer.send_queue.run()
+	peer.ahmp_decoder = ahmp_decoder
+	admit := h.newAhmpAdmission(peer, connection) //shared, so that the stream and the datagrams count as one peer.
+	go peer.listenAhmp(connection, ahmp_decoder, compact, admit, func(message any) {
+		h.onNetServiceMessage(peer, message)
+	})
+	go peer.listenDatagrams(connection, compact, admit)
+	h.abyssPeerCH <- peer
+	go h.watchAbyssPeer(peer, connection)
+	go h.acceptRelayStreams(peer, connection)
+	if address, ok := connection.RemoteAddr().(*net.UDPAddr); ok { //not relayed
+		go peer.TrySendRAR(address)
+	}
+}
+
+// watchAbyssPeer waits until the connection of a connected peer dies,
+// then marks the peer closed and publishes it to abyssPeerCloseCH.
+func (h *BetaNetService) watchAbyssPeer(peer *ContextedPeer, connection quic.Connection) {
+	<-connection.Context().Done()
+	cause := context.Cause(connection.Context())
+
+	peer.mtx.Lock()
+	is_current := peer.conn == connection
+	if is_current {
+		peer.state = PNCS_CLOSED
+		if peer.err == nil {
+			peer.err = cause
 		}
 	}
+	peer.mtx.Unlock()
+
+	if is_current {
+		h.reflexive.forget(peer.IDHash())
+	}
+	h.abyssPeerCloseCH <- peer
+
+	peer.mtx.Lock()
+	h._startReconnect(peer)
+	peer.mtx.Unlock()
+}
+
+// onNetServiceMessage handles the AHMP messages that do not belong to AND.
+// called from listenAhmp; must not block.
+func (h *BetaNetService) onNetServiceMessage(peer *ContextedPeer, message any) {
+	switch message := message.(type) {
+	case *ahmp.RAR:
+		h.onReflexiveAddress(peer.IDHash(), message.Address)
+	case *ahmp.HPR:
+		go h.onHolePunchRequest(peer, message.PeerHash)
+	case *ahmp.HPS:
+		go h.holePunch(peer, message.PeerHash, message.Addresses, message.StartTime)
+	}
 }
 
 func (h *BetaNetService) AppendKnownPeer(root_cert string, handshake_key_cert string) error {
@@ -181,6 +399,9 @@ func (h *BetaNetService) AppendKnownPeerDer(root_cert []byte, handshake_key_cert
 func (h *BetaNetService) GetAbyssPeerChannel() chan abyss.IANDPeer {
 	return h.abyssPeerCH
 }
+func (h *BetaNetService) GetAbyssPeerCloseChannel() chan abyss.IANDPeer {
+	return h.abyssPeerCloseCH
+}
 
 func (h *BetaNetService) ConnectAbyssAsync(url *aurl.AURL) error {
 	if url.Scheme != "abyss" {
@@ -200,9 +421,10 @@ func (h *BetaNetService) ConnectAbyssAsync(url *aurl.AURL) error {
 	go h.PrepareAbyssOutbound(peer, candidate_addresses)
 	return nil
 }
+
 func (h *BetaNetService) ConnectAbyst(peer_hash string) (quic.Connection, error) {
 	if peer_hash == h.localIdentity.root_id_hash { //loopback
-		connection, err := h.quicTransport.Dial(h.ctx, h.local_aurl.Addresses[len(h.local_aurl.Addresses)-1], h.abystTlsConf, h.quicConf)
+		connection, err := h.quicTransport.Dial(h.ctx, h.local_candidates[len(h.local_candidates)-1], h.abystTlsConf, h.quicConf)
 		if err != nil {
 			return nil, err
 		}
@@ -214,10 +436,19 @@ func (h *BetaNetService) ConnectAbyst(peer_hash string) (quic.Connection, error)
 	if !ok {
 		return nil, errors.New("no abyss connection")
 	}
-	if peer.state != PNCS_CONNECTED {
+	peer.mtx.Lock()
+	state := peer.state
+	conn := peer.conn
+	peer.mtx.Unlock()
+
+	if state != PNCS_CONNECTED {
 		return nil, errors.New("abyss connection closed and not reconnected")
 	}
-	connection, err := h.quicTransport.Dial(peer.ctx, peer.outbound_conn.RemoteAddr(), h.abystTlsConf, h.quicConf)
+	transport := h.quicTransport
+	if _, ok := conn.RemoteAddr().(*relayAddr); ok {
+		transport = h.relayTransport
+	}
+	connection, err := transport.Dial(peer.ctx, conn.RemoteAddr(), h.abystTlsConf, h.quicConf)
 	if err != nil {
 		return nil, err
 	}
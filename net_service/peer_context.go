@@ -189,6 +189,17 @@ func (m *ContextedPeerMap) Find(id string) (*ContextedPeer, bool) {
 	return info, ok
 }
 
+func (m *ContextedPeerMap) Snapshot() []*ContextedPeer {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	result := make([]*ContextedPeer, 0, len(m.peers))
+	for _, p := range m.peers {
+		result = append(result, p)
+	}
+	return result
+}
+
 func (m *ContextedPeerMap) Wait(ctx context.Context, id string) (*ContextedPeer, error) {
 
 	//***Caution***
@@ -0,0 +1,181 @@
+package net_service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// defaults of the pending handshake table. see BetaNetServiceConfig.
+const PENDING_HANDSHAKE_TIMEOUT = time.Second * 10
+const PENDING_HANDSHAKE_MAX = 256
+const PENDING_HANDSHAKE_MAX_PER_SOURCE = 8
+
+// PendingHandshakeStatistics counts the inbound handshakes from peers that are not introduced yet.
+type PendingHandshakeStatistics struct {
+	Waiting    int //currently waiting for an introduction
+	Introduced int
+	TimedOut   int
+	Evicted    int
+}
+
+func (s PendingHandshakeStatistics) String() string {
+	return "pending handshakes: waiting " + strconv.Itoa(s.Waiting) +
+		" introduced " + strconv.Itoa(s.Introduced) +
+		" timed out " + strconv.Itoa(s.TimedOut) +
+		" evicted " + strconv.Itoa(s.Evicted)
+}
+
+type pendingHandshake struct {
+	source     string
+	connection quic.Connection
+	cancel     func()
+	evicted    bool
+}
+
+// pendingHandshakeTable bounds the inbound handshakes that wait for the peer to be introduced.
+// Each handshake waits for at most timeout. When a cap is reached, the oldest handshake
+// from the same source, or the oldest of all, is evicted to make room.
+type pendingHandshakeTable struct {
+	timeout        time.Duration
+	max            int
+	max_per_source int
+
+	entries    []*pendingHandshake //oldest first
+	per_source map[string]int
+	stat       PendingHandshakeStatistics
+
+	mtx sync.Mutex
+}
+
+func newPendingHandshakeTable(timeout time.Duration, max_entries int, max_per_source int) *pendingHandshakeTable {
+	if timeout <= 0 {
+		timeout = PENDING_HANDSHAKE_TIMEOUT
+	}
+	if max_entries <= 0 {
+		max_entries = PENDING_HANDSHAKE_MAX
+	}
+	if max_per_source <= 0 {
+		max_per_source = PENDING_HANDSHAKE_MAX_PER_SOURCE
+	}
+	return &pendingHandshakeTable{
+		timeout:        timeout,
+		max:            max_entries,
+		max_per_source: max_per_source,
+		entries:        make([]*pendingHandshake, 0),
+		per_source:     make(map[string]int),
+	}
+}
+
+// sourceKey is the key of the per-source limits; the IP address, or the relay peer for a relayed connection.
+func sourceKey(address net.Addr) string {
+	switch addr := address.(type) {
+	case *net.UDPAddr:
+		return addr.AddrPort().Addr().Unmap().String()
+	case *relayAddr:
+		return "relay/" + addr.relay_hash
+	default:
+		return address.String()
+	}
+}
+
+// wait waits for the peer to be registered in peers.
+// If the peer does not appear in time, or the handshake is evicted, the connection is closed
+// with ABYSS_HANDSHAKE_TIMEOUT or ABYSS_HANDSHAKE_EVICTED, and an error is returned.
+func (t *pendingHandshakeTable) wait(ctx context.Context, peers *ContextedPeerMap, peer_hash string, connection quic.Connection) (*ContextedPeer, error) {
+	if peer, ok := peers.Find(peer_hash); ok {
+		return peer, nil
+	}
+
+	wait_ctx, wait_cancel := context.WithTimeout(ctx, t.timeout)
+	defer wait_cancel()
+
+	entry := &pendingHandshake{
+		source:     sourceKey(connection.RemoteAddr()),
+		connection: connection,
+		cancel:     wait_cancel,
+	}
+	t.push(entry)
+
+	peer, err := peers.Wait(wait_ctx, peer_hash)
+
+	t.mtx.Lock()
+	t._remove(entry)
+	switch {
+	case err == nil:
+		t.stat.Introduced++
+	case entry.evicted:
+		t.stat.Evicted++
+	case ctx.Err() == nil:
+		t.stat.TimedOut++
+	}
+	evicted := entry.evicted
+	t.mtx.Unlock()
+
+	switch {
+	case err == nil:
+		return peer, nil
+	case evicted:
+		connection.CloseWithError(ABYSS_HANDSHAKE_EVICTED, ABYSS_HANDSHAKE_EVICTED_M)
+		return nil, errors.New("pending handshake evicted")
+	case ctx.Err() == nil:
+		connection.CloseWithError(ABYSS_HANDSHAKE_TIMEOUT, ABYSS_HANDSHAKE_TIMEOUT_M)
+		return nil, errors.New("pending handshake timeout")
+	default:
+		return nil, err
+	}
+}
+
+func (t *pendingHandshakeTable) push(entry *pendingHandshake) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if t.per_source[entry.source] >= t.max_per_source {
+		for _, e := range t.entries {
+			if e.source == entry.source {
+				t._evict(e)
+				break
+			}
+		}
+	}
+	if len(t.entries) >= t.max {
+		t._evict(t.entries[0])
+	}
+
+	t.entries = append(t.entries, entry)
+	t.per_source[entry.source]++
+	t.stat.Waiting = len(t.entries)
+}
+
+// _evict cancels the waiting handshake. it is removed from the table right away, so that the caps apply immediately.
+func (t *pendingHandshakeTable) _evict(entry *pendingHandshake) {
+	entry.evicted = true
+	entry.cancel()
+	t._remove(entry)
+}
+
+func (t *pendingHandshakeTable) _remove(entry *pendingHandshake) {
+	for i, e := range t.entries {
+		if e == entry {
+			t.entries = append(t.entries[:i], t.entries[i+1:]...)
+			t.per_source[entry.source]--
+			if t.per_source[entry.source] == 0 {
+				delete(t.per_source, entry.source)
+			}
+			break
+		}
+	}
+	t.stat.Waiting = len(t.entries)
+}
+
+func (t *pendingHandshakeTable) statistics() PendingHandshakeStatistics {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	return t.stat
+}
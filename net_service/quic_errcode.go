@@ -1,8 +1,32 @@
 package net_service
 
 const (
-	ABYSS_ALREADY_CONNECTED    = 0x0A01
-	ABYSS_ALREADY_CONNECTED_M  = "Alrady Connected"
-	ABYSS_EARLY_RECONNECTION   = 0x0A02
-	ABYSS_EARLY_RECONNECTION_M = "Too Early Reconnection"
+	ABYSS_ALREADY_CONNECTED     = 0x0A01
+	ABYSS_ALREADY_CONNECTED_M   = "Alrady Connected"
+	ABYSS_EARLY_RECONNECTION    = 0x0A02
+	ABYSS_EARLY_RECONNECTION_M  = "Too Early Reconnection"
+	ABYSS_SERVICE_CLOSED        = 0x0A03
+	ABYSS_SERVICE_CLOSED_M      = "Service Closed"
+	ABYSS_PAIR_CLOSED           = 0x0A04
+	ABYSS_PAIR_CLOSED_M         = "Paired Connection Closed"
+	ABYSS_AHMP_FAILED           = 0x0A05
+	ABYSS_AHMP_FAILED_M         = "AHMP Stream Failed"
+	ABYSS_TIE_BREAK             = 0x0A06
+	ABYSS_TIE_BREAK_M           = "Simultaneous Connection Tie-Break"
+	ABYSS_RELAY_CLOSED          = 0x0A07
+	ABYSS_RELAY_CLOSED_M        = "Relay Link Closed"
+	ABYSS_HANDSHAKE_EVICTED     = 0x0A08
+	ABYSS_HANDSHAKE_EVICTED_M   = "Pending Handshake Evicted"
+	ABYSS_HANDSHAKE_TIMEOUT     = 0x0A09
+	ABYSS_HANDSHAKE_TIMEOUT_M   = "Pending Handshake Timeout"
+	ABYSS_RATE_LIMITED          = 0x0A0A
+	ABYSS_RATE_LIMITED_M        = "Rate Limit Exceeded"
+	ABYSS_SEND_OVERFLOW         = 0x0A0B
+	ABYSS_SEND_OVERFLOW_M       = "Send Queue Overflow"
+	ABYSS_VERSION_MISMATCH      = 0x0A0C
+	ABYSS_VERSION_MISMATCH_M    = "AHMP Version Mismatch"
+	ABYSS_CONNECTION_REPLACED   = 0x0A0D
+	ABYSS_CONNECTION_REPLACED_M = "Replaced By A New Connection"
+
+	RELAY_STREAM_REFUSED = 0x0B01 //stream error code
 )
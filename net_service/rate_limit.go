@@ -0,0 +1,226 @@
+package net_service
+
+import (
+	"errors"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+
+	"github.com/MinwooWebeng/abyss_core/ahmp"
+)
+
+// buckets are swept when a limiter holds more than this many keys.
+const RATE_LIMIT_SWEEP_THRESHOLD = 1024
+
+// RateLimit is a token bucket limit. The zero value is unlimited.
+type RateLimit struct {
+	Rate  float64 //tokens per second
+	Burst int     //bucket size. at least 1 if Rate is set.
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter keeps one token bucket for each key.
+type rateLimiter struct {
+	limit   RateLimit
+	buckets map[string]*tokenBucket
+
+	mtx sync.Mutex
+}
+
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	if limit.Rate <= 0 {
+		return nil
+	}
+	limit.Burst = max(limit.Burst, 1)
+	return &rateLimiter{
+		limit:   limit,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// allow takes a token of the key. a nil limiter always allows.
+func (l *rateLimiter) allow(key string) bool {
+	if l == nil {
+		return true
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	now := time.Now()
+	bucket, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= RATE_LIMIT_SWEEP_THRESHOLD {
+			l._sweep(now)
+		}
+		bucket = &tokenBucket{tokens: float64(l.limit.Burst), last: now}
+		l.buckets[key] = bucket
+	}
+
+	bucket.tokens = min(bucket.tokens+now.Sub(bucket.last).Seconds()*l.limit.Rate, float64(l.limit.Burst))
+	bucket.last = now
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// _sweep removes the buckets that are refilled; they are the same as new ones.
+func (l *rateLimiter) _sweep(now time.Time) {
+	for key, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*l.limit.Rate >= float64(l.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// RateLimitStatistics counts the rate limit violations.
+type RateLimitStatistics struct {
+	RefusedConnections int
+	DroppedMessages    map[int]int //AHMP type -> count
+	Disconnects        int
+}
+
+func (s RateLimitStatistics) String() string {
+	var sb strings.Builder
+	sb.WriteString("rate limit: refused connections " + strconv.Itoa(s.RefusedConnections))
+	sb.WriteString(" disconnects " + strconv.Itoa(s.Disconnects))
+	sb.WriteString(" dropped")
+	for _, ahmp_type := range slices.Sorted(maps.Keys(s.DroppedMessages)) {
+		sb.WriteString(" " + ahmp.Name(ahmp_type) + ":" + strconv.Itoa(s.DroppedMessages[ahmp_type]))
+	}
+	return sb.String()
+}
+
+// rateLimits holds the limiters of a network service. see BetaNetServiceConfig.
+type rateLimits struct {
+	connection_per_ip   *rateLimiter
+	connection_per_peer *rateLimiter
+	message_per_ip      map[int]*rateLimiter
+	message_per_peer    map[int]*rateLimiter
+
+	stat RateLimitStatistics
+	mtx  sync.Mutex //for stat
+}
+
+func newRateLimits(config *BetaNetServiceConfig) *rateLimits {
+	result := &rateLimits{
+		connection_per_ip:   newRateLimiter(config.ConnectionRateLimitPerIP),
+		connection_per_peer: newRateLimiter(config.ConnectionRateLimitPerPeer),
+		message_per_ip:      make(map[int]*rateLimiter),
+		message_per_peer:    make(map[int]*rateLimiter),
+		stat: RateLimitStatistics{
+			DroppedMessages: make(map[int]int),
+		},
+	}
+	for ahmp_type, limit := range config.MessageRateLimitsPerIP {
+		result.message_per_ip[ahmp_type] = newRateLimiter(limit)
+	}
+	for ahmp_type, limit := range config.MessageRateLimitsPerPeer {
+		result.message_per_peer[ahmp_type] = newRateLimiter(limit)
+	}
+	return result
+}
+
+func (r *rateLimits) allowConnectionFrom(address net.Addr) bool {
+	if r.connection_per_ip.allow(sourceKey(address)) {
+		return true
+	}
+	r.mtx.Lock()
+	r.stat.RefusedConnections++
+	r.mtx.Unlock()
+	return false
+}
+
+func (r *rateLimits) allowConnectionOf(peer_hash string) bool {
+	if r.connection_per_peer.allow(peer_hash) {
+		return true
+	}
+	r.mtx.Lock()
+	r.stat.RefusedConnections++
+	r.mtx.Unlock()
+	return false
+}
+
+func (r *rateLimits) allowMessage(ahmp_type int, peer_hash string, address net.Addr) bool {
+	//both buckets are charged, so that a violation of one does not leave the other untouched.
+	peer_ok := r.message_per_peer[ahmp_type].allow(peer_hash)
+	ip_ok := r.message_per_ip[ahmp_type].allow(sourceKey(address))
+	if peer_ok && ip_ok {
+		return true
+	}
+	r.mtx.Lock()
+	r.stat.DroppedMessages[ahmp_type]++
+	r.mtx.Unlock()
+	return false
+}
+
+func (r *rateLimits) countDisconnect() {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.stat.Disconnects++
+}
+
+func (r *rateLimits) statistics() RateLimitStatistics {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	result := r.stat
+	result.DroppedMessages = make(map[int]int, len(r.stat.DroppedMessages))
+	for ahmp_type, count := range r.stat.DroppedMessages {
+		result.DroppedMessages[ahmp_type] = count
+	}
+	return result
+}
+
+// newAhmpAdmission returns the admission check of listenAhmp and listenDatagrams for a connection.
+// it is called from both listeners.
+// A message over the limit is dropped, and the sender's session is reset with RST.
+// If the peer keeps exceeding the limit without a message being admitted in between,
+// the connection is closed with ABYSS_RATE_LIMITED.
+func (h *BetaNetService) newAhmpAdmission(peer *ContextedPeer, connection quic.Connection) func(ahmp_type int, message any) bool {
+	var mtx sync.Mutex //for warned, disconnected
+	warned := false
+	disconnected := false
+	return func(ahmp_type int, message any) bool {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		if disconnected { //the rest of the stream is discarded.
+			return false
+		}
+		if h.rateLimits.allowMessage(ahmp_type, peer.IDHash(), connection.RemoteAddr()) {
+			warned = false
+			return true
+		}
+
+		if !warned {
+			warned = true
+			if sender, recver, ok := ahmp.SessionIDs(message); ok {
+				go peer.TrySendRST(recver, sender, "rate limited")
+			}
+			return false
+		}
+
+		disconnected = true
+		peer.mtx.Lock()
+		if peer.conn == connection && peer.err == nil {
+			peer.err = errors.New("rate limit exceeded")
+		}
+		peer.mtx.Unlock()
+		h.rateLimits.countDisconnect()
+		connection.CloseWithError(ABYSS_RATE_LIMITED, ABYSS_RATE_LIMITED_M)
+		return false
+	}
+}
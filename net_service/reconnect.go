@@ -0,0 +1,74 @@
+package net_service
+
+import (
+	"math/rand/v2"
+	"net"
+	"time"
+)
+
+const RECONNECT_BACKOFF_MIN = time.Millisecond * 500
+const RECONNECT_BACKOFF_MAX = time.Second * 30
+
+// startReconnect launches reconnectLoop for the peer, unless one is already running.
+// must be called with peer.mtx held.
+func (h *BetaNetService) _startReconnect(peer *ContextedPeer) {
+	if peer.reconnecting {
+		return
+	}
+	peer.reconnecting = true
+	go h.reconnectLoop(peer)
+}
+
+// reconnectLoop moves a closed peer back to PNCS_DISCONNECTED, and redials it
+// with exponential backoff and jitter until the peer is connected again.
+// If the direct dial fails, the peer is dialed through its relays.
+// Inbound reconnections from the remote side are accepted meanwhile.
+func (h *BetaNetService) reconnectLoop(peer *ContextedPeer) {
+	defer func() {
+		peer.mtx.Lock()
+		peer.reconnecting = false
+		peer.mtx.Unlock()
+	}()
+
+	backoff := RECONNECT_BACKOFF_MIN
+	for {
+		select {
+		case <-h.ctx.Done():
+			return
+		case <-peer.ctx.Done():
+			return
+		case <-time.After(backoff/2 + rand.N(backoff/2)):
+		}
+
+		peer.mtx.Lock()
+		if peer.state == PNCS_CLOSED {
+			peer._reset()
+		}
+		state := peer.state
+		addresses := make([]*net.UDPAddr, len(peer.addresses))
+		copy(addresses, peer.addresses)
+		relay_count := len(peer.relays)
+		peer.mtx.Unlock()
+
+		switch state {
+		case PNCS_CONNECTED:
+			return
+		case PNCS_DISCONNECTED:
+			candidate_addresses := h.addressSelector.FilterAddressCandidates(addresses)
+			if len(candidate_addresses) == 0 && relay_count == 0 {
+				return //no known address. wait for the remote side to reconnect.
+			}
+			if len(candidate_addresses) != 0 {
+				h.PrepareAbyssOutbound(peer, candidate_addresses)
+			}
+			if !peer.IsConnected() && relay_count != 0 {
+				h.dialRelayed(peer)
+			}
+		}
+
+		if peer.IsConnected() {
+			return
+		}
+		backoff = min(backoff*2, RECONNECT_BACKOFF_MAX)
+	}
+}
@@ -0,0 +1,88 @@
+package net_service
+
+import (
+	"net"
+	"slices"
+	"sync"
+
+	"github.com/MinwooWebeng/abyss_core/aurl"
+)
+
+// REFLEXIVE_QUORUM is the number of distinct peers that must observe the same address
+// before it is advertised as our public address.
+const REFLEXIVE_QUORUM = 2
+
+// reflexiveReports aggregates the addresses that connected peers observe for us.
+type reflexiveReports struct {
+	reports map[string]string //peer hash -> observed address
+	current string            //currently advertised reflexive address, empty if none
+
+	mtx sync.Mutex
+}
+
+func newReflexiveReports() *reflexiveReports {
+	return &reflexiveReports{
+		reports: make(map[string]string),
+	}
+}
+
+// record stores the report of a peer, and returns true if the address
+// newly reached the quorum.
+func (r *reflexiveReports) record(peer_hash string, address string) bool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.reports[peer_hash] = address
+	if address == r.current {
+		return false
+	}
+
+	count := 0
+	for _, reported := range r.reports {
+		if reported == address {
+			count++
+		}
+	}
+	if count < REFLEXIVE_QUORUM {
+		return false
+	}
+	r.current = address
+	return true
+}
+
+// forget removes the report of a disconnected peer, so that it no longer counts toward the quorum.
+// the advertised address is kept until another address reaches the quorum.
+func (r *reflexiveReports) forget(peer_hash string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	delete(r.reports, peer_hash)
+}
+
+// onReflexiveAddress handles RAR from a connected peer.
+// addresses in our local network are ignored, as they are already advertised or not reachable from outside.
+func (h *BetaNetService) onReflexiveAddress(peer_hash string, address *net.UDPAddr) {
+	if address.IP == nil || address.IP.IsUnspecified() || address.IP.IsLoopback() || address.IP.IsPrivate() || address.IP.IsLinkLocalUnicast() {
+		return
+	}
+	if slices.ContainsFunc(h.addressSelector.LocalIPAddrs(), func(local net.IPAddr) bool {
+		return local.IP.Equal(address.IP)
+	}) {
+		return //not behind NAT
+	}
+
+	if !h.reflexive.record(peer_hash, address.String()) {
+		return
+	}
+
+	h.addressSelector.SetPublicIP(address.IP)
+
+	h.local_aurl_mtx.Lock()
+	h.local_aurl = &aurl.AURL{
+		Scheme:    h.local_aurl.Scheme,
+		Hash:      h.local_aurl.Hash,
+		Addresses: append([]*net.UDPAddr{address}, h.local_candidates...),
+		Path:      h.local_aurl.Path,
+	}
+	h.local_aurl_mtx.Unlock()
+}
@@ -0,0 +1,253 @@
+package net_service
+
+import (
+	"context"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/quic-go/quic-go"
+)
+
+// maximum relay streams that we forward for a peer at once, either from or to it.
+const RELAY_MAX_STREAMS_PER_PEER = 8
+
+// relayLimiter is a token bucket shared by all relay streams of a peer pair, in both directions.
+// up to one second of bandwidth can be sent in a burst.
+type relayLimiter struct {
+	rate   float64 //bytes per second
+	tokens float64
+	last   time.Time
+
+	mtx sync.Mutex
+}
+
+func newRelayLimiter(bytes_per_second int) *relayLimiter {
+	return &relayLimiter{
+		rate:   float64(bytes_per_second),
+		tokens: float64(bytes_per_second),
+		last:   time.Now(),
+	}
+}
+
+// wait takes n bytes from the bucket, waiting until the bucket is refilled if it is in debt.
+func (l *relayLimiter) wait(ctx context.Context, n int) error {
+	l.mtx.Lock()
+	now := time.Now()
+	l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.rate, l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	debt := -l.tokens
+	l.mtx.Unlock()
+
+	if debt <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(time.Duration(debt / l.rate * float64(time.Second))):
+		return nil
+	}
+}
+
+// relayTable keeps the limiters of the relayed pairs, and counts the relay streams of each peer.
+type relayTable struct {
+	bandwidth int                      //bytes per second for each pair. 0: relaying is disabled.
+	limiters  map[string]*relayLimiter //pair key -> limiter, while the pair has a stream
+	pairs     map[string]int           //pair key -> open streams
+	streams   map[string]int           //peer hash -> open streams, from or to the peer
+
+	mtx sync.Mutex
+}
+
+func newRelayTable(bandwidth int) *relayTable {
+	return &relayTable{
+		bandwidth: bandwidth,
+		limiters:  make(map[string]*relayLimiter),
+		pairs:     make(map[string]int),
+		streams:   make(map[string]int),
+	}
+}
+
+func relayPairKey(a string, b string) string {
+	if a > b {
+		a, b = b, a
+	}
+	return a + "/" + b
+}
+
+// open registers a relay stream between the peers, and returns the limiter of the pair.
+// returns false if relaying is disabled, or either peer has RELAY_MAX_STREAMS_PER_PEER streams.
+func (t *relayTable) open(source_hash string, dest_hash string) (*relayLimiter, bool) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if t.bandwidth == 0 || t.streams[source_hash] >= RELAY_MAX_STREAMS_PER_PEER || t.streams[dest_hash] >= RELAY_MAX_STREAMS_PER_PEER {
+		return nil, false
+	}
+	t.streams[source_hash]++
+	t.streams[dest_hash]++
+
+	key := relayPairKey(source_hash, dest_hash)
+	t.pairs[key]++
+	limiter, ok := t.limiters[key]
+	if !ok {
+		limiter = newRelayLimiter(t.bandwidth)
+		t.limiters[key] = limiter
+	}
+	return limiter, true
+}
+
+// close unregisters a relay stream that open accepted.
+func (t *relayTable) close(source_hash string, dest_hash string) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	for _, peer_hash := range []string{source_hash, dest_hash} {
+		if t.streams[peer_hash]--; t.streams[peer_hash] == 0 {
+			delete(t.streams, peer_hash)
+		}
+	}
+	key := relayPairKey(source_hash, dest_hash)
+	if t.pairs[key]--; t.pairs[key] == 0 {
+		delete(t.pairs, key)
+		delete(t.limiters, key)
+	}
+}
+
+// acceptRelayStreams serves the streams that the peer opens after the AHMP stream.
+// they are relay streams, either to be forwarded by us, or forwarded to us.
+func (h *BetaNetService) acceptRelayStreams(peer *ContextedPeer, connection quic.Connection) {
+	for {
+		stream, err := connection.AcceptStream(connection.Context())
+		if err != nil {
+			return
+		}
+		go h.handleRelayStream(peer, stream)
+	}
+}
+
+func (h *BetaNetService) handleRelayStream(peer *ContextedPeer, stream quic.Stream) {
+	decoder := cbor.NewDecoder(stream)
+	var header relayHeader
+	if err := decoder.Decode(&header); err != nil {
+		refuseRelayStream(stream)
+		return
+	}
+
+	switch {
+	case header.Dest != "":
+		h.serveRelay(peer, stream, decoder, header.Dest)
+	case header.Src != "":
+		h.relayConn.addLink(&relayAddr{relay_hash: peer.IDHash(), peer_hash: header.Src}, stream, cbor.NewEncoder(stream), decoder)
+	default:
+		refuseRelayStream(stream)
+	}
+}
+
+func refuseRelayStream(stream quic.Stream) {
+	stream.CancelRead(RELAY_STREAM_REFUSED)
+	stream.CancelWrite(RELAY_STREAM_REFUSED)
+}
+
+// serveRelay forwards the packets between the source peer and the destination peer, which are both connected to us.
+// relaying is opt-in with BetaNetServiceConfig.RelayBandwidth, which is shared by all streams of the pair.
+func (h *BetaNetService) serveRelay(source *ContextedPeer, source_stream quic.Stream, source_decoder *cbor.Decoder, dest_hash string) {
+	dest, ok := h.peers.Find(dest_hash)
+	if !ok || dest == source {
+		refuseRelayStream(source_stream)
+		return
+	}
+	limiter, ok := h.relays.open(source.IDHash(), dest_hash)
+	if !ok {
+		refuseRelayStream(source_stream)
+		return
+	}
+	defer h.relays.close(source.IDHash(), dest_hash)
+
+	dest.mtx.Lock()
+	dest_conn := dest.conn
+	dest.mtx.Unlock()
+	if dest_conn == nil {
+		refuseRelayStream(source_stream)
+		return
+	}
+
+	relay_ctx, relay_cancel := context.WithCancel(h.ctx)
+	defer relay_cancel()
+
+	dest_stream, err := dest_conn.OpenStreamSync(relay_ctx)
+	if err != nil {
+		refuseRelayStream(source_stream)
+		return
+	}
+	dest_encoder := cbor.NewEncoder(dest_stream)
+	if err := dest_encoder.Encode(relayHeader{Src: source.IDHash()}); err != nil {
+		refuseRelayStream(source_stream)
+		refuseRelayStream(dest_stream)
+		return
+	}
+
+	forward := func(decoder *cbor.Decoder, encoder *cbor.Encoder) {
+		defer relay_cancel()
+		for {
+			var payload []byte
+			if err := decoder.Decode(&payload); err != nil || len(payload) > RELAY_MAX_PACKET_SIZE {
+				return
+			}
+			if err := limiter.wait(relay_ctx, len(payload)); err != nil {
+				return
+			}
+			if err := encoder.Encode(payload); err != nil {
+				return
+			}
+		}
+	}
+	go forward(cbor.NewDecoder(dest_stream), cbor.NewEncoder(source_stream))
+	go forward(source_decoder, dest_encoder)
+
+	<-relay_ctx.Done()
+	refuseRelayStream(source_stream)
+	refuseRelayStream(dest_stream)
+}
+
+// onRelayLinkClosed closes the connection that was running over the link.
+func (h *BetaNetService) onRelayLinkClosed(addr *relayAddr) {
+	for _, peer := range h.peers.Snapshot() {
+		peer.mtx.Lock()
+		if peer.conn != nil && peer.conn.RemoteAddr().String() == addr.String() {
+			peer.conn.CloseWithError(ABYSS_RELAY_CLOSED, ABYSS_RELAY_CLOSED_M)
+		}
+		peer.mtx.Unlock()
+	}
+}
+
+// dialRelayed connects to the peer through one of the peers that introduced it.
+// this is the last resort for a peer that can not be reached directly, even with hole punching.
+func (h *BetaNetService) dialRelayed(peer *ContextedPeer) {
+	peer.mtx.Lock()
+	relays := slices.Clone(peer.relays)
+	peer.mtx.Unlock()
+
+	for _, relay_hash := range relays {
+		relay, ok := h.peers.Find(relay_hash)
+		if !ok || !relay.IsConnected() {
+			continue
+		}
+
+		h.prepareAbyssOutbound(peer, nil, func(_ *net.UDPAddr) (quic.Connection, *net.UDPAddr, error) {
+			addr, err := h.relayConn.openLink(peer.ctx, relay, peer.IDHash())
+			if err != nil {
+				return nil, nil, err
+			}
+			connection, err := h.relayTransport.Dial(peer.ctx, addr, h.abyssTlsConf, h.quicConf)
+			return connection, nil, err
+		})
+		if peer.IsConnected() {
+			return
+		}
+	}
+}
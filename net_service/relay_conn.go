@@ -0,0 +1,233 @@
+package net_service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/quic-go/quic-go"
+)
+
+// maximum size of a relayed QUIC packet
+const RELAY_MAX_PACKET_SIZE = 1500
+
+// relayAddr is the address of a peer that is reached through a relay peer.
+type relayAddr struct {
+	relay_hash string
+	peer_hash  string
+}
+
+func (a *relayAddr) Network() string { return "abyss-relay" }
+func (a *relayAddr) String() string  { return a.relay_hash + "/" + a.peer_hash }
+
+// relayHeader is the first message of a relay stream.
+// A stream to the relay has Dest, and the stream from the relay to the destination has Src.
+type relayHeader struct {
+	Dest string
+	Src  string
+}
+
+type relayPacket struct {
+	payload []byte
+	addr    *relayAddr
+}
+
+// relayLink is a stream that carries the QUIC packets of a relayed peer, each framed as a CBOR byte string.
+type relayLink struct {
+	addr    *relayAddr
+	stream  quic.Stream
+	encoder *cbor.Encoder
+
+	mtx sync.Mutex //for encoder
+}
+
+// relayPacketConn is the net.PacketConn of the relay transport.
+// Packets to a relayed peer go through relayLinks, so that the QUIC connection on top of it
+// is encrypted end-to-end, and the relay peer only forwards ciphertext.
+type relayPacketConn struct {
+	local_addr     *relayAddr
+	links          map[string]*relayLink //relayAddr.String() -> the latest link
+	inbound        chan relayPacket
+	on_link_closed func(addr *relayAddr)
+
+	read_deadline time.Time
+	deadline_ch   chan bool //wakes ReadFrom when the read deadline changes
+	done          chan bool
+	close_once    sync.Once
+
+	mtx sync.Mutex
+}
+
+func newRelayPacketConn(local_hash string, on_link_closed func(addr *relayAddr)) *relayPacketConn {
+	return &relayPacketConn{
+		local_addr:     &relayAddr{relay_hash: "", peer_hash: local_hash},
+		links:          make(map[string]*relayLink),
+		inbound:        make(chan relayPacket, 256),
+		on_link_closed: on_link_closed,
+		deadline_ch:    make(chan bool, 1),
+		done:           make(chan bool),
+	}
+}
+
+// openLink opens a stream to the relay peer, asking it to forward to the peer.
+// An existing link is reused.
+func (c *relayPacketConn) openLink(ctx context.Context, relay *ContextedPeer, peer_hash string) (*relayAddr, error) {
+	addr := &relayAddr{relay_hash: relay.IDHash(), peer_hash: peer_hash}
+
+	c.mtx.Lock()
+	_, ok := c.links[addr.String()]
+	c.mtx.Unlock()
+	if ok {
+		return addr, nil
+	}
+
+	relay.mtx.Lock()
+	connection := relay.conn
+	relay.mtx.Unlock()
+	if connection == nil {
+		return nil, errors.New("relay not connected")
+	}
+
+	stream, err := connection.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	encoder := cbor.NewEncoder(stream)
+	if err = encoder.Encode(relayHeader{Dest: peer_hash}); err != nil {
+		refuseRelayStream(stream)
+		return nil, err
+	}
+	c.addLink(addr, stream, encoder, cbor.NewDecoder(stream))
+	return addr, nil
+}
+
+// addLink makes the stream the link for the address, and starts reading it.
+// a link that is superseded keeps delivering packets until its stream ends.
+func (c *relayPacketConn) addLink(addr *relayAddr, stream quic.Stream, encoder *cbor.Encoder, decoder *cbor.Decoder) {
+	link := &relayLink{
+		addr:    addr,
+		stream:  stream,
+		encoder: encoder,
+	}
+	c.mtx.Lock()
+	c.links[addr.String()] = link
+	c.mtx.Unlock()
+
+	go c.readLink(link, decoder)
+}
+
+func (c *relayPacketConn) readLink(link *relayLink, decoder *cbor.Decoder) {
+	defer func() {
+		refuseRelayStream(link.stream)
+
+		c.mtx.Lock()
+		is_latest := c.links[link.addr.String()] == link
+		if is_latest {
+			delete(c.links, link.addr.String())
+		}
+		c.mtx.Unlock()
+
+		if is_latest {
+			c.on_link_closed(link.addr)
+		}
+	}()
+
+	for {
+		var payload []byte
+		if err := decoder.Decode(&payload); err != nil || len(payload) > RELAY_MAX_PACKET_SIZE {
+			return
+		}
+		select {
+		case c.inbound <- relayPacket{payload: payload, addr: link.addr}:
+		case <-c.done:
+			return
+		default:
+			//dropped, as UDP would.
+		}
+	}
+}
+
+func (c *relayPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		c.mtx.Lock()
+		deadline := c.read_deadline
+		c.mtx.Unlock()
+
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			timeout = time.After(time.Until(deadline))
+		}
+
+		select {
+		case packet := <-c.inbound:
+			return copy(p, packet.payload), packet.addr, nil
+		case <-c.done:
+			return 0, nil, net.ErrClosed
+		case <-timeout:
+			return 0, nil, os.ErrDeadlineExceeded
+		case <-c.deadline_ch:
+		}
+	}
+}
+
+func (c *relayPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	c.mtx.Lock()
+	link, ok := c.links[addr.String()]
+	c.mtx.Unlock()
+	if !ok {
+		return len(p), nil //no route. dropped, as UDP would.
+	}
+
+	link.mtx.Lock()
+	err := link.encoder.Encode(p)
+	link.mtx.Unlock()
+	if err != nil {
+		link.stream.CancelRead(RELAY_STREAM_REFUSED) //readLink removes the link
+	}
+	return len(p), nil
+}
+
+func (c *relayPacketConn) Close() error {
+	c.close_once.Do(func() {
+		close(c.done)
+
+		c.mtx.Lock()
+		for _, link := range c.links {
+			refuseRelayStream(link.stream)
+		}
+		c.mtx.Unlock()
+	})
+	return nil
+}
+
+func (c *relayPacketConn) LocalAddr() net.Addr {
+	return c.local_addr
+}
+
+func (c *relayPacketConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *relayPacketConn) SetReadDeadline(t time.Time) error {
+	c.mtx.Lock()
+	c.read_deadline = t
+	c.mtx.Unlock()
+
+	select {
+	case c.deadline_ch <- true:
+	default:
+	}
+	return nil
+}
+
+func (c *relayPacketConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// buffers are in the relay streams. these only keep quic-go from warning.
+func (c *relayPacketConn) SetReadBuffer(bytes int) error  { return nil }
+func (c *relayPacketConn) SetWriteBuffer(bytes int) error { return nil }
@@ -0,0 +1,189 @@
+package net_service
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/quic-go/quic-go"
+
+	"github.com/MinwooWebeng/abyss_core/ahmp"
+	abyss "github.com/MinwooWebeng/abyss_core/interfaces"
+	"github.com/MinwooWebeng/abyss_core/watchdog"
+)
+
+// sizes of the per-peer send queues, in messages.
+const SEND_QUEUE_CONTROL_SIZE = 256
+const SEND_QUEUE_OBJECT_SIZE = 1024
+
+// SendQueueStatistics counts the messages that did not fit in the send queues.
+// DroppedObjectMessages includes the OWR, OHO and MSG messages of the object queue.
+type SendQueueStatistics struct {
+	DroppedObjectMessages int64
+	OverflowDisconnects   int64
+}
+
+func (s SendQueueStatistics) String() string {
+	return "send queue: dropped object messages " + strconv.FormatInt(s.DroppedObjectMessages, 10) +
+		" overflow disconnects " + strconv.FormatInt(s.OverflowDisconnects, 10)
+}
+
+type sendQueueCounters struct {
+	dropped_object_messages atomic.Int64
+	overflow_disconnects    atomic.Int64
+}
+
+func (c *sendQueueCounters) statistics() SendQueueStatistics {
+	return SendQueueStatistics{
+		DroppedObjectMessages: c.dropped_object_messages.Load(),
+		OverflowDisconnects:   c.overflow_disconnects.Load(),
+	}
+}
+
+// sendQueue writes the AHMP messages of a connection from its own goroutine, so that senders never block on the network.
+// Control messages are written before the object queue, which holds the object messages (SOA, SOD, SOU),
+// the ownership messages that refer to them (OWR, OHO), and application messages (MSG).
+// The order within each queue is kept, so that an OHO never overtakes the SOA or SOU before it.
+// When the object queue is full, the new message is dropped, and the sender is told. When the control queue is full,
+// the peer can not keep up with the discovery protocol, and the connection is closed with ABYSS_SEND_OVERFLOW.
+type sendQueue struct {
+	peer       *AbyssPeer
+	connection quic.Connection
+	encoder    *cbor.Encoder
+	compact    bool //abyss.CAP_COMPRESSION
+	control    chan ahmpFrame
+	object     chan ahmpFrame
+	counters   *sendQueueCounters
+
+	sent_certificates map[string]bool //peer hashes whose certificates are sent. compact only.
+	encode_mtx        sync.Mutex      //keeps the frame with the certificates ahead of the ones that omit them.
+}
+
+func newSendQueue(peer *AbyssPeer, connection quic.Connection, encoder *cbor.Encoder, compact bool, counters *sendQueueCounters) *sendQueue {
+	return &sendQueue{
+		peer:              peer,
+		connection:        connection,
+		encoder:           encoder,
+		compact:           compact,
+		control:           make(chan ahmpFrame, SEND_QUEUE_CONTROL_SIZE),
+		object:            make(chan ahmpFrame, SEND_QUEUE_OBJECT_SIZE),
+		counters:          counters,
+		sent_certificates: make(map[string]bool),
+	}
+}
+
+func isObjectQueueMessage(ahmp_type int) bool {
+	switch ahmp_type {
+	case ahmp.SOA_T, ahmp.SOD_T, ahmp.SOU_T, ahmp.OWR_T, ahmp.OHO_T, ahmp.MSG_T:
+		return true
+	default:
+		return false
+	}
+}
+
+// ahmpFrame is an encoded ahmp.RawFrame, which is written to the stream in a single write.
+type ahmpFrame cbor.RawMessage
+
+// send encodes the message in the sender's goroutine, so that an encoding error is returned to the sender, and queues it.
+func (q *sendQueue) send(message any) bool {
+	if q.compact {
+		q.encode_mtx.Lock()
+		defer q.encode_mtx.Unlock()
+
+		q._omitSentCertificates(message)
+	}
+
+	ahmp_type, frame, err := ahmp.EncodeFrame(message, q.compact)
+	if err != nil {
+		return false
+	}
+
+	//debug
+	watchdog.InfoV(ahmp.Name(ahmp_type)+"> "+q.connection.RemoteAddr().String(), message)
+	return q.push(ahmp_type, frame)
+}
+
+// _omitSentCertificates removes the neighbor certificates that were already sent on the connection.
+// must be called with q.encode_mtx held.
+func (q *sendQueue) _omitSentCertificates(message any) {
+	omit := func(neighbor *abyss.ANDFullPeerSessionIdentity) {
+		if q.sent_certificates[neighbor.AURL.Hash] {
+			neighbor.RootCertificateDer = nil
+			neighbor.HandshakeKeyCertificateDer = nil
+			return
+		}
+		q.sent_certificates[neighbor.AURL.Hash] = true
+	}
+
+	switch m := message.(type) {
+	case *ahmp.JOK:
+		for i := range m.Neighbors {
+			omit(&m.Neighbors[i])
+		}
+	case *ahmp.JNI:
+		omit(&m.Neighbor)
+	}
+}
+
+// push queues the frame. returns false if the connection is closed, or the frame is dropped.
+func (q *sendQueue) push(ahmp_type int, frame ahmpFrame) bool {
+	if q.connection.Context().Err() != nil {
+		return false
+	}
+
+	if isObjectQueueMessage(ahmp_type) {
+		select {
+		case q.object <- frame:
+			return true
+		default:
+			q.counters.dropped_object_messages.Add(1)
+			return false
+		}
+	}
+
+	select {
+	case q.control <- frame:
+		return true
+	default:
+		q.counters.overflow_disconnects.Add(1)
+		q.fail(errors.New("send queue overflow"), ABYSS_SEND_OVERFLOW, ABYSS_SEND_OVERFLOW_M)
+		return false
+	}
+}
+
+// run writes the queued frames until the connection closes.
+func (q *sendQueue) run() {
+	done := q.connection.Context().Done()
+	for {
+		var frame ahmpFrame
+		select {
+		case frame = <-q.control:
+		default:
+			select {
+			case frame = <-q.control:
+			case frame = <-q.object:
+			case <-done:
+				return
+			}
+		}
+
+		//only this goroutine writes to the stream after the handshake.
+		if err := q.encoder.Encode(cbor.RawMessage(frame)); err != nil {
+			q.fail(err, ABYSS_AHMP_FAILED, ABYSS_AHMP_FAILED_M)
+			return
+		}
+	}
+}
+
+// fail closes the connection. watchAbyssPeer closes the peer.
+func (q *sendQueue) fail(err error, code quic.ApplicationErrorCode, message string) {
+	q.peer.mtx.Lock()
+	if q.peer.conn == q.connection && q.peer.err == nil {
+		q.peer.err = err
+	}
+	q.peer.mtx.Unlock()
+
+	q.connection.CloseWithError(code, message)
+}
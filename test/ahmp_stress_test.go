@@ -0,0 +1,103 @@
+package test
+
+import (
+	"context"
+	"crypto/ed25519"
+	crypto_rand "crypto/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	abyss_host "github.com/MinwooWebeng/abyss_core/host"
+	abyss "github.com/MinwooWebeng/abyss_core/interfaces"
+)
+
+// TestAhmpStress sends to one peer from many goroutines at once.
+// Every message must arrive intact, and the peer must stay connected.
+func TestAhmpStress(t *testing.T) {
+	_, A_privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+	_, B_privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+	A_host, A_pathmap, _ := abyss_host.NewBetaAbyssHost(context.Background(), &A_privkey, nil)
+	B_host, _, _ := abyss_host.NewBetaAbyssHost(context.Background(), &B_privkey, nil)
+
+	go A_host.ListenAndServe(context.Background())
+	go B_host.ListenAndServe(context.Background())
+
+	A_host.NetworkService.AppendKnownPeer(B_host.NetworkService.LocalIdentity().RootCertificate(), B_host.NetworkService.LocalIdentity().HandshakeKeyCertificate())
+	B_host.NetworkService.AppendKnownPeer(A_host.NetworkService.LocalIdentity().RootCertificate(), A_host.NetworkService.LocalIdentity().HandshakeKeyCertificate())
+
+	A_world, _ := A_host.OpenWorld("http://a.world.com")
+	A_pathmap.TrySetMapping("/home", A_world.SessionID())
+	world_aurl := A_host.GetLocalAbyssURL()
+	world_aurl.Path = "/home"
+
+	A_members := make(chan map[string]bool, 1)
+	go func() { A_members <- acceptMembers(A_world.GetEventChannel(), 1) }()
+	join_ctx, join_ctx_cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer join_ctx_cancel()
+	B_world, err := B_host.JoinWorld(join_ctx, world_aurl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var A_member abyss.IWorldMember
+	for A_member == nil {
+		switch event := (<-B_world.GetEventChannel()).(type) {
+		case abyss.EWorldMemberRequest:
+			event.Accept()
+		case abyss.EWorldMemberReady:
+			A_member = event.Member
+		}
+	}
+	<-A_members
+
+	const goroutines = 32
+	const messages = 50
+	var appended, deleted atomic.Int64
+	var wg sync.WaitGroup
+	for g := range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range messages {
+				id := uuid.New()
+				if A_member.AppendObjects([]abyss.ObjectInfo{{ID: id, Addr: "stress.aml", Transform: [7]float32{float32(g), float32(i)}}}) {
+					appended.Add(1)
+				}
+				if A_member.DeleteObjects([]uuid.UUID{id}) {
+					deleted.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	var received_append, received_delete int64
+	timeout := time.After(20 * time.Second)
+	for received_append < appended.Load() || received_delete < deleted.Load() {
+		select {
+		case event_any := <-A_world.GetEventChannel():
+			switch event := event_any.(type) {
+			case abyss.EMemberObjectAppend:
+				if len(event.Objects) != 1 || event.Objects[0].Addr != "stress.aml" {
+					t.Fatal("corrupted SOA")
+				}
+				received_append++
+			case abyss.EMemberObjectDelete:
+				if len(event.ObjectIDs) != 1 {
+					t.Fatal("corrupted SOD")
+				}
+				received_delete++
+			case abyss.EWorldMemberLeave:
+				t.Fatal("peer disconnected")
+			default:
+				t.Fatalf("unexpected event %T", event_any)
+			}
+		case <-timeout:
+			t.Fatal("received", received_append, "SOA of", appended.Load(), "and", received_delete, "SOD of", deleted.Load())
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package test
+
+import (
+	"context"
+	"crypto/ed25519"
+	crypto_rand "crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MinwooWebeng/abyss_core/ahmp"
+	abyss_host "github.com/MinwooWebeng/abyss_core/host"
+	abyss "github.com/MinwooWebeng/abyss_core/interfaces"
+
+	"github.com/google/uuid"
+)
+
+const CHAT_T = ahmp.APP_T_BASE + 1
+
+type chat struct {
+	Text string
+}
+type rawChat struct {
+	Text string
+}
+
+func newRawChat(m *chat) *rawChat {
+	return &rawChat{m.Text}
+}
+func (r *rawChat) TryParse() (*chat, error) {
+	if r.Text == "" {
+		return nil, errors.New("empty chat")
+	}
+	return &chat{r.Text}, nil
+}
+
+func init() {
+	if err := ahmp.Register(ahmp.NewCodec(CHAT_T, "CHAT", newRawChat, newRawChat)); err != nil {
+		panic(err)
+	}
+}
+
+func TestCodecRegistry(t *testing.T) {
+	if ahmp.Register(ahmp.NewCodec(CHAT_T, "CHAT", newRawChat, newRawChat)) == nil {
+		t.Fatal("duplicate type registered")
+	}
+	if ahmp.Name(CHAT_T) != "CHAT" || ahmp.Name(ahmp.SOA_T) != "SOA" {
+		t.Fatal("unexpected names")
+	}
+
+	//A is a bare network service, which sends the application message to B's host.
+	A := newNetService(t)
+	_, B_privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+	B_host, _, _ := abyss_host.NewBetaAbyssHost(context.Background(), &B_privkey, nil)
+	go B_host.ListenAndServe(context.Background())
+
+	received := make(chan string, 1)
+	B_host.HandleMessage(CHAT_T, func(peer abyss.IANDPeer, message any) {
+		if peer.IDHash() == A.LocalIdentity().IDHash() {
+			received <- message.(*chat).Text
+		}
+	})
+
+	A.AppendKnownPeer(B_host.NetworkService.LocalIdentity().RootCertificate(), B_host.NetworkService.LocalIdentity().HandshakeKeyCertificate())
+	B_host.NetworkService.AppendKnownPeer(A.LocalIdentity().RootCertificate(), A.LocalIdentity().HandshakeKeyCertificate())
+	if err := A.ConnectAbyssAsync(B_host.GetLocalAbyssURL()); err != nil {
+		t.Fatal(err)
+	}
+
+	var B abyss.IANDPeer
+	select {
+	case B = <-A.GetAbyssPeerChannel():
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection timeout")
+	}
+	if !B.TrySend(&chat{"hello"}) {
+		t.Fatal("failed to send")
+	}
+
+	select {
+	case text := <-received:
+		if text != "hello" {
+			t.Fatal("unexpected message " + text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not received")
+	}
+}
+
+func TestCodecSessionIDs(t *testing.T) {
+	sender, recver := uuid.New(), uuid.New()
+	for _, message := range []any{
+		&ahmp.JOK{SenderSessionID: sender, RecverSessionID: recver},
+		&ahmp.SOT{SenderSessionID: sender, RecverSessionID: recver},
+		&ahmp.OHO{SenderSessionID: sender, RecverSessionID: recver},
+		&ahmp.RSR{SenderSessionID: sender, RecverSessionID: recver},
+	} {
+		if s, r, ok := ahmp.SessionIDs(message); !ok || s != sender || r != recver {
+			t.Fatalf("unexpected session IDs of %T", message)
+		}
+	}
+	if s, r, ok := ahmp.SessionIDs(&ahmp.JN{SenderSessionID: sender}); !ok || s != sender || r != uuid.Nil {
+		t.Fatal("unexpected session IDs of JN")
+	}
+	for _, message := range []any{&ahmp.JDN{RecverSessionID: recver}, &ahmp.RST{RecverSessionID: recver}, &ahmp.HPR{}, &chat{"hello"}} {
+		if _, _, ok := ahmp.SessionIDs(message); ok {
+			t.Fatalf("session IDs of %T", message)
+		}
+	}
+}
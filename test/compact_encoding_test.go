@@ -0,0 +1,182 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	crypto_rand "crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/google/uuid"
+
+	"github.com/MinwooWebeng/abyss_core/ahmp"
+	"github.com/MinwooWebeng/abyss_core/aurl"
+	abyss_host "github.com/MinwooWebeng/abyss_core/host"
+	abyss "github.com/MinwooWebeng/abyss_core/interfaces"
+	abyss_net "github.com/MinwooWebeng/abyss_core/net_service"
+)
+
+// TestCompactEncoding forms worlds of two compact hosts and a host that does not advertise compression.
+// The second world is introduced over the same connections, so the compact JOK and JNI omit the certificates.
+func TestCompactEncoding(t *testing.T) {
+	hosts := make([]*abyss_host.AbyssHost, 3)
+	var A_pathmap *abyss_host.SimplePathResolver
+	for i := range hosts {
+		config := &abyss_net.BetaNetServiceConfig{}
+		if i == 2 {
+			config.DisabledCapabilities = abyss.CAP_COMPRESSION
+		}
+		_, privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+		host, pathmap, err := abyss_host.NewBetaAbyssHostWithConfig(context.Background(), &privkey, nil, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			A_pathmap = pathmap
+		}
+		hosts[i] = host
+		go host.ListenAndServe(context.Background())
+	}
+	A_host := hosts[0]
+	for _, host := range hosts[1:] {
+		A_host.NetworkService.AppendKnownPeer(host.NetworkService.LocalIdentity().RootCertificate(), host.NetworkService.LocalIdentity().HandshakeKeyCertificate())
+		host.NetworkService.AppendKnownPeer(A_host.NetworkService.LocalIdentity().RootCertificate(), A_host.NetworkService.LocalIdentity().HandshakeKeyCertificate())
+	}
+
+	for _, path := range []string{"/first", "/second"} {
+		A_world, _ := A_host.OpenWorld("http://a.world.com" + path)
+		A_pathmap.TrySetMapping(path, A_world.SessionID())
+		world_aurl := A_host.GetLocalAbyssURL()
+		world_aurl.Path = path
+
+		members := make(chan map[string]bool, len(hosts))
+		go func() { members <- acceptMembers(A_world.GetEventChannel(), 2) }()
+		for _, host := range hosts[1:] {
+			join_ctx, join_ctx_cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			world, err := host.JoinWorld(join_ctx, world_aurl)
+			join_ctx_cancel()
+			if err != nil {
+				t.Fatal(err)
+			}
+			go func() { members <- acceptMembers(world.GetEventChannel(), 2) }()
+		}
+
+		timeout := time.After(10 * time.Second)
+		for range hosts {
+			select {
+			case <-members:
+			case <-timeout:
+				t.Fatal("world " + path + " not formed")
+			}
+		}
+	}
+}
+
+func sampleJOK(certificates bool) *ahmp.JOK {
+	neighbors := make([]abyss.ANDFullPeerSessionIdentity, 4)
+	for i := range neighbors {
+		neighbors[i] = abyss.ANDFullPeerSessionIdentity{
+			AURL: &aurl.AURL{
+				Scheme:    "abyss",
+				Hash:      "JKdJ2Z4mCWNy1Fp7YVvHxH5cGxbTqA3sWr8uPeLmNnoQ",
+				Addresses: []*net.UDPAddr{{IP: net.IPv4(192, 168, 0, byte(i)), Port: 1605}},
+			},
+			SessionID: uuid.New(),
+			TimeStamp: time.Now(),
+		}
+		if certificates {
+			neighbors[i].RootCertificateDer = make([]byte, 420)
+			neighbors[i].HandshakeKeyCertificateDer = make([]byte, 380)
+		}
+	}
+	return &ahmp.JOK{
+		SenderSessionID: uuid.New(),
+		RecverSessionID: uuid.New(),
+		TimeStamp:       time.Now(),
+		Text:            "http://a.world.com/home",
+		Neighbors:       neighbors,
+	}
+}
+
+func sampleSOA() *ahmp.SOA {
+	objects := make([]abyss.ObjectInfo, 16)
+	for i := range objects {
+		objects[i] = abyss.ObjectInfo{ID: uuid.New(), Addr: "carrot.aml"}
+	}
+	return &ahmp.SOA{SenderSessionID: uuid.New(), RecverSessionID: uuid.New(), Objects: objects}
+}
+
+func TestCompactEncodingSize(t *testing.T) {
+	for _, sample := range []struct {
+		name    string
+		message any
+	}{
+		{"JOK", sampleJOK(false)},
+		{"SOA", sampleSOA()},
+	} {
+		_, raw, err := ahmp.EncodeFrame(sample.message, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, compact, err := ahmp.EncodeFrame(sample.message, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(compact)*3 > len(raw)*2 {
+			t.Fatal(sample.name, "compact", len(compact), "bytes, raw", len(raw), "bytes")
+		}
+		t.Log(sample.name, "compact", len(compact), "bytes, raw", len(raw), "bytes")
+
+		var frame ahmp.RawFrame
+		if err := cbor.Unmarshal(compact, &frame); err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := ahmp.ParseFrame(&frame, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, reencoded, err := ahmp.EncodeFrame(parsed, true)
+		if err != nil || !bytes.Equal(reencoded, compact) {
+			t.Fatal(sample.name, "changed in the compact encoding")
+		}
+	}
+}
+
+func BenchmarkAhmpEncoding(b *testing.B) {
+	for _, sample := range []struct {
+		name    string
+		message any
+	}{
+		{"JOK", sampleJOK(true)},
+		{"JOK_known", sampleJOK(false)},
+		{"SOA", sampleSOA()},
+	} {
+		for _, compact := range []bool{false, true} {
+			name := sample.name + "/raw"
+			if compact {
+				name = sample.name + "/compact"
+			}
+			b.Run(name, func(b *testing.B) {
+				var size int
+				for b.Loop() {
+					_, frame, err := ahmp.EncodeFrame(sample.message, compact)
+					if err != nil {
+						b.Fatal(err)
+					}
+					var raw_frame ahmp.RawFrame
+					if err := cbor.Unmarshal(frame, &raw_frame); err != nil {
+						b.Fatal(err)
+					}
+					if _, err := ahmp.ParseFrame(&raw_frame, compact); err != nil {
+						b.Fatal(err)
+					}
+					size = len(frame)
+				}
+				b.ReportMetric(float64(size), "bytes/msg")
+			})
+		}
+	}
+}
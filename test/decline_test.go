@@ -0,0 +1,83 @@
+package test
+
+import (
+	"context"
+	"crypto/ed25519"
+	crypto_rand "crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	abyss_host "github.com/MinwooWebeng/abyss_core/host"
+	abyss "github.com/MinwooWebeng/abyss_core/interfaces"
+)
+
+// TestDeclineSession checks that the reason of a decline reaches the peer, both for a join and for a member.
+func TestDeclineSession(t *testing.T) {
+	_, A_privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+	_, B_privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+	A_host, A_pathmap, _ := abyss_host.NewBetaAbyssHost(context.Background(), &A_privkey, nil)
+	B_host, _, _ := abyss_host.NewBetaAbyssHost(context.Background(), &B_privkey, nil)
+
+	go A_host.ListenAndServe(context.Background())
+	go B_host.ListenAndServe(context.Background())
+
+	A_host.NetworkService.AppendKnownPeer(B_host.NetworkService.LocalIdentity().RootCertificate(), B_host.NetworkService.LocalIdentity().HandshakeKeyCertificate())
+	B_host.NetworkService.AppendKnownPeer(A_host.NetworkService.LocalIdentity().RootCertificate(), A_host.NetworkService.LocalIdentity().HandshakeKeyCertificate())
+	A_hash := A_host.NetworkService.LocalIdentity().IDHash()
+	B_hash := B_host.NetworkService.LocalIdentity().IDHash()
+
+	A_world, _ := A_host.OpenWorld("http://a.world.com")
+	A_pathmap.TrySetMapping("/home", A_world.SessionID())
+	world_aurl := A_host.GetLocalAbyssURL()
+	world_aurl.Path = "/home"
+
+	//A declines the join.
+	go func() {
+		event := (<-A_world.GetEventChannel()).(abyss.EWorldMemberRequest)
+		event.Decline(601, "world is full")
+	}()
+	join_ctx, join_ctx_cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	_, err := B_host.JoinWorld(join_ctx, world_aurl)
+	join_ctx_cancel()
+	var join_err *abyss_host.JoinError
+	if !errors.As(err, &join_err) || join_err.Code != 601 || join_err.Message != "world is full" {
+		t.Fatal("unexpected join error", err)
+	}
+
+	//A accepts the next join, then declines B as a member.
+	A_request := make(chan abyss.EWorldMemberRequest, 1)
+	go func() {
+		for {
+			switch event := (<-A_world.GetEventChannel()).(type) {
+			case abyss.EWorldMemberRequest:
+				event.Accept()
+				A_request <- event
+			case abyss.EWorldMemberReady:
+				return
+			}
+		}
+	}()
+	join_ctx, join_ctx_cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	B_world, err := B_host.JoinWorld(join_ctx, world_aurl)
+	join_ctx_cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	readyMembers(B_world.GetEventChannel(), 1)
+	request := <-A_request
+	for {
+		if _, ok := A_world.Member(B_hash); ok {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	request.Decline(602, "kicked")
+	if leave := nextEvent[abyss.EWorldMemberLeave](t, A_world.GetEventChannel()); leave.PeerHash != B_hash || leave.Code != 0 {
+		t.Fatal("unexpected leave", leave)
+	}
+	if leave := nextEvent[abyss.EWorldMemberLeave](t, B_world.GetEventChannel()); leave.PeerHash != A_hash || leave.Code != 602 || leave.Message != "kicked" {
+		t.Fatal("unexpected leave", leave)
+	}
+}
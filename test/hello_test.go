@@ -0,0 +1,52 @@
+package test
+
+import (
+	"context"
+	"crypto/ed25519"
+	crypto_rand "crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/MinwooWebeng/abyss_core/ahmp"
+	abyss "github.com/MinwooWebeng/abyss_core/interfaces"
+	abyss_net "github.com/MinwooWebeng/abyss_core/net_service"
+)
+
+func newNetService(t *testing.T) *abyss_net.BetaNetService {
+	_, privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+	address_selector, err := abyss_net.NewBetaAddressSelector()
+	if err != nil {
+		t.Fatal(err)
+	}
+	net_service, err := abyss_net.NewBetaNetService(context.Background(), &privkey, address_selector, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go net_service.ListenAndServe()
+	return net_service
+}
+
+func TestHello(t *testing.T) {
+	A := newNetService(t)
+	B := newNetService(t)
+	A.AppendKnownPeer(B.LocalIdentity().RootCertificate(), B.LocalIdentity().HandshakeKeyCertificate())
+	B.AppendKnownPeer(A.LocalIdentity().RootCertificate(), A.LocalIdentity().HandshakeKeyCertificate())
+
+	if err := B.ConnectAbyssAsync(A.LocalAURL()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, peer_ch := range []chan abyss.IANDPeer{A.GetAbyssPeerChannel(), B.GetAbyssPeerChannel()} {
+		select {
+		case peer := <-peer_ch:
+			if peer.ProtocolVersion() != ahmp.AHMP_VERSION {
+				t.Fatal("unexpected protocol version", peer.ProtocolVersion())
+			}
+			if peer.Capabilities() != abyss_net.LOCAL_CAPABILITIES {
+				t.Fatal("unexpected capabilities", peer.Capabilities())
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("connection timeout")
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package test
+
+import (
+	"context"
+	"crypto/ed25519"
+	crypto_rand "crypto/rand"
+	"net"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	abyss_host "github.com/MinwooWebeng/abyss_core/host"
+	abyss_net "github.com/MinwooWebeng/abyss_core/net_service"
+)
+
+// natPacketConn emulates a port-restricted cone NAT in front of a host.
+// Inbound packets are dropped unless the host has sent a packet to the source address before.
+// Blocked addresses are never received from, as if they were behind a symmetric NAT.
+type natPacketConn struct {
+	net.PacketConn
+
+	opened  map[netip.AddrPort]bool
+	blocked map[netip.AddrPort]bool
+	dropped int
+	mtx     sync.Mutex
+}
+
+func newNATPacketConn() (*natPacketConn, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if err != nil {
+		return nil, err
+	}
+	return &natPacketConn{
+		PacketConn: conn,
+		opened:     make(map[netip.AddrPort]bool),
+		blocked:    make(map[netip.AddrPort]bool),
+	}, nil
+}
+
+func natKey(addr net.Addr) netip.AddrPort {
+	addr_port := addr.(*net.UDPAddr).AddrPort()
+	return netip.AddrPortFrom(addr_port.Addr().Unmap(), addr_port.Port())
+}
+
+func (c *natPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	c.mtx.Lock()
+	c.opened[natKey(addr)] = true
+	c.mtx.Unlock()
+	return c.PacketConn.WriteTo(p, addr)
+}
+
+func (c *natPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(p)
+		if err != nil {
+			return n, addr, err
+		}
+		c.mtx.Lock()
+		ok := c.opened[natKey(addr)] && !c.blocked[natKey(addr)]
+		if !ok {
+			c.dropped++
+		}
+		c.mtx.Unlock()
+		if ok {
+			return n, addr, err
+		}
+	}
+}
+
+func (c *natPacketConn) Block(addr net.Addr) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.blocked[natKey(addr)] = true
+}
+
+func (c *natPacketConn) Dropped() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.dropped
+}
+
+func newNATHost(t *testing.T) (*abyss_host.AbyssHost, *natPacketConn) {
+	nat_conn, err := newNATPacketConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+	host, _, err := abyss_host.NewBetaAbyssHostWithConfig(context.Background(), &privkey, nil, &abyss_net.BetaNetServiceConfig{
+		PacketConn: nat_conn,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return host, nat_conn
+}
+
+func TestHolePunch(t *testing.T) {
+	//A and C are behind NATs. B is public, and introduces them to each other.
+	A_host, A_nat := newNATHost(t)
+	C_host, C_nat := newNATHost(t)
+	_, B_privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+	B_host, B_pathmap, _ := abyss_host.NewBetaAbyssHost(context.Background(), &B_privkey, nil)
+
+	go A_host.ListenAndServe(context.Background())
+	go B_host.ListenAndServe(context.Background())
+	go C_host.ListenAndServe(context.Background())
+
+	for _, joiner := range []*abyss_host.AbyssHost{A_host, C_host} {
+		joiner.NetworkService.AppendKnownPeer(
+			B_host.NetworkService.LocalIdentity().RootCertificate(),
+			B_host.NetworkService.LocalIdentity().HandshakeKeyCertificate(),
+		)
+		B_host.NetworkService.AppendKnownPeer(
+			joiner.NetworkService.LocalIdentity().RootCertificate(),
+			joiner.NetworkService.LocalIdentity().HandshakeKeyCertificate(),
+		)
+	}
+
+	B_world, _ := B_host.OpenWorld("http://b.world.com")
+	B_pathmap.TrySetMapping("/home", B_world.SessionID())
+	world_aurl := B_host.GetLocalAbyssURL()
+	world_aurl.Path = "/home"
+
+	B_hash := B_host.GetLocalAbyssURL().Hash
+	A_hash := A_host.GetLocalAbyssURL().Hash
+	C_hash := C_host.GetLocalAbyssURL().Hash
+
+	//the joiners dial B, so that their NATs open for B.
+	join_ctx, join_ctx_cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer join_ctx_cancel()
+	done := make(chan bool, 2)
+	join := func(host *abyss_host.AbyssHost, other_hash string) {
+		world, err := host.JoinWorld(join_ctx, world_aurl)
+		if err != nil {
+			done <- false
+			return
+		}
+		members := acceptMembers(world.GetEventChannel(), 2)
+		done <- members[B_hash] && members[other_hash]
+	}
+	go join(A_host, C_hash)
+	go join(C_host, A_hash)
+	go acceptMembers(B_world.GetEventChannel(), 2)
+
+	for range 2 {
+		select {
+		case ok := <-done:
+			if !ok {
+				t.Fatal("join failed")
+			}
+		case <-time.After(15 * time.Second):
+			t.Fatal("A and C did not meet through NAT")
+		}
+	}
+	t.Log("packets dropped by NAT: A", A_nat.Dropped(), "C", C_nat.Dropped())
+}
@@ -446,13 +446,130 @@ func TestKnownPeerUpdate(t *testing.T) {
 		wait_for_A_C_discovery <- true
 	}()
 	ev_ch := B_world.GetEventChannel()
-	(<-ev_ch).(abyss.EWorldMemberRequest).Accept()
-	assert((<-ev_ch).(abyss.EWorldMemberReady).Member.Hash() == A_host.GetLocalAbyssURL().Hash)
-	(<-ev_ch).(abyss.EWorldMemberRequest).Accept()
-	assert((<-ev_ch).(abyss.EWorldMemberReady).Member.Hash() == C_host.GetLocalAbyssURL().Hash)
+	B_members := acceptMembers(ev_ch, 2) //A's MEM and C's JN arrive on different connections, in any order.
+	assert(B_members[A_host.GetLocalAbyssURL().Hash] && B_members[C_host.GetLocalAbyssURL().Hash])
 
 	<-wait_for_A_C_discovery
 	<-wait_for_A_C_discovery
 
 	<-time.After(time.Second * 5)
 }
+
+// acceptMembers accepts every join request until count members are ready, and returns the ready members.
+func acceptMembers(ev_ch chan any, count int) map[string]bool {
+	result := make(map[string]bool)
+	for len(result) < count {
+		switch event := (<-ev_ch).(type) {
+		case abyss.EWorldMemberRequest:
+			event.Accept()
+		case abyss.EWorldMemberReady:
+			result[event.Member.Hash()] = true
+		default:
+			panic("unexpected world event")
+		}
+	}
+	return result
+}
+
+// waitMemberLeave skips events until the member leaves, or fails on timeout.
+func waitMemberLeave(ev_ch chan any, peer_hash string, timeout time.Duration) bool {
+	timeout_ch := time.After(timeout)
+	for {
+		select {
+		case <-timeout_ch:
+			return false
+		case event_unknown := <-ev_ch:
+			if event, ok := event_unknown.(abyss.EWorldMemberLeave); ok && event.PeerHash == peer_hash {
+				return true
+			}
+		}
+	}
+}
+
+func TestPeerDisconnect(t *testing.T) {
+	_, A_privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+	_, B_privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+	_, C_privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+
+	C_ctx, C_ctx_cancel := context.WithCancel(context.Background())
+
+	A_host, _, _ := abyss_host.NewBetaAbyssHost(context.Background(), &A_privkey, nil)
+	B_host, B_pathmap, _ := abyss_host.NewBetaAbyssHost(context.Background(), &B_privkey, nil)
+	C_host, _, _ := abyss_host.NewBetaAbyssHost(C_ctx, &C_privkey, nil)
+
+	go A_host.ListenAndServe(context.Background())
+	go B_host.ListenAndServe(context.Background())
+	go C_host.ListenAndServe(C_ctx)
+
+	A_host.NetworkService.AppendKnownPeer(
+		B_host.NetworkService.LocalIdentity().RootCertificate(),
+		B_host.NetworkService.LocalIdentity().HandshakeKeyCertificate(),
+	)
+	B_host.NetworkService.AppendKnownPeer(
+		A_host.NetworkService.LocalIdentity().RootCertificate(),
+		A_host.NetworkService.LocalIdentity().HandshakeKeyCertificate(),
+	)
+	B_host.NetworkService.AppendKnownPeer(
+		C_host.NetworkService.LocalIdentity().RootCertificate(),
+		C_host.NetworkService.LocalIdentity().HandshakeKeyCertificate(),
+	)
+	C_host.NetworkService.AppendKnownPeer(
+		B_host.NetworkService.LocalIdentity().RootCertificate(),
+		B_host.NetworkService.LocalIdentity().HandshakeKeyCertificate(),
+	)
+
+	B_world, _ := B_host.OpenWorld("http://b.world.com")
+	B_pathmap.TrySetMapping("/home", B_world.SessionID())
+	world_aurl := B_host.GetLocalAbyssURL()
+	world_aurl.Path = "/home"
+
+	B_host.OpenOutboundConnection(A_host.GetLocalAbyssURL())
+	B_host.OpenOutboundConnection(C_host.GetLocalAbyssURL())
+
+	C_hash := C_host.GetLocalAbyssURL().Hash
+
+	wait_for_A_join := make(chan bool)
+	A_world_ch := make(chan chan any, 1)
+	C_done := make(chan bool, 1)
+	go func() {
+		world, _ := A_host.JoinWorld(context.Background(), world_aurl)
+		ev_ch := world.GetEventChannel()
+		(<-ev_ch).(abyss.EWorldMemberRequest).Accept()
+		assert((<-ev_ch).(abyss.EWorldMemberReady).Member.Hash() == B_host.GetLocalAbyssURL().Hash)
+
+		wait_for_A_join <- true
+
+		(<-ev_ch).(abyss.EWorldMemberRequest).Accept()
+		assert((<-ev_ch).(abyss.EWorldMemberReady).Member.Hash() == C_hash)
+
+		A_world_ch <- ev_ch
+	}()
+	go func() {
+		<-wait_for_A_join
+
+		world, _ := C_host.JoinWorld(context.Background(), world_aurl)
+		ev_ch := world.GetEventChannel()
+		(<-ev_ch).(abyss.EWorldMemberRequest).Accept()
+		assert((<-ev_ch).(abyss.EWorldMemberReady).Member.Hash() == B_host.GetLocalAbyssURL().Hash)
+		(<-ev_ch).(abyss.EWorldMemberRequest).Accept()
+		assert((<-ev_ch).(abyss.EWorldMemberReady).Member.Hash() == A_host.GetLocalAbyssURL().Hash)
+
+		C_done <- true
+	}()
+	B_ev_ch := B_world.GetEventChannel()
+	B_members := acceptMembers(B_ev_ch, 2)
+	assert(B_members[A_host.GetLocalAbyssURL().Hash] && B_members[C_hash])
+
+	A_ev_ch := <-A_world_ch
+	<-C_done
+
+	//kill C
+	C_ctx_cancel()
+
+	if !waitMemberLeave(B_ev_ch, C_hash, 5*time.Second) {
+		t.Fatal("B did not see C leave")
+	}
+	if !waitMemberLeave(A_ev_ch, C_hash, 5*time.Second) {
+		t.Fatal("A did not see C leave")
+	}
+}
@@ -0,0 +1,120 @@
+package test
+
+import (
+	"context"
+	"crypto/ed25519"
+	crypto_rand "crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	abyss_host "github.com/MinwooWebeng/abyss_core/host"
+	abyss "github.com/MinwooWebeng/abyss_core/interfaces"
+)
+
+// acceptAll accepts every join request, and drops other events.
+func acceptAll(ev_ch chan any) {
+	for event_any := range ev_ch {
+		if event, ok := event_any.(abyss.EWorldMemberRequest); ok {
+			event.Accept()
+		}
+	}
+}
+
+// TestLateJoinSync checks that a late joiner receives the objects that A published before it joined,
+// without any app code on A's side.
+func TestLateJoinSync(t *testing.T) {
+	hosts := make([]*abyss_host.AbyssHost, 3)
+	var A_pathmap *abyss_host.SimplePathResolver
+	for i := range hosts {
+		_, privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+		host, pathmap, err := abyss_host.NewBetaAbyssHost(context.Background(), &privkey, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			A_pathmap = pathmap
+		}
+		hosts[i] = host
+		go host.ListenAndServe(context.Background())
+	}
+	for _, host := range hosts {
+		for _, other := range hosts {
+			if host != other {
+				host.NetworkService.AppendKnownPeer(other.NetworkService.LocalIdentity().RootCertificate(), other.NetworkService.LocalIdentity().HandshakeKeyCertificate())
+			}
+		}
+	}
+	A_hash := hosts[0].NetworkService.LocalIdentity().IDHash()
+
+	A_world, _ := hosts[0].OpenWorld("http://a.world.com")
+	A_pathmap.TrySetMapping("/home", A_world.SessionID())
+	world_aurl := hosts[0].GetLocalAbyssURL()
+	world_aurl.Path = "/home"
+
+	//A publishes objects to B, then deletes one of them.
+	A_B_member := make(chan abyss.IWorldMember, 1)
+	go func() {
+		for {
+			switch event := (<-A_world.GetEventChannel()).(type) {
+			case abyss.EWorldMemberRequest:
+				event.Accept()
+			case abyss.EWorldMemberReady:
+				A_B_member <- event.Member
+				return
+			}
+		}
+	}()
+	join_ctx, join_ctx_cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	B_world, err := hosts[1].JoinWorld(join_ctx, world_aurl)
+	join_ctx_cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go acceptAll(B_world.GetEventChannel())
+
+	var member abyss.IWorldMember
+	select {
+	case member = <-A_B_member:
+	case <-time.After(5 * time.Second):
+		t.Fatal("B not ready")
+	}
+	kept := abyss.ObjectInfo{ID: uuid.New(), Addr: "carrot.aml"}
+	deleted := abyss.ObjectInfo{ID: uuid.New(), Addr: "potato.aml"}
+	member.AppendObjects([]abyss.ObjectInfo{kept, deleted})
+	member.DeleteObjects([]uuid.UUID{deleted.ID})
+
+	//A accepts C, and does nothing else.
+	go acceptMembers(A_world.GetEventChannel(), 1)
+	join_ctx, join_ctx_cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	C_world, err := hosts[2].JoinWorld(join_ctx, world_aurl)
+	join_ctx_cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case event_any := <-C_world.GetEventChannel():
+			switch event := event_any.(type) {
+			case abyss.EWorldMemberRequest:
+				event.Accept()
+			case abyss.EWorldMemberReady:
+			case abyss.EMemberObjectAppend:
+				if event.PeerHash != A_hash || len(event.Objects) != 1 || event.Objects[0].ID != kept.ID {
+					t.Fatal("unexpected objects", event)
+				}
+				if _, ok := C_world.Object(A_hash, kept.ID); !ok {
+					t.Fatal("replayed object not registered")
+				}
+				return
+			default:
+				t.Fatalf("unexpected event %T", event_any)
+			}
+		case <-timeout:
+			t.Fatal("objects not replayed")
+		}
+	}
+}
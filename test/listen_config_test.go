@@ -0,0 +1,65 @@
+package test
+
+import (
+	"context"
+	"crypto/ed25519"
+	crypto_rand "crypto/rand"
+	"net"
+	"testing"
+
+	abyss_host "github.com/MinwooWebeng/abyss_core/host"
+	abyss_net "github.com/MinwooWebeng/abyss_core/net_service"
+)
+
+func TestListenConfig(t *testing.T) {
+	//occupy a port, so that the next one in range is taken.
+	occupied, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer occupied.Close()
+	occupied_port := occupied.LocalAddr().(*net.UDPAddr).Port
+
+	_, A_privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+	A_host, _, err := abyss_host.NewBetaAbyssHostWithConfig(context.Background(), &A_privkey, nil, &abyss_net.BetaNetServiceConfig{
+		BindIP:       net.IPv4(127, 0, 0, 1),
+		Port:         occupied_port,
+		PortRangeEnd: occupied_port + 16,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	A_addresses := A_host.GetLocalAbyssURL().Addresses
+	if len(A_addresses) != 1 || !A_addresses[0].IP.Equal(net.IPv4(127, 0, 0, 1)) ||
+		A_addresses[0].Port <= occupied_port || A_addresses[0].Port > occupied_port+16 {
+		t.Fatal("unexpected local AURL: " + A_host.GetLocalAbyssURL().ToString())
+	}
+
+	//already-open PacketConn
+	B_conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv6unspecified, Port: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, B_privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+	B_host, _, err := abyss_host.NewBetaAbyssHostWithConfig(context.Background(), &B_privkey, nil, &abyss_net.BetaNetServiceConfig{
+		PacketConn: B_conn,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, address := range B_host.GetLocalAbyssURL().Addresses {
+		if address.Port != B_conn.LocalAddr().(*net.UDPAddr).Port {
+			t.Fatal("unexpected local AURL: " + B_host.GetLocalAbyssURL().ToString())
+		}
+	}
+
+	//no port in range
+	_, C_privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+	_, _, err = abyss_host.NewBetaAbyssHostWithConfig(context.Background(), &C_privkey, nil, &abyss_net.BetaNetServiceConfig{
+		BindIP: net.IPv4(127, 0, 0, 1),
+		Port:   occupied_port,
+	})
+	if err == nil {
+		t.Fatal("listening on an occupied port succeeded")
+	}
+}
@@ -0,0 +1,115 @@
+package test
+
+import (
+	"context"
+	"crypto/ed25519"
+	crypto_rand "crypto/rand"
+	"slices"
+	"testing"
+	"time"
+
+	abyss_host "github.com/MinwooWebeng/abyss_core/host"
+	abyss "github.com/MinwooWebeng/abyss_core/interfaces"
+)
+
+func memberHashes(world abyss.IAbyssWorld) []string {
+	var result []string
+	for _, member := range world.Members() {
+		result = append(result, member.Hash())
+	}
+	return result
+}
+
+func TestMembers(t *testing.T) {
+	hosts := make([]*abyss_host.AbyssHost, 3)
+	var A_pathmap *abyss_host.SimplePathResolver
+	for i := range hosts {
+		_, privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+		host, pathmap, err := abyss_host.NewBetaAbyssHost(context.Background(), &privkey, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			A_pathmap = pathmap
+		}
+		hosts[i] = host
+		go host.ListenAndServe(context.Background())
+	}
+	for _, host := range hosts {
+		for _, other := range hosts {
+			if host != other {
+				host.NetworkService.AppendKnownPeer(other.NetworkService.LocalIdentity().RootCertificate(), other.NetworkService.LocalIdentity().HandshakeKeyCertificate())
+			}
+		}
+	}
+	B_hash := hosts[1].NetworkService.LocalIdentity().IDHash()
+	C_hash := hosts[2].NetworkService.LocalIdentity().IDHash()
+
+	A_world, _ := hosts[0].OpenWorld("http://a.world.com")
+	A_pathmap.TrySetMapping("/home", A_world.SessionID())
+	world_aurl := hosts[0].GetLocalAbyssURL()
+	world_aurl.Path = "/home"
+	if len(A_world.Members()) != 0 {
+		t.Fatal("members in a new world")
+	}
+
+	//a member is in the snapshot by the time its ready event is delivered.
+	formed := make(chan bool, len(hosts))
+	go func() {
+		for ready := 0; ready < 2; {
+			switch event := (<-A_world.GetEventChannel()).(type) {
+			case abyss.EWorldMemberRequest:
+				event.Accept()
+			case abyss.EWorldMemberReady:
+				member, ok := A_world.Member(event.Member.Hash())
+				if !ok || member.SessionID() != event.Member.SessionID() {
+					panic("ready member not in the snapshot")
+				}
+				ready++
+			}
+		}
+		formed <- true
+	}()
+
+	var C_world abyss.IAbyssWorld
+	for i, host := range hosts[1:] {
+		join_ctx, join_ctx_cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		world, err := host.JoinWorld(join_ctx, world_aurl)
+		join_ctx_cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 1 {
+			C_world = world
+		}
+		go func() {
+			acceptMembers(world.GetEventChannel(), 2)
+			formed <- true
+		}()
+	}
+	timeout := time.After(10 * time.Second)
+	for range hosts {
+		select {
+		case <-formed:
+		case <-timeout:
+			t.Fatal("world not formed")
+		}
+	}
+
+	expected := []string{B_hash, C_hash}
+	slices.Sort(expected)
+	if !slices.Equal(memberHashes(A_world), expected) {
+		t.Fatal("unexpected members", memberHashes(A_world))
+	}
+
+	hosts[2].LeaveWorld(C_world)
+	if !waitMemberLeave(A_world.GetEventChannel(), C_hash, 10*time.Second) {
+		t.Fatal("member leave not received")
+	}
+	if !slices.Equal(memberHashes(A_world), []string{B_hash}) {
+		t.Fatal("unexpected members after leave", memberHashes(A_world))
+	}
+	if _, ok := A_world.Member(C_hash); ok {
+		t.Fatal("left member found")
+	}
+}
@@ -0,0 +1,117 @@
+package test
+
+import (
+	"context"
+	"crypto/ed25519"
+	crypto_rand "crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	abyss_host "github.com/MinwooWebeng/abyss_core/host"
+	abyss "github.com/MinwooWebeng/abyss_core/interfaces"
+)
+
+func nextEvent[T any](t *testing.T, ev_ch <-chan any) T {
+	select {
+	case event_any := <-ev_ch:
+		event, ok := event_any.(T)
+		if !ok {
+			t.Fatalf("unexpected event %T", event_any)
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("event not received")
+	}
+	panic("unreachable")
+}
+
+func TestObjectRegistry(t *testing.T) {
+	_, A_privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+	_, B_privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+	A_host, A_pathmap, _ := abyss_host.NewBetaAbyssHost(context.Background(), &A_privkey, nil)
+	B_host, _, _ := abyss_host.NewBetaAbyssHost(context.Background(), &B_privkey, nil)
+
+	go A_host.ListenAndServe(context.Background())
+	go B_host.ListenAndServe(context.Background())
+
+	A_host.NetworkService.AppendKnownPeer(B_host.NetworkService.LocalIdentity().RootCertificate(), B_host.NetworkService.LocalIdentity().HandshakeKeyCertificate())
+	B_host.NetworkService.AppendKnownPeer(A_host.NetworkService.LocalIdentity().RootCertificate(), A_host.NetworkService.LocalIdentity().HandshakeKeyCertificate())
+	B_hash := B_host.NetworkService.LocalIdentity().IDHash()
+
+	A_world, _ := A_host.OpenWorld("http://a.world.com")
+	A_pathmap.TrySetMapping("/home", A_world.SessionID())
+	world_aurl := A_host.GetLocalAbyssURL()
+	world_aurl.Path = "/home"
+
+	A_members := make(chan map[string]bool, 1)
+	go func() { A_members <- acceptMembers(A_world.GetEventChannel(), 1) }()
+	join_ctx, join_ctx_cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer join_ctx_cancel()
+	B_world, err := B_host.JoinWorld(join_ctx, world_aurl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var A_member abyss.IWorldMember
+	for A_member == nil {
+		switch event := (<-B_world.GetEventChannel()).(type) {
+		case abyss.EWorldMemberRequest:
+			event.Accept()
+		case abyss.EWorldMemberReady:
+			A_member = event.Member
+		}
+	}
+	<-A_members
+
+	objects := []abyss.ObjectInfo{
+		{ID: uuid.New(), Addr: "carrot.aml"},
+		{ID: uuid.New(), Addr: "potato.aml"},
+		{ID: uuid.New(), Addr: "onion.aml"},
+	}
+	A_member.AppendObjects(objects)
+	nextEvent[abyss.EMemberObjectAppend](t, A_world.GetEventChannel())
+
+	if len(A_world.Objects()) != 3 || len(A_world.MemberObjects(B_hash)) != 3 {
+		t.Fatal("objects not registered")
+	}
+	if object, ok := A_world.Object(B_hash, objects[1].ID); !ok || object.Addr != "potato.aml" {
+		t.Fatal("object lookup failed")
+	}
+
+	//the subscription starts from the snapshot.
+	snapshot, object_ch, unsubscribe := A_world.SubscribeObjects()
+	defer unsubscribe()
+	if len(snapshot) != 3 || snapshot[0].OwnerHash != B_hash {
+		t.Fatal("unexpected snapshot", snapshot)
+	}
+
+	A_member.DeleteObjects([]uuid.UUID{objects[0].ID})
+	if deleted := nextEvent[abyss.EMemberObjectDelete](t, object_ch); deleted.ObjectIDs[0] != objects[0].ID {
+		t.Fatal("unexpected delete", deleted)
+	}
+	nextEvent[abyss.EMemberObjectDelete](t, A_world.GetEventChannel())
+	if _, ok := A_world.Object(B_hash, objects[0].ID); ok {
+		t.Fatal("deleted object found")
+	}
+
+	A_member.UpdateTransforms([]abyss.ObjectTransform{{ID: objects[1].ID, Transform: [7]float32{1}}})
+	nextEvent[abyss.EMemberObjectTransform](t, object_ch)
+	nextEvent[abyss.EMemberObjectTransform](t, A_world.GetEventChannel())
+	if object, _ := A_world.Object(B_hash, objects[1].ID); object.Transform[0] != 1 {
+		t.Fatal("transform not applied")
+	}
+
+	//the remaining objects are deleted when B leaves.
+	B_host.LeaveWorld(B_world)
+	if deleted := nextEvent[abyss.EMemberObjectDelete](t, A_world.GetEventChannel()); deleted.PeerHash != B_hash || len(deleted.ObjectIDs) != 2 {
+		t.Fatal("unexpected delete on leave", deleted)
+	}
+	nextEvent[abyss.EWorldMemberLeave](t, A_world.GetEventChannel())
+	if deleted := nextEvent[abyss.EMemberObjectDelete](t, object_ch); len(deleted.ObjectIDs) != 2 {
+		t.Fatal("unexpected delete on leave", deleted)
+	}
+	if len(A_world.Objects()) != 0 {
+		t.Fatal("objects remain after leave")
+	}
+}
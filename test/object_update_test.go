@@ -0,0 +1,128 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	crypto_rand "crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/google/uuid"
+
+	"github.com/MinwooWebeng/abyss_core/ahmp"
+	abyss_host "github.com/MinwooWebeng/abyss_core/host"
+	abyss "github.com/MinwooWebeng/abyss_core/interfaces"
+)
+
+func TestObjectUpdate(t *testing.T) {
+	_, A_privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+	_, B_privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+	A_host, A_pathmap, _ := abyss_host.NewBetaAbyssHost(context.Background(), &A_privkey, nil)
+	B_host, _, _ := abyss_host.NewBetaAbyssHost(context.Background(), &B_privkey, nil)
+
+	go A_host.ListenAndServe(context.Background())
+	go B_host.ListenAndServe(context.Background())
+
+	A_host.NetworkService.AppendKnownPeer(B_host.NetworkService.LocalIdentity().RootCertificate(), B_host.NetworkService.LocalIdentity().HandshakeKeyCertificate())
+	B_host.NetworkService.AppendKnownPeer(A_host.NetworkService.LocalIdentity().RootCertificate(), A_host.NetworkService.LocalIdentity().HandshakeKeyCertificate())
+	B_hash := B_host.NetworkService.LocalIdentity().IDHash()
+
+	A_world, _ := A_host.OpenWorld("http://a.world.com")
+	A_pathmap.TrySetMapping("/home", A_world.SessionID())
+	world_aurl := A_host.GetLocalAbyssURL()
+	world_aurl.Path = "/home"
+
+	A_members := make(chan map[string]bool, 1)
+	go func() { A_members <- acceptMembers(A_world.GetEventChannel(), 1) }()
+	join_ctx, join_ctx_cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer join_ctx_cancel()
+	B_world, err := B_host.JoinWorld(join_ctx, world_aurl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var A_member abyss.IWorldMember
+	for A_member == nil {
+		switch event := (<-B_world.GetEventChannel()).(type) {
+		case abyss.EWorldMemberRequest:
+			event.Accept()
+		case abyss.EWorldMemberReady:
+			A_member = event.Member
+		}
+	}
+	<-A_members
+
+	id := uuid.New()
+	A_member.AppendObjects([]abyss.ObjectInfo{{
+		ID:         id,
+		Addr:       "car.aml",
+		Properties: map[string]abyss.ObjectProperty{"color": {Version: 1, Value: []byte("red")}},
+	}})
+	nextEvent[abyss.EMemberObjectAppend](t, A_world.GetEventChannel())
+
+	transform := [7]float32{1, 2, 3}
+	A_member.UpdateObjects([]abyss.ObjectUpdate{{
+		ID:        id,
+		Transform: &transform,
+		Properties: map[string]abyss.ObjectProperty{
+			"color": {Version: 2, Value: []byte("blue")},
+			"speed": {Version: 1, Value: []byte{10}},
+		},
+	}})
+	updated := nextEvent[abyss.EMemberObjectUpdate](t, A_world.GetEventChannel())
+	if updated.PeerHash != B_hash || len(updated.Updates) != 1 || updated.Updates[0].Addr != nil || *updated.Updates[0].Transform != transform {
+		t.Fatal("unexpected update", updated)
+	}
+
+	//a stale property is dropped, while the rest of the update applies.
+	addr := "truck.aml"
+	A_member.UpdateObjects([]abyss.ObjectUpdate{{
+		ID:         id,
+		Addr:       &addr,
+		Properties: map[string]abyss.ObjectProperty{"color": {Version: 1, Value: []byte("green")}},
+	}})
+	updated = nextEvent[abyss.EMemberObjectUpdate](t, A_world.GetEventChannel())
+	if *updated.Updates[0].Addr != addr || updated.Updates[0].Properties != nil {
+		t.Fatal("unexpected update", updated)
+	}
+
+	object, ok := A_world.Object(B_hash, id)
+	if !ok || object.Addr != addr || object.Transform != transform ||
+		string(object.Properties["color"].Value) != "blue" || object.Properties["speed"].Version != 1 {
+		t.Fatal("updates not applied", object)
+	}
+}
+
+func TestObjectUpdateEncoding(t *testing.T) {
+	addr := "truck.aml"
+	message := &ahmp.SOU{
+		SenderSessionID: uuid.New(),
+		RecverSessionID: uuid.New(),
+		Updates: []abyss.ObjectUpdate{
+			{ID: uuid.New(), Addr: &addr},
+			{ID: uuid.New(), Transform: &[7]float32{1}, Properties: map[string]abyss.ObjectProperty{"color": {Version: 3, Value: []byte("blue")}}},
+		},
+	}
+	for _, compact := range []bool{false, true} {
+		_, encoded, err := ahmp.EncodeFrame(message, compact)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var frame ahmp.RawFrame
+		if err := cbor.Unmarshal(encoded, &frame); err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := ahmp.ParseFrame(&frame, compact)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.(*ahmp.SOU).Updates[0].Transform != nil {
+			t.Fatal("absent field decoded")
+		}
+		_, reencoded, err := ahmp.EncodeFrame(parsed, compact)
+		if err != nil || !bytes.Equal(reencoded, encoded) {
+			t.Fatal("SOU changed in the encoding, compact:", compact)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	crypto_rand "crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/google/uuid"
+
+	"github.com/MinwooWebeng/abyss_core/ahmp"
+	abyss_host "github.com/MinwooWebeng/abyss_core/host"
+	abyss "github.com/MinwooWebeng/abyss_core/interfaces"
+)
+
+// TestOwnership hands B's object over to C on C's request, and checks that A follows the new owner.
+func TestOwnership(t *testing.T) {
+	hosts := make([]*abyss_host.AbyssHost, 3)
+	var A_pathmap *abyss_host.SimplePathResolver
+	for i := range hosts {
+		_, privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+		host, pathmap, err := abyss_host.NewBetaAbyssHost(context.Background(), &privkey, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			A_pathmap = pathmap
+		}
+		hosts[i] = host
+		go host.ListenAndServe(context.Background())
+	}
+	for _, host := range hosts {
+		for _, other := range hosts {
+			if host != other {
+				host.NetworkService.AppendKnownPeer(other.NetworkService.LocalIdentity().RootCertificate(), other.NetworkService.LocalIdentity().HandshakeKeyCertificate())
+			}
+		}
+	}
+	A_hash := hosts[0].NetworkService.LocalIdentity().IDHash()
+	B_hash := hosts[1].NetworkService.LocalIdentity().IDHash()
+	C_hash := hosts[2].NetworkService.LocalIdentity().IDHash()
+
+	A_world, _ := hosts[0].OpenWorld("http://a.world.com")
+	A_pathmap.TrySetMapping("/home", A_world.SessionID())
+	world_aurl := hosts[0].GetLocalAbyssURL()
+	world_aurl.Path = "/home"
+
+	worlds := []abyss.IAbyssWorld{A_world}
+	members := make([]chan map[string]abyss.IWorldMember, len(hosts))
+	for i := range members {
+		members[i] = make(chan map[string]abyss.IWorldMember, 1)
+	}
+	go func() { members[0] <- readyMembers(A_world.GetEventChannel(), 2) }()
+	for i, host := range hosts[1:] {
+		join_ctx, join_ctx_cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		world, err := host.JoinWorld(join_ctx, world_aurl)
+		join_ctx_cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		worlds = append(worlds, world)
+		go func() { members[i+1] <- readyMembers(world.GetEventChannel(), 2) }()
+	}
+
+	world_members := make([]map[string]abyss.IWorldMember, len(worlds))
+	timeout := time.After(10 * time.Second)
+	for i := range members {
+		select {
+		case world_members[i] = <-members[i]:
+		case <-timeout:
+			t.Fatal("world not formed")
+		}
+	}
+
+	//B shares the object with A and C.
+	object := abyss.ObjectInfo{ID: uuid.New(), Addr: "ball.aml"}
+	world_members[1][A_hash].AppendObjects([]abyss.ObjectInfo{object})
+	world_members[1][C_hash].AppendObjects([]abyss.ObjectInfo{object})
+	nextEvent[abyss.EMemberObjectAppend](t, worlds[0].GetEventChannel())
+	nextEvent[abyss.EMemberObjectAppend](t, worlds[2].GetEventChannel())
+
+	if worlds[2].RequestOwnership(A_hash, object.ID) {
+		t.Fatal("ownership requested from a non-owner")
+	}
+	if !worlds[2].RequestOwnership(B_hash, object.ID) {
+		t.Fatal("failed to request ownership")
+	}
+	request := nextEvent[abyss.EObjectOwnershipRequest](t, worlds[1].GetEventChannel())
+	if request.PeerHash != C_hash || request.ObjectID != object.ID {
+		t.Fatal("unexpected request", request)
+	}
+	if !request.Grant() {
+		t.Fatal("failed to grant ownership")
+	}
+
+	//every member observes the same handover.
+	for i, world := range worlds {
+		change := nextEvent[abyss.EObjectOwnershipChange](t, world.GetEventChannel())
+		if change.OldOwnerHash != B_hash || change.NewOwnerHash != C_hash || change.Object.ID != object.ID {
+			t.Fatal("unexpected ownership change", i, change)
+		}
+		if owner, ok := world.ObjectOwner(object.ID); !ok || owner != C_hash {
+			t.Fatal("unexpected owner", i, owner)
+		}
+	}
+	if request.Grant() {
+		t.Fatal("ownership granted twice")
+	}
+	if _, ok := A_world.Object(B_hash, object.ID); ok {
+		t.Fatal("object remains under the old owner")
+	}
+
+	//A ignores the old owner, and follows the new one.
+	world_members[1][A_hash].AppendObjects([]abyss.ObjectInfo{object})
+	addr := "bat.aml"
+	world_members[2][A_hash].UpdateObjects([]abyss.ObjectUpdate{{ID: object.ID, Addr: &addr}})
+	if updated := nextEvent[abyss.EMemberObjectUpdate](t, A_world.GetEventChannel()); updated.PeerHash != C_hash {
+		t.Fatal("unexpected update", updated)
+	}
+	select {
+	case event_any := <-A_world.GetEventChannel():
+		t.Fatalf("unexpected event %T", event_any)
+	case <-time.After(500 * time.Millisecond):
+	}
+	if moved, ok := A_world.Object(C_hash, object.ID); !ok || moved.Addr != addr {
+		t.Fatal("object not moved to the new owner", moved)
+	}
+}
+
+// TestOwnershipLateJoin hands B's object over to C, and then to A, before D joins.
+// D must follow the next handover, which it only knows from the epoch that A replays.
+func TestOwnershipLateJoin(t *testing.T) {
+	hosts := make([]*abyss_host.AbyssHost, 4)
+	var A_pathmap *abyss_host.SimplePathResolver
+	for i := range hosts {
+		_, privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+		host, pathmap, err := abyss_host.NewBetaAbyssHost(context.Background(), &privkey, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			A_pathmap = pathmap
+		}
+		hosts[i] = host
+		go host.ListenAndServe(context.Background())
+	}
+	for _, host := range hosts {
+		for _, other := range hosts {
+			if host != other {
+				host.NetworkService.AppendKnownPeer(other.NetworkService.LocalIdentity().RootCertificate(), other.NetworkService.LocalIdentity().HandshakeKeyCertificate())
+			}
+		}
+	}
+	A_hash := hosts[0].NetworkService.LocalIdentity().IDHash()
+	B_hash := hosts[1].NetworkService.LocalIdentity().IDHash()
+	C_hash := hosts[2].NetworkService.LocalIdentity().IDHash()
+
+	A_world, _ := hosts[0].OpenWorld("http://a.world.com")
+	A_pathmap.TrySetMapping("/home", A_world.SessionID())
+	world_aurl := hosts[0].GetLocalAbyssURL()
+	world_aurl.Path = "/home"
+
+	worlds := []abyss.IAbyssWorld{A_world}
+	members := make([]chan map[string]abyss.IWorldMember, 3)
+	for i := range members {
+		members[i] = make(chan map[string]abyss.IWorldMember, 1)
+	}
+	go func() { members[0] <- readyMembers(A_world.GetEventChannel(), 2) }()
+	for i, host := range hosts[1:3] {
+		join_ctx, join_ctx_cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		world, err := host.JoinWorld(join_ctx, world_aurl)
+		join_ctx_cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		worlds = append(worlds, world)
+		go func() { members[i+1] <- readyMembers(world.GetEventChannel(), 2) }()
+	}
+
+	world_members := make([]map[string]abyss.IWorldMember, len(worlds))
+	timeout := time.After(10 * time.Second)
+	for i := range members {
+		select {
+		case world_members[i] = <-members[i]:
+		case <-timeout:
+			t.Fatal("world not formed")
+		}
+	}
+
+	object := abyss.ObjectInfo{ID: uuid.New(), Addr: "ball.aml"}
+	world_members[1][A_hash].AppendObjects([]abyss.ObjectInfo{object})
+	world_members[1][C_hash].AppendObjects([]abyss.ObjectInfo{object})
+	nextEvent[abyss.EMemberObjectAppend](t, worlds[0].GetEventChannel())
+	nextEvent[abyss.EMemberObjectAppend](t, worlds[2].GetEventChannel())
+
+	//B hands it over to C, and C to A.
+	if !worlds[1].TransferOwnership(object.ID, C_hash) {
+		t.Fatal("failed to hand over to C")
+	}
+	nextEvent[abyss.EObjectOwnershipChange](t, worlds[0].GetEventChannel())
+	nextEvent[abyss.EObjectOwnershipChange](t, worlds[2].GetEventChannel())
+	if !worlds[2].TransferOwnership(object.ID, A_hash) {
+		t.Fatal("failed to hand over to A")
+	}
+	nextEvent[abyss.EObjectOwnershipChange](t, worlds[0].GetEventChannel())
+	for _, world := range worlds {
+		go acceptAll(world.GetEventChannel())
+	}
+
+	join_ctx, join_ctx_cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	D_world, err := hosts[3].JoinWorld(join_ctx, world_aurl)
+	join_ctx_cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//A hands it over to B once D has the replayed object.
+	timeout = time.After(10 * time.Second)
+	for {
+		select {
+		case event_any := <-D_world.GetEventChannel():
+			switch event := event_any.(type) {
+			case abyss.EWorldMemberRequest:
+				event.Accept()
+			case abyss.EMemberObjectAppend:
+				if event.PeerHash != A_hash || len(event.Objects) != 1 || event.Objects[0].ID != object.ID {
+					t.Fatal("unexpected objects", event)
+				}
+				if !A_world.TransferOwnership(object.ID, B_hash) {
+					t.Fatal("failed to hand over to B")
+				}
+			case abyss.EObjectOwnershipChange:
+				if event.OldOwnerHash != A_hash || event.NewOwnerHash != B_hash {
+					t.Fatal("unexpected ownership change", event)
+				}
+				if owner, ok := D_world.ObjectOwner(object.ID); !ok || owner != B_hash {
+					t.Fatal("unexpected owner", owner)
+				}
+				return
+			}
+		case <-timeout:
+			t.Fatal("handover not observed")
+		}
+	}
+}
+
+func TestOwnershipEncoding(t *testing.T) {
+	message := &ahmp.OHO{
+		SenderSessionID: uuid.New(),
+		RecverSessionID: uuid.New(),
+		Handover: abyss.ObjectHandover{
+			Object:       abyss.ObjectInfo{ID: uuid.New(), Addr: "ball.aml", Properties: map[string]abyss.ObjectProperty{"color": {Version: 1, Value: []byte("red")}}},
+			NewOwnerHash: "owner",
+			Epoch:        3,
+			TimeStamp:    time.UnixMilli(time.Now().UnixMilli()),
+		},
+	}
+	for _, compact := range []bool{false, true} {
+		_, encoded, err := ahmp.EncodeFrame(message, compact)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var frame ahmp.RawFrame
+		if err := cbor.Unmarshal(encoded, &frame); err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := ahmp.ParseFrame(&frame, compact)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handover := parsed.(*ahmp.OHO).Handover
+		if handover.Epoch != 3 || !handover.TimeStamp.Equal(message.Handover.TimeStamp) {
+			t.Fatal("OHO changed in the encoding, compact:", compact)
+		}
+		_, reencoded, err := ahmp.EncodeFrame(parsed, compact)
+		if err != nil || !bytes.Equal(reencoded, encoded) {
+			t.Fatal("OHO changed in the encoding, compact:", compact)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package test
+
+import (
+	"context"
+	"crypto/ed25519"
+	crypto_rand "crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/MinwooWebeng/abyss_core/aurl"
+	abyss_host "github.com/MinwooWebeng/abyss_core/host"
+	abyss_net "github.com/MinwooWebeng/abyss_core/net_service"
+)
+
+func waitPendingHandshakes(t *testing.T, net_service *abyss_net.BetaNetService, cond func(abyss_net.PendingHandshakeStatistics) bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond(net_service.PendingHandshakes()) {
+		if time.Now().After(deadline) {
+			t.Fatal("unexpected pending handshakes: " + net_service.PendingHandshakes().String())
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestPendingHandshake(t *testing.T) {
+	_, A_privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+	A_host, _, err := abyss_host.NewBetaAbyssHostWithConfig(context.Background(), &A_privkey, nil, &abyss_net.BetaNetServiceConfig{
+		PendingHandshakeTimeout:         2 * time.Second,
+		MaxPendingHandshakesPerSourceIP: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	A_net := A_host.NetworkService.(*abyss_net.BetaNetService)
+	go A_host.ListenAndServe(context.Background())
+
+	//the strangers know A, but A does not know them.
+	A_aurl := A_host.GetLocalAbyssURL()
+	A_loopback := &aurl.AURL{Scheme: "abyss", Hash: A_aurl.Hash, Addresses: A_aurl.Addresses[len(A_aurl.Addresses)-1:]}
+	strangers := make([]*abyss_host.AbyssHost, 2)
+	for i := range strangers {
+		_, privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+		strangers[i], _, _ = abyss_host.NewBetaAbyssHost(context.Background(), &privkey, nil)
+		go strangers[i].ListenAndServe(context.Background())
+		strangers[i].NetworkService.AppendKnownPeer(A_host.NetworkService.LocalIdentity().RootCertificate(), A_host.NetworkService.LocalIdentity().HandshakeKeyCertificate())
+	}
+
+	strangers[0].NetworkService.ConnectAbyssAsync(A_loopback)
+	waitPendingHandshakes(t, A_net, func(s abyss_net.PendingHandshakeStatistics) bool { return s.Waiting == 1 })
+
+	//same source IP. the first one is evicted.
+	strangers[1].NetworkService.ConnectAbyssAsync(A_loopback)
+	waitPendingHandshakes(t, A_net, func(s abyss_net.PendingHandshakeStatistics) bool { return s.Waiting == 1 && s.Evicted == 1 })
+
+	waitPendingHandshakes(t, A_net, func(s abyss_net.PendingHandshakeStatistics) bool { return s.Waiting == 0 && s.TimedOut == 1 })
+	t.Log(A_host.GetStatistics())
+}
@@ -0,0 +1,100 @@
+package test
+
+import (
+	"context"
+	"crypto/ed25519"
+	crypto_rand "crypto/rand"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	abyss_host "github.com/MinwooWebeng/abyss_core/host"
+	abyss "github.com/MinwooWebeng/abyss_core/interfaces"
+)
+
+// banList declines the banned peers.
+type banList struct {
+	banned   map[string]bool
+	declined int
+	mtx      sync.Mutex
+}
+
+func (b *banList) PreAccept(peer_hash string, address *net.UDPAddr) (bool, int, string) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.banned[peer_hash] {
+		b.declined++
+		return false, 0x0C01, "banned"
+	}
+	return true, 0, ""
+}
+
+func (b *banList) set(peer_hash string, banned bool) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.banned[peer_hash] = banned
+}
+
+func (b *banList) declineCount() int {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return b.declined
+}
+
+func TestPreAccept(t *testing.T) {
+	_, A_privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+	_, B_privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+	A_host, A_pathmap, _ := abyss_host.NewBetaAbyssHost(context.Background(), &A_privkey, nil)
+	B_host, _, _ := abyss_host.NewBetaAbyssHost(context.Background(), &B_privkey, nil)
+
+	B_hash := B_host.GetLocalAbyssURL().Hash
+	bans := &banList{banned: map[string]bool{B_hash: true}}
+	A_host.NetworkService.HandlePreAccept(bans)
+
+	go A_host.ListenAndServe(context.Background())
+	go B_host.ListenAndServe(context.Background())
+
+	A_host.NetworkService.AppendKnownPeer(B_host.NetworkService.LocalIdentity().RootCertificate(), B_host.NetworkService.LocalIdentity().HandshakeKeyCertificate())
+	B_host.NetworkService.AppendKnownPeer(A_host.NetworkService.LocalIdentity().RootCertificate(), A_host.NetworkService.LocalIdentity().HandshakeKeyCertificate())
+
+	A_world, _ := A_host.OpenWorld("http://a.world.com")
+	A_pathmap.TrySetMapping("/home", A_world.SessionID())
+	world_aurl := A_host.GetLocalAbyssURL()
+	world_aurl.Path = "/home"
+
+	joined := make(chan error, 1)
+	go func() {
+		_, err := B_host.JoinWorld(context.Background(), world_aurl)
+		joined <- err
+	}()
+
+	//while banned, B is declined, and does not reach the world.
+	A_ev_ch := A_world.GetEventChannel()
+	select {
+	case <-A_ev_ch:
+		t.Fatal("banned peer reached the world")
+	case <-joined:
+		t.Fatal("banned peer joined")
+	case <-time.After(2 * time.Second):
+	}
+	if bans.declineCount() == 0 {
+		t.Fatal("PreAccept was not consulted")
+	}
+
+	//B has no address of A to reconnect to, until it dials again.
+	bans.set(B_hash, false)
+	if err := B_host.NetworkService.ConnectAbyssAsync(A_host.GetLocalAbyssURL()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-A_ev_ch:
+		event.(abyss.EWorldMemberRequest).Accept()
+	case <-time.After(10 * time.Second):
+		t.Fatal("unbanned peer was not accepted")
+	}
+	if err := <-joined; err != nil {
+		t.Fatal(err)
+	}
+}
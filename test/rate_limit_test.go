@@ -0,0 +1,73 @@
+package test
+
+import (
+	"context"
+	"crypto/ed25519"
+	crypto_rand "crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/MinwooWebeng/abyss_core/ahmp"
+	abyss_host "github.com/MinwooWebeng/abyss_core/host"
+	abyss "github.com/MinwooWebeng/abyss_core/interfaces"
+	abyss_net "github.com/MinwooWebeng/abyss_core/net_service"
+)
+
+func TestRateLimit(t *testing.T) {
+	_, A_privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+	_, B_privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+	A_host, A_pathmap, err := abyss_host.NewBetaAbyssHostWithConfig(context.Background(), &A_privkey, nil, &abyss_net.BetaNetServiceConfig{
+		MessageRateLimitsPerPeer: map[int]abyss_net.RateLimit{ahmp.SOA_T: {Rate: 1, Burst: 2}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	B_host, _, _ := abyss_host.NewBetaAbyssHost(context.Background(), &B_privkey, nil)
+	A_net := A_host.NetworkService.(*abyss_net.BetaNetService)
+
+	go A_host.ListenAndServe(context.Background())
+	go B_host.ListenAndServe(context.Background())
+
+	A_host.NetworkService.AppendKnownPeer(B_host.NetworkService.LocalIdentity().RootCertificate(), B_host.NetworkService.LocalIdentity().HandshakeKeyCertificate())
+	B_host.NetworkService.AppendKnownPeer(A_host.NetworkService.LocalIdentity().RootCertificate(), A_host.NetworkService.LocalIdentity().HandshakeKeyCertificate())
+
+	A_world, _ := A_host.OpenWorld("http://a.world.com")
+	A_pathmap.TrySetMapping("/home", A_world.SessionID())
+	world_aurl := A_host.GetLocalAbyssURL()
+	world_aurl.Path = "/home"
+
+	A_members := make(chan map[string]bool, 1)
+	go func() { A_members <- acceptMembers(A_world.GetEventChannel(), 1) }()
+	join_ctx, join_ctx_cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer join_ctx_cancel()
+	B_world, err := B_host.JoinWorld(join_ctx, world_aurl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var A_member abyss.IWorldMember
+	for A_member == nil {
+		switch event := (<-B_world.GetEventChannel()).(type) {
+		case abyss.EWorldMemberRequest:
+			event.Accept()
+		case abyss.EWorldMemberReady:
+			A_member = event.Member
+		}
+	}
+	<-A_members
+
+	//B floods A with SOA. A drops the excess, and disconnects B.
+	for range 10 {
+		A_member.AppendObjects([]abyss.ObjectInfo{{ID: uuid.New(), Addr: "carrot.aml"}})
+	}
+	if !waitMemberLeave(A_world.GetEventChannel(), B_host.GetLocalAbyssURL().Hash, 5*time.Second) {
+		t.Fatal("flooding peer was not disconnected")
+	}
+
+	stat := A_net.RateLimited()
+	if stat.Disconnects != 1 || stat.DroppedMessages[ahmp.SOA_T] < 2 {
+		t.Fatal("unexpected statistics: " + stat.String())
+	}
+}
@@ -0,0 +1,202 @@
+package test
+
+import (
+	"context"
+	"crypto/ed25519"
+	crypto_rand "crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	abyss_host "github.com/MinwooWebeng/abyss_core/host"
+	abyss "github.com/MinwooWebeng/abyss_core/interfaces"
+	abyss_net "github.com/MinwooWebeng/abyss_core/net_service"
+)
+
+// waitMemberReturn waits until the member leaves, and accepts it again until it is ready.
+// it does not call t.Fatal, so that it can run off the test goroutine.
+func waitMemberReturn(ev_ch chan any, peer_hash string) error {
+	left := false
+	timeout := time.After(20 * time.Second)
+	for {
+		select {
+		case event_any := <-ev_ch:
+			switch event := event_any.(type) {
+			case abyss.EWorldMemberLeave:
+				if event.PeerHash != peer_hash {
+					return errors.New("unexpected leave " + event.PeerHash)
+				}
+				left = true
+			case abyss.EWorldMemberRequest:
+				if !left {
+					return errors.New("member requested before its leave")
+				}
+				event.Accept()
+			case abyss.EWorldMemberReady:
+				if !left || event.Member.Hash() != peer_hash {
+					return errors.New("unexpected ready " + event.Member.Hash())
+				}
+				return nil
+			default:
+				return fmt.Errorf("unexpected event %T", event_any)
+			}
+		case <-timeout:
+			return errors.New("member not returned")
+		}
+	}
+}
+
+// TestReconnect cuts the network of a member until both sides time out, and checks that the world recovers.
+func TestReconnect(t *testing.T) {
+	_, A_privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+	_, B_privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+	A_host, A_pathmap, _ := abyss_host.NewBetaAbyssHostWithConfig(context.Background(), &A_privkey, nil, &abyss_net.BetaNetServiceConfig{
+		MaxIdleTimeout: 2 * time.Second,
+	})
+	B_conn, err := newSilentPacketConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	B_host, _, _ := abyss_host.NewBetaAbyssHostWithConfig(context.Background(), &B_privkey, nil, &abyss_net.BetaNetServiceConfig{
+		PacketConn:     B_conn,
+		MaxIdleTimeout: 2 * time.Second,
+	})
+
+	go A_host.ListenAndServe(context.Background())
+	go B_host.ListenAndServe(context.Background())
+
+	A_host.NetworkService.AppendKnownPeer(B_host.NetworkService.LocalIdentity().RootCertificate(), B_host.NetworkService.LocalIdentity().HandshakeKeyCertificate())
+	B_host.NetworkService.AppendKnownPeer(A_host.NetworkService.LocalIdentity().RootCertificate(), A_host.NetworkService.LocalIdentity().HandshakeKeyCertificate())
+	A_hash := A_host.NetworkService.LocalIdentity().IDHash()
+	B_hash := B_host.NetworkService.LocalIdentity().IDHash()
+
+	A_world, _ := A_host.OpenWorld("http://a.world.com")
+	A_pathmap.TrySetMapping("/home", A_world.SessionID())
+	world_aurl := A_host.GetLocalAbyssURL()
+	world_aurl.Path = "/home"
+
+	A_members := make(chan map[string]abyss.IWorldMember, 1)
+	go func() { A_members <- readyMembers(A_world.GetEventChannel(), 1) }()
+	join_ctx, join_ctx_cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	B_world, err := B_host.JoinWorld(join_ctx, world_aurl)
+	join_ctx_cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	readyMembers(B_world.GetEventChannel(), 1)
+	<-A_members
+
+	//the network comes back after both sides gave up the connection.
+	B_conn.silenced.Store(true)
+	time.AfterFunc(3*time.Second, func() { B_conn.silenced.Store(false) })
+
+	A_done := make(chan error, 1)
+	go func() { A_done <- waitMemberReturn(A_world.GetEventChannel(), B_hash) }()
+	if err := waitMemberReturn(B_world.GetEventChannel(), A_hash); err != nil {
+		t.Fatal("B:", err)
+	}
+	if err := <-A_done; err != nil {
+		t.Fatal("A:", err)
+	}
+
+	if _, ok := A_world.Member(B_hash); !ok {
+		t.Fatal("B not a member after reconnection")
+	}
+	if _, ok := B_world.Member(A_hash); !ok {
+		t.Fatal("A not a member after reconnection")
+	}
+}
+
+// silentPacketConn stops sending and receiving when silenced, as if the host lost power.
+type silentPacketConn struct {
+	net.PacketConn
+	silenced atomic.Bool
+}
+
+func newSilentPacketConn() (*silentPacketConn, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if err != nil {
+		return nil, err
+	}
+	return &silentPacketConn{PacketConn: conn}, nil
+}
+
+func (c *silentPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if c.silenced.Load() {
+		return len(p), nil
+	}
+	return c.PacketConn.WriteTo(p, addr)
+}
+
+func (c *silentPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(p)
+		if err != nil || !c.silenced.Load() {
+			return n, addr, err
+		}
+	}
+}
+
+// TestReconnectRestart restarts a member without closing its connection.
+// The restarted member must be accepted while the other side still holds the stale connection.
+func TestReconnectRestart(t *testing.T) {
+	_, A_privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+	_, B_privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+	A_host, A_pathmap, _ := abyss_host.NewBetaAbyssHost(context.Background(), &A_privkey, nil)
+	go A_host.ListenAndServe(context.Background())
+
+	B_conn, err := newSilentPacketConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	B_ctx, B_ctx_cancel := context.WithCancel(context.Background())
+	B_host, _, err := abyss_host.NewBetaAbyssHostWithConfig(B_ctx, &B_privkey, nil, &abyss_net.BetaNetServiceConfig{PacketConn: B_conn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go B_host.ListenAndServe(B_ctx)
+
+	A_host.NetworkService.AppendKnownPeer(B_host.NetworkService.LocalIdentity().RootCertificate(), B_host.NetworkService.LocalIdentity().HandshakeKeyCertificate())
+	B_host.NetworkService.AppendKnownPeer(A_host.NetworkService.LocalIdentity().RootCertificate(), A_host.NetworkService.LocalIdentity().HandshakeKeyCertificate())
+	B_hash := B_host.NetworkService.LocalIdentity().IDHash()
+
+	A_world, _ := A_host.OpenWorld("http://a.world.com")
+	A_pathmap.TrySetMapping("/home", A_world.SessionID())
+	world_aurl := A_host.GetLocalAbyssURL()
+	world_aurl.Path = "/home"
+
+	A_members := make(chan map[string]abyss.IWorldMember, 1)
+	go func() { A_members <- readyMembers(A_world.GetEventChannel(), 1) }()
+	join_ctx, join_ctx_cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	B_world, err := B_host.JoinWorld(join_ctx, world_aurl)
+	join_ctx_cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	readyMembers(B_world.GetEventChannel(), 1)
+	<-A_members
+
+	//B goes away without a word, and comes back with the same identity.
+	B_conn.silenced.Store(true)
+	B_ctx_cancel()
+
+	B2_host, _, _ := abyss_host.NewBetaAbyssHost(context.Background(), &B_privkey, nil)
+	go B2_host.ListenAndServe(context.Background())
+	B2_host.NetworkService.AppendKnownPeer(A_host.NetworkService.LocalIdentity().RootCertificate(), A_host.NetworkService.LocalIdentity().HandshakeKeyCertificate())
+
+	A_done := make(chan error, 1)
+	go func() { A_done <- waitMemberReturn(A_world.GetEventChannel(), B_hash) }()
+	join_ctx, join_ctx_cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer join_ctx_cancel()
+	B2_world, err := B2_host.JoinWorld(join_ctx, world_aurl)
+	if err != nil {
+		t.Fatal("rejoin after restart:", err)
+	}
+	readyMembers(B2_world.GetEventChannel(), 1)
+	if err := <-A_done; err != nil {
+		t.Fatal("A:", err)
+	}
+}
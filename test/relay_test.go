@@ -0,0 +1,80 @@
+package test
+
+import (
+	"context"
+	"crypto/ed25519"
+	crypto_rand "crypto/rand"
+	"testing"
+	"time"
+
+	abyss_host "github.com/MinwooWebeng/abyss_core/host"
+	abyss_net "github.com/MinwooWebeng/abyss_core/net_service"
+)
+
+func TestRelay(t *testing.T) {
+	//A and C can not reach each other even with hole punching. B relays between them.
+	A_host, A_nat := newNATHost(t)
+	C_host, C_nat := newNATHost(t)
+	A_nat.Block(C_nat.LocalAddr())
+	C_nat.Block(A_nat.LocalAddr())
+
+	_, B_privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+	B_host, B_pathmap, err := abyss_host.NewBetaAbyssHostWithConfig(context.Background(), &B_privkey, nil, &abyss_net.BetaNetServiceConfig{
+		RelayBandwidth: 1 << 20,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go A_host.ListenAndServe(context.Background())
+	go B_host.ListenAndServe(context.Background())
+	go C_host.ListenAndServe(context.Background())
+
+	for _, joiner := range []*abyss_host.AbyssHost{A_host, C_host} {
+		joiner.NetworkService.AppendKnownPeer(
+			B_host.NetworkService.LocalIdentity().RootCertificate(),
+			B_host.NetworkService.LocalIdentity().HandshakeKeyCertificate(),
+		)
+		B_host.NetworkService.AppendKnownPeer(
+			joiner.NetworkService.LocalIdentity().RootCertificate(),
+			joiner.NetworkService.LocalIdentity().HandshakeKeyCertificate(),
+		)
+	}
+
+	B_world, _ := B_host.OpenWorld("http://b.world.com")
+	B_pathmap.TrySetMapping("/home", B_world.SessionID())
+	world_aurl := B_host.GetLocalAbyssURL()
+	world_aurl.Path = "/home"
+
+	B_hash := B_host.GetLocalAbyssURL().Hash
+	A_hash := A_host.GetLocalAbyssURL().Hash
+	C_hash := C_host.GetLocalAbyssURL().Hash
+
+	join_ctx, join_ctx_cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer join_ctx_cancel()
+	done := make(chan bool, 2)
+	join := func(host *abyss_host.AbyssHost, other_hash string) {
+		world, err := host.JoinWorld(join_ctx, world_aurl)
+		if err != nil {
+			done <- false
+			return
+		}
+		members := acceptMembers(world.GetEventChannel(), 2)
+		done <- members[B_hash] && members[other_hash]
+	}
+	go join(A_host, C_hash)
+	go join(C_host, A_hash)
+	go acceptMembers(B_world.GetEventChannel(), 2)
+
+	//the direct dial and the hole punching time out first.
+	for range 2 {
+		select {
+		case ok := <-done:
+			if !ok {
+				t.Fatal("join failed")
+			}
+		case <-time.After(30 * time.Second):
+			t.Fatal("A and C did not meet through relay")
+		}
+	}
+}
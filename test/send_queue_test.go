@@ -0,0 +1,109 @@
+package test
+
+import (
+	"context"
+	"crypto/ed25519"
+	crypto_rand "crypto/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	abyss_host "github.com/MinwooWebeng/abyss_core/host"
+	abyss "github.com/MinwooWebeng/abyss_core/interfaces"
+	abyss_net "github.com/MinwooWebeng/abyss_core/net_service"
+)
+
+func TestSendQueue(t *testing.T) {
+	_, A_privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+	_, B_privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+	A_host, A_pathmap, _ := abyss_host.NewBetaAbyssHost(context.Background(), &A_privkey, nil)
+	B_host, _, _ := abyss_host.NewBetaAbyssHost(context.Background(), &B_privkey, nil)
+
+	go A_host.ListenAndServe(context.Background())
+	go B_host.ListenAndServe(context.Background())
+
+	A_host.NetworkService.AppendKnownPeer(B_host.NetworkService.LocalIdentity().RootCertificate(), B_host.NetworkService.LocalIdentity().HandshakeKeyCertificate())
+	B_host.NetworkService.AppendKnownPeer(A_host.NetworkService.LocalIdentity().RootCertificate(), A_host.NetworkService.LocalIdentity().HandshakeKeyCertificate())
+
+	A_world, _ := A_host.OpenWorld("http://a.world.com")
+	A_pathmap.TrySetMapping("/home", A_world.SessionID())
+	world_aurl := A_host.GetLocalAbyssURL()
+	world_aurl.Path = "/home"
+
+	A_members := make(chan map[string]bool, 1)
+	go func() { A_members <- acceptMembers(A_world.GetEventChannel(), 1) }()
+	join_ctx, join_ctx_cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer join_ctx_cancel()
+	B_world, err := B_host.JoinWorld(join_ctx, world_aurl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var A_member abyss.IWorldMember
+	for A_member == nil {
+		switch event := (<-B_world.GetEventChannel()).(type) {
+		case abyss.EWorldMemberRequest:
+			event.Accept()
+		case abyss.EWorldMemberReady:
+			A_member = event.Member
+		}
+	}
+	<-A_members
+
+	//sending never waits for the network. every accepted message is delivered.
+	large_addr := strings.Repeat("a", 16*1024)
+	sent := 0
+	start := time.Now()
+	for range 3000 {
+		if A_member.AppendObjects([]abyss.ObjectInfo{{ID: uuid.New(), Addr: large_addr}}) {
+			sent++
+		}
+	}
+	stat := B_host.NetworkService.(*abyss_net.BetaNetService).SendQueues()
+	t.Log("queued", sent, "in", time.Since(start), stat.String())
+	if sent == 0 || stat.DroppedObjectMessages != int64(3000-sent) {
+		t.Fatal("inaccurate send results")
+	}
+
+	received := 0
+	timeout := time.After(30 * time.Second)
+	for received < sent {
+		select {
+		case event := <-A_world.GetEventChannel():
+			if _, ok := event.(abyss.EMemberObjectAppend); !ok {
+				t.Fatalf("unexpected event %T", event)
+			}
+			received++
+		case <-timeout:
+			t.Fatal("received", received, "of", sent)
+		}
+	}
+
+	//a burst of application messages is backpressured like objects, instead of overflowing the control queue.
+	large_payload := make([]byte, 16*1024)
+	sent = 0
+	for range 3000 {
+		if A_member.SendMessage("burst", large_payload) {
+			sent++
+		}
+	}
+	stat = B_host.NetworkService.(*abyss_net.BetaNetService).SendQueues()
+	if stat.OverflowDisconnects != 0 {
+		t.Fatal("disconnected by a message burst", stat.String())
+	}
+	received = 0
+	timeout = time.After(30 * time.Second)
+	for received < sent {
+		select {
+		case event := <-A_world.GetEventChannel():
+			if _, ok := event.(abyss.EWorldMemberMessage); !ok {
+				t.Fatalf("unexpected event %T", event)
+			}
+			received++
+		case <-timeout:
+			t.Fatal("received", received, "of", sent)
+		}
+	}
+}
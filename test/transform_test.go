@@ -0,0 +1,98 @@
+package test
+
+import (
+	"context"
+	"crypto/ed25519"
+	crypto_rand "crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	abyss_host "github.com/MinwooWebeng/abyss_core/host"
+	abyss "github.com/MinwooWebeng/abyss_core/interfaces"
+)
+
+func TestTransformDatagram(t *testing.T) {
+	_, A_privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+	_, B_privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+	A_host, A_pathmap, _ := abyss_host.NewBetaAbyssHost(context.Background(), &A_privkey, nil)
+	B_host, _, _ := abyss_host.NewBetaAbyssHost(context.Background(), &B_privkey, nil)
+
+	go A_host.ListenAndServe(context.Background())
+	go B_host.ListenAndServe(context.Background())
+
+	A_host.NetworkService.AppendKnownPeer(B_host.NetworkService.LocalIdentity().RootCertificate(), B_host.NetworkService.LocalIdentity().HandshakeKeyCertificate())
+	B_host.NetworkService.AppendKnownPeer(A_host.NetworkService.LocalIdentity().RootCertificate(), A_host.NetworkService.LocalIdentity().HandshakeKeyCertificate())
+
+	A_world, _ := A_host.OpenWorld("http://a.world.com")
+	A_pathmap.TrySetMapping("/home", A_world.SessionID())
+	world_aurl := A_host.GetLocalAbyssURL()
+	world_aurl.Path = "/home"
+
+	A_members := make(chan map[string]bool, 1)
+	go func() { A_members <- acceptMembers(A_world.GetEventChannel(), 1) }()
+	join_ctx, join_ctx_cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer join_ctx_cancel()
+	B_world, err := B_host.JoinWorld(join_ctx, world_aurl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var A_member abyss.IWorldMember
+	for A_member == nil {
+		switch event := (<-B_world.GetEventChannel()).(type) {
+		case abyss.EWorldMemberRequest:
+			event.Accept()
+		case abyss.EWorldMemberReady:
+			A_member = event.Member
+		}
+	}
+	<-A_members
+
+	//more objects than a datagram holds, updated repeatedly.
+	objects := make([]abyss.ObjectTransform, 20)
+	for i := range objects {
+		objects[i].ID = uuid.New()
+	}
+	const update_count = 50
+	for i := 1; i <= update_count; i++ {
+		for j := range objects {
+			objects[j].Transform[0] = float32(i)
+		}
+		if !A_member.UpdateTransforms(objects) {
+			t.Fatal("failed to send transforms")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	//each object must only move forward, and reach the latest transform.
+	last := make(map[uuid.UUID]float32)
+	timeout := time.After(5 * time.Second)
+	for len(last) < len(objects) || !allEqual(last, update_count) {
+		select {
+		case event_any := <-A_world.GetEventChannel():
+			event, ok := event_any.(abyss.EMemberObjectTransform)
+			if !ok {
+				t.Fatalf("unexpected event %T", event_any)
+			}
+			for _, transform := range event.Transforms {
+				if transform.Transform[0] <= last[transform.ID] {
+					t.Fatal("stale transform delivered")
+				}
+				last[transform.ID] = transform.Transform[0]
+			}
+		case <-timeout:
+			t.Fatal("latest transforms not received")
+		}
+	}
+}
+
+func allEqual(values map[uuid.UUID]float32, value float32) bool {
+	for _, v := range values {
+		if v != value {
+			return false
+		}
+	}
+	return true
+}
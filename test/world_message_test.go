@@ -0,0 +1,133 @@
+package test
+
+import (
+	"context"
+	"crypto/ed25519"
+	crypto_rand "crypto/rand"
+	"testing"
+	"time"
+
+	abyss_host "github.com/MinwooWebeng/abyss_core/host"
+	abyss "github.com/MinwooWebeng/abyss_core/interfaces"
+	abyss_net "github.com/MinwooWebeng/abyss_core/net_service"
+)
+
+// readyMembers accepts every join request until count members are ready, and returns them by hash.
+func readyMembers(ev_ch chan any, count int) map[string]abyss.IWorldMember {
+	result := make(map[string]abyss.IWorldMember)
+	for len(result) < count {
+		switch event := (<-ev_ch).(type) {
+		case abyss.EWorldMemberRequest:
+			event.Accept()
+		case abyss.EWorldMemberReady:
+			result[event.Member.Hash()] = event.Member
+		default:
+			panic("unexpected world event")
+		}
+	}
+	return result
+}
+
+func waitMemberMessage(t *testing.T, ev_ch chan any, timeout time.Duration) abyss.EWorldMemberMessage {
+	select {
+	case event_any := <-ev_ch:
+		event, ok := event_any.(abyss.EWorldMemberMessage)
+		if !ok {
+			t.Fatalf("unexpected event %T", event_any)
+		}
+		return event
+	case <-time.After(timeout):
+		t.Fatal("message not received")
+	}
+	return abyss.EWorldMemberMessage{}
+}
+
+// TestWorldMessage exchanges custom messages in a world of three, where C does not accept them.
+func TestWorldMessage(t *testing.T) {
+	hosts := make([]*abyss_host.AbyssHost, 3)
+	var A_pathmap *abyss_host.SimplePathResolver
+	for i := range hosts {
+		config := &abyss_net.BetaNetServiceConfig{}
+		if i == 2 {
+			config.DisabledCapabilities = abyss.CAP_CUSTOM_MESSAGE
+		}
+		_, privkey, _ := ed25519.GenerateKey(crypto_rand.Reader)
+		host, pathmap, err := abyss_host.NewBetaAbyssHostWithConfig(context.Background(), &privkey, nil, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			A_pathmap = pathmap
+		}
+		hosts[i] = host
+		go host.ListenAndServe(context.Background())
+	}
+	for _, host := range hosts {
+		for _, other := range hosts {
+			if host != other {
+				host.NetworkService.AppendKnownPeer(other.NetworkService.LocalIdentity().RootCertificate(), other.NetworkService.LocalIdentity().HandshakeKeyCertificate())
+			}
+		}
+	}
+	A_hash := hosts[0].NetworkService.LocalIdentity().IDHash()
+	B_hash := hosts[1].NetworkService.LocalIdentity().IDHash()
+	C_hash := hosts[2].NetworkService.LocalIdentity().IDHash()
+
+	A_world, _ := hosts[0].OpenWorld("http://a.world.com")
+	A_pathmap.TrySetMapping("/home", A_world.SessionID())
+	world_aurl := hosts[0].GetLocalAbyssURL()
+	world_aurl.Path = "/home"
+
+	worlds := []abyss.IAbyssWorld{A_world}
+	members := make([]chan map[string]abyss.IWorldMember, len(hosts))
+	for i := range members {
+		members[i] = make(chan map[string]abyss.IWorldMember, 1)
+	}
+	go func() { members[0] <- readyMembers(A_world.GetEventChannel(), 2) }()
+	for i, host := range hosts[1:] {
+		join_ctx, join_ctx_cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		world, err := host.JoinWorld(join_ctx, world_aurl)
+		join_ctx_cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		worlds = append(worlds, world)
+		go func() { members[i+1] <- readyMembers(world.GetEventChannel(), 2) }()
+	}
+
+	world_members := make([]map[string]abyss.IWorldMember, len(worlds))
+	timeout := time.After(10 * time.Second)
+	for i := range members {
+		select {
+		case world_members[i] = <-members[i]:
+		case <-timeout:
+			t.Fatal("world not formed")
+		}
+	}
+
+	//B -> A
+	if !world_members[1][A_hash].SendMessage("chat", []byte("hi")) {
+		t.Fatal("failed to send message")
+	}
+	event := waitMemberMessage(t, A_world.GetEventChannel(), 5*time.Second)
+	if event.PeerHash != B_hash || event.Topic != "chat" || string(event.Payload) != "hi" {
+		t.Fatalf("unexpected message %+v", event)
+	}
+
+	//C does not accept custom messages.
+	if world_members[1][C_hash].SendMessage("chat", []byte("hi")) {
+		t.Fatal("message sent to a peer without the capability")
+	}
+
+	//A -> everyone
+	A_world.Broadcast("notice", []byte("welcome"))
+	event = waitMemberMessage(t, worlds[1].GetEventChannel(), 5*time.Second)
+	if event.PeerHash != A_hash || event.Topic != "notice" || string(event.Payload) != "welcome" {
+		t.Fatalf("unexpected message %+v", event)
+	}
+	select {
+	case event_any := <-worlds[2].GetEventChannel():
+		t.Fatalf("unexpected event %T", event_any)
+	case <-time.After(500 * time.Millisecond):
+	}
+}